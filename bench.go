@@ -0,0 +1,157 @@
+package main
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/9seconds/mtg/client"
+	"github.com/9seconds/mtg/random"
+)
+
+const benchRetryDelay = 100 * time.Millisecond
+
+type benchResult struct {
+	handshakes  []time.Duration
+	requests    []time.Duration
+	errors      int
+	transferred int
+}
+
+type latencyReport struct {
+	Min string `json:"min"`
+	P50 string `json:"p50"`
+	P90 string `json:"p90"`
+	P99 string `json:"p99"`
+	Max string `json:"max"`
+}
+
+type benchReport struct {
+	Clients          int           `json:"clients"`
+	Duration         string        `json:"duration"`
+	Handshakes       int           `json:"handshakes"`
+	Requests         int           `json:"requests"`
+	Errors           int           `json:"errors"`
+	HandshakeLatency latencyReport `json:"handshake_latency"`
+	RequestLatency   latencyReport `json:"request_latency"`
+	Throughput       float64       `json:"throughput_bytes_per_second"`
+}
+
+func bench() {
+	proxyURL, err := client.ParseProxyURL(*benchURL)
+	if err != nil {
+		usage(err.Error())
+	}
+	if *benchDC < 1 || *benchDC > 5 {
+		usage("DC has to be in 1-5 range.")
+	}
+	sources := makeBenchSources(*benchSeed, *benchClients)
+	results := make([]benchResult, *benchClients)
+	deadline := time.Now().Add(*benchDuration)
+	started := time.Now()
+
+	wg := &sync.WaitGroup{}
+	for i := range results {
+		wg.Add(1)
+		go func(source io.Reader, result *benchResult) {
+			defer wg.Done()
+			runBenchClient(proxyURL, source, deadline, result)
+		}(sources[i], &results[i])
+	}
+	wg.Wait()
+
+	printJSON(makeBenchReport(results, time.Since(started)))
+}
+
+// makeBenchSources returns a source of randomness for each client. Each
+// client has its own source, so repeated runs do not depend on goroutine
+// scheduling. Zero seed means crypto/rand.
+func makeBenchSources(seed int64, clients int) []io.Reader {
+	sources := make([]io.Reader, clients)
+	if seed != 0 {
+		for i := range sources {
+			sources[i] = random.NewDeterministicSource(seed + int64(i))
+		}
+	}
+
+	return sources
+}
+
+// runBenchClient runs a client until deadline. source is a source of
+// randomness, nil means crypto/rand.
+func runBenchClient(proxyURL *client.ProxyURL, source io.Reader, deadline time.Time, result *benchResult) {
+	for time.Now().Before(deadline) {
+		started := time.Now()
+		conn, err := client.DialFrom(source, proxyURL.Addr(), proxyURL.Secret, *benchDC, *benchTimeout)
+		if err != nil {
+			result.errors++
+			time.Sleep(benchRetryDelay)
+			continue
+		}
+		conn.SetDeadline(deadline.Add(*benchTimeout)) // nolint: errcheck, gas
+
+		handshake := true
+		for time.Now().Before(deadline) {
+			n, err := client.RequestPQFrom(source, conn)
+			result.transferred += n
+			if err != nil {
+				result.errors++
+				break
+			}
+
+			if handshake {
+				result.handshakes = append(result.handshakes, time.Since(started))
+				handshake = false
+			} else {
+				result.requests = append(result.requests, time.Since(started))
+			}
+			started = time.Now()
+		}
+		conn.Close() // nolint: errcheck
+	}
+}
+
+func makeBenchReport(results []benchResult, elapsed time.Duration) *benchReport {
+	report := &benchReport{
+		Clients:  len(results),
+		Duration: elapsed.String(),
+	}
+
+	handshakes := []time.Duration{}
+	requests := []time.Duration{}
+	transferred := 0
+	for _, result := range results {
+		handshakes = append(handshakes, result.handshakes...)
+		requests = append(requests, result.requests...)
+		report.Errors += result.errors
+		transferred += result.transferred
+	}
+
+	report.Handshakes = len(handshakes)
+	report.Requests = len(requests)
+	report.HandshakeLatency = makeLatencyReport(handshakes)
+	report.RequestLatency = makeLatencyReport(requests)
+	report.Throughput = float64(transferred) / elapsed.Seconds()
+
+	return report
+}
+
+func makeLatencyReport(latencies []time.Duration) latencyReport {
+	if len(latencies) == 0 {
+		return latencyReport{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	percentile := func(p int) string {
+		return latencies[(len(latencies)-1)*p/100].String()
+	}
+
+	return latencyReport{
+		Min: latencies[0].String(),
+		P50: percentile(50),
+		P90: percentile(90),
+		P99: percentile(99),
+		Max: latencies[len(latencies)-1].String(),
+	}
+}
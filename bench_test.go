@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/9seconds/mtg/obfuscated2"
+	"github.com/stretchr/testify/assert"
+)
+
+func benchHandshakes(seed int64) [][]byte {
+	sources := makeBenchSources(seed, 2)
+	frames := make([][]byte, len(sources))
+
+	wg := &sync.WaitGroup{}
+	for i := range sources {
+		wg.Add(1)
+		go func(idx int, source io.Reader) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, frame := obfuscated2.MakeClientObfuscated2FrameFrom(source, make([]byte, 16), 2)
+				frames[idx] = append(frames[idx], frame...)
+			}
+		}(i, sources[i])
+	}
+	wg.Wait()
+
+	return frames
+}
+
+func TestBenchSourcesRepeatable(t *testing.T) {
+	first := benchHandshakes(42)
+	second := benchHandshakes(42)
+
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first[0], first[1])
+	assert.NotEqual(t, benchHandshakes(0), benchHandshakes(0))
+}
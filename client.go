@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/9seconds/mtg/client"
+	"github.com/9seconds/mtg/proxy"
+)
+
+func runClient() {
+	proxyURL, err := client.ParseProxyURL(*clientURL)
+	if err != nil {
+		usage(err.Error())
+	}
+
+	if *clientDefaultDC < 1 || int(*clientDefaultDC) > len(proxy.TelegramAddresses) {
+		usage("Default DC is out of range.")
+	}
+
+	logger := makeLogger(*clientDebug, *clientVerbose, nil)
+	bindAddr := net.JoinHostPort(clientBindIP.String(), strconv.Itoa(int(*clientBindPort)))
+	tunnel := client.NewTunnel(bindAddr, proxyURL, *clientTimeout, *clientDefaultDC, logger)
+
+	if err := tunnel.Serve(); err != nil {
+		logger.Fatal(err.Error())
+	}
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/9seconds/mtg/obfuscated2"
+	"github.com/juju/errors"
+)
+
+// Conn is a client connection to MTPROTO proxy. Everything written into
+// it is transparently obfuscated for the proxy.
+type Conn struct {
+	conn net.Conn
+	obfs *obfuscated2.Obfuscated2
+}
+
+// Read reads from connection
+func (c *Conn) Read(p []byte) (n int, err error) {
+	n, err = c.conn.Read(p)
+	copy(p, c.obfs.Decrypt(p[:n]))
+	return
+}
+
+// Write writes into connection.
+func (c *Conn) Write(p []byte) (int, error) {
+	return c.conn.Write(c.obfs.Encrypt(p))
+}
+
+// Close closes underlying connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// SetDeadline sets read and write deadlines of underlying connection.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// Dial connects to MTPROTO proxy and performs obfuscated2 handshake.
+// dc is a datacenter number as Telegram clients use it: 1-based,
+// negative for media datacenters.
+func Dial(addr string, secret []byte, dc int16, timeout time.Duration) (*Conn, error) {
+	return DialFrom(nil, addr, secret, dc, timeout)
+}
+
+// DialFrom is Dial which generates handshake frame from given source of
+// randomness. nil source means crypto/rand.
+func DialFrom(source io.Reader, addr string, secret []byte, dc int16, timeout time.Duration) (*Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot dial to proxy")
+	}
+
+	obfs, frame := obfuscated2.MakeClientObfuscated2FrameFrom(source, secret, dc)
+	conn.SetWriteDeadline(time.Now().Add(timeout)) // nolint: errcheck, gas
+	if _, err := conn.Write(frame); err != nil {
+		conn.Close() // nolint: errcheck
+		return nil, errors.Annotate(err, "Cannot write handshake frame")
+	}
+	conn.SetWriteDeadline(time.Time{}) // nolint: errcheck, gas
+
+	return &Conn{conn: conn, obfs: obfs}, nil
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/9seconds/mtg/random"
+	"github.com/juju/errors"
+)
+
+const (
+	reqPQMultiConstructor = 0xbe7e8ef1
+	resPQConstructor      = 0x05162463
+
+	// auth_key_id + message_id + message_length
+	unencryptedHeaderLen = 8 + 8 + 4
+	nonceLen             = 16
+
+	abridgedLongLength  = 0x7f
+	maxAbridgedResponse = 1024
+)
+
+// RequestPQ sends unencrypted req_pq_multi over abridged transport and
+// waits for resPQ. This is the first thing every Telegram client does so
+// it is a cheap way to make a round trip to Telegram through the proxy.
+// It returns a number of bytes sent and received.
+func RequestPQ(conn io.ReadWriter) (int, error) {
+	return RequestPQFrom(nil, conn)
+}
+
+// RequestPQFrom is RequestPQ which generates nonce from given source of
+// randomness. nil source means crypto/rand.
+func RequestPQFrom(source io.Reader, conn io.ReadWriter) (int, error) {
+	nonce := make([]byte, nonceLen)
+	if _, err := random.ReadFrom(source, nonce); err != nil {
+		return 0, errors.Annotate(err, "Cannot generate nonce")
+	}
+
+	message := makeReqPQMulti(nonce)
+	if err := writeAbridged(conn, message); err != nil {
+		return 0, errors.Annotate(err, "Cannot send req_pq_multi")
+	}
+
+	response, err := readAbridged(conn)
+	if err != nil {
+		return len(message), errors.Annotate(err, "Cannot read resPQ")
+	}
+	transferred := len(message) + len(response)
+
+	if len(response) < unencryptedHeaderLen+4+nonceLen {
+		return transferred, errors.New("Response is too short")
+	}
+	body := response[unencryptedHeaderLen:]
+	if binary.LittleEndian.Uint32(body) != resPQConstructor {
+		return transferred, errors.New("Response is not resPQ")
+	}
+	if !bytes.Equal(body[4:4+nonceLen], nonce) {
+		return transferred, errors.New("Response nonce mismatch")
+	}
+
+	return transferred, nil
+}
+
+func makeReqPQMulti(nonce []byte) []byte {
+	message := make([]byte, unencryptedHeaderLen+4+nonceLen)
+	messageID := uint64(time.Now().UnixNano()/int64(time.Second)) << 32
+	messageID |= uint64(time.Now().Nanosecond()) &^ 3
+
+	binary.LittleEndian.PutUint64(message[8:], messageID)
+	binary.LittleEndian.PutUint32(message[16:], 4+nonceLen)
+	binary.LittleEndian.PutUint32(message[20:], reqPQMultiConstructor)
+	copy(message[24:], nonce)
+
+	return message
+}
+
+func writeAbridged(conn io.Writer, message []byte) error {
+	length := len(message) / 4
+
+	var header []byte
+	if length < abridgedLongLength {
+		header = []byte{byte(length)}
+	} else {
+		header = []byte{abridgedLongLength, byte(length), byte(length >> 8), byte(length >> 16)}
+	}
+
+	_, err := conn.Write(append(header, message...))
+	return err
+}
+
+func readAbridged(conn io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header[:1]); err != nil {
+		return nil, err
+	}
+
+	length := int(header[0])
+	if length >= abridgedLongLength {
+		if _, err := io.ReadFull(conn, header[1:]); err != nil {
+			return nil, err
+		}
+		length = int(header[1]) | int(header[2])<<8 | int(header[3])<<16
+	}
+	length *= 4
+
+	if length > maxAbridgedResponse {
+		return nil, errors.Errorf("Unexpected response length %d", length)
+	}
+
+	message := make([]byte, length)
+	if _, err := io.ReadFull(conn, message); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/juju/errors"
+)
+
+const (
+	socks5Version = 0x05
+
+	socks5NoAuth       = 0x00
+	socks5NoAcceptable = 0xff
+
+	socks5CmdConnect = 0x01
+
+	socks5AddrIPv4   = 0x01
+	socks5AddrDomain = 0x03
+	socks5AddrIPv6   = 0x04
+
+	socks5Succeeded           = 0x00
+	socks5NotAllowed          = 0x02
+	socks5HostUnreachable     = 0x04
+	socks5CommandNotSupported = 0x07
+)
+
+// socks5Handshake negotiates SOCKS5 connection (RFC1928) without
+// authentication and returns requested host and port. Only CONNECT
+// command is supported.
+func socks5Handshake(conn io.ReadWriter) (string, string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", "", errors.Annotate(err, "Cannot read greeting")
+	}
+	if header[0] != socks5Version {
+		return "", "", errors.Errorf("Unsupported SOCKS version %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", "", errors.Annotate(err, "Cannot read auth methods")
+	}
+	method := byte(socks5NoAcceptable)
+	for _, value := range methods {
+		if value == socks5NoAuth {
+			method = socks5NoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socks5Version, method}); err != nil {
+		return "", "", errors.Annotate(err, "Cannot write auth method")
+	}
+	if method == socks5NoAcceptable {
+		return "", "", errors.New("Client does not support unauthenticated access")
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", "", errors.Annotate(err, "Cannot read request")
+	}
+	if request[1] != socks5CmdConnect {
+		writeSocks5Reply(conn, socks5CommandNotSupported) // nolint: errcheck
+		return "", "", errors.Errorf("Unsupported SOCKS command %d", request[1])
+	}
+
+	host, err := readSocks5Addr(conn, request[3])
+	if err != nil {
+		return "", "", err
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", "", errors.Annotate(err, "Cannot read port")
+	}
+
+	return host, strconv.Itoa(int(binary.BigEndian.Uint16(port))), nil
+}
+
+func readSocks5Addr(conn io.Reader, addrType byte) (string, error) {
+	var addr []byte
+
+	switch addrType {
+	case socks5AddrIPv4:
+		addr = make([]byte, net.IPv4len)
+	case socks5AddrIPv6:
+		addr = make([]byte, net.IPv6len)
+	case socks5AddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", errors.Annotate(err, "Cannot read domain length")
+		}
+		addr = make([]byte, length[0])
+	default:
+		return "", errors.Errorf("Unknown address type %d", addrType)
+	}
+
+	if _, err := io.ReadFull(conn, addr); err != nil {
+		return "", errors.Annotate(err, "Cannot read address")
+	}
+	if addrType == socks5AddrDomain {
+		return string(addr), nil
+	}
+
+	return net.IP(addr).String(), nil
+}
+
+func writeSocks5Reply(conn io.Writer, status byte) error {
+	_, err := conn.Write([]byte{socks5Version, status, 0x00, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type socks5Buffer struct {
+	input  *bytes.Buffer
+	output *bytes.Buffer
+}
+
+func (s *socks5Buffer) Read(p []byte) (int, error) {
+	return s.input.Read(p)
+}
+
+func (s *socks5Buffer) Write(p []byte) (int, error) {
+	return s.output.Write(p)
+}
+
+func TestSocks5HandshakeIPv4(t *testing.T) {
+	conn := &socks5Buffer{
+		input: bytes.NewBuffer([]byte{
+			5, 1, 0,
+			5, 1, 0, 1, 149, 154, 167, 51, 1, 187,
+		}),
+		output: &bytes.Buffer{},
+	}
+
+	host, port, err := socks5Handshake(conn)
+	assert.Nil(t, err)
+	assert.Equal(t, "149.154.167.51", host)
+	assert.Equal(t, "443", port)
+	assert.Equal(t, []byte{5, 0}, conn.output.Bytes())
+}
+
+func TestSocks5HandshakeAuthRequired(t *testing.T) {
+	conn := &socks5Buffer{
+		input:  bytes.NewBuffer([]byte{5, 1, 2}),
+		output: &bytes.Buffer{},
+	}
+
+	_, _, err := socks5Handshake(conn)
+	assert.NotNil(t, err)
+	assert.Equal(t, []byte{5, 0xff}, conn.output.Bytes())
+}
+
+func TestSocks5HandshakeBind(t *testing.T) {
+	conn := &socks5Buffer{
+		input:  bytes.NewBuffer([]byte{5, 1, 0, 5, 2, 0, 1}),
+		output: &bytes.Buffer{},
+	}
+
+	_, _, err := socks5Handshake(conn)
+	assert.NotNil(t, err)
+	assert.Equal(t, byte(socks5CommandNotSupported), conn.output.Bytes()[3])
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/9seconds/mtg/obfuscated2"
+	"github.com/9seconds/mtg/proxy"
+	"github.com/juju/errors"
+	"go.uber.org/zap"
+)
+
+const abridgedTag = 0xef
+
+// Tunnel is a local SOCKS5 server which forwards connections of Telegram
+// clients to Telegram through remote MTPROTO proxy.
+type Tunnel struct {
+	bindAddr  string
+	proxyURL  *ProxyURL
+	timeout   time.Duration
+	defaultDC int16
+	logger    *zap.SugaredLogger
+}
+
+// Serve accepts SOCKS5 connections.
+func (t *Tunnel) Serve() error {
+	lsock, err := net.Listen("tcp", t.bindAddr)
+	if err != nil {
+		return errors.Annotate(err, "Cannot create listen socket")
+	}
+
+	for {
+		if conn, err := lsock.Accept(); err != nil {
+			t.logger.Warnw("Cannot allocate incoming connection", "error", err)
+		} else {
+			go t.accept(conn)
+		}
+	}
+}
+
+func (t *Tunnel) accept(conn net.Conn) {
+	defer conn.Close() // nolint: errcheck
+
+	addr := conn.RemoteAddr().String()
+	conn.SetDeadline(time.Now().Add(t.timeout)) // nolint: errcheck, gas
+
+	host, port, err := socks5Handshake(conn)
+	if err != nil {
+		t.logger.Warnw("Cannot negotiate SOCKS5", "addr", addr, "error", err)
+		return
+	}
+
+	dc, ok := t.telegramDC(net.ParseIP(host))
+	if !ok {
+		t.logger.Warnw("Client wants to connect to unknown host",
+			"addr", addr, "host", host, "port", port)
+		writeSocks5Reply(conn, socks5NotAllowed) // nolint: errcheck
+		return
+	}
+
+	remote, err := Dial(t.proxyURL.Addr(), t.proxyURL.Secret, dc, t.timeout)
+	if err != nil {
+		t.logger.Warnw("Cannot connect to proxy", "addr", addr, "error", err)
+		writeSocks5Reply(conn, socks5HostUnreachable) // nolint: errcheck
+		return
+	}
+	defer remote.Close() // nolint: errcheck
+
+	if err := writeSocks5Reply(conn, socks5Succeeded); err != nil {
+		t.logger.Warnw("Cannot reply to client", "addr", addr, "error", err)
+		return
+	}
+
+	clientConn, err := terminateClientTransport(conn)
+	if err != nil {
+		t.logger.Warnw("Cannot initialize client connection", "addr", addr, "error", err)
+		return
+	}
+	conn.SetDeadline(time.Time{}) // nolint: errcheck, gas
+
+	t.logger.Debugw("Client connected", "addr", addr, "dc", dc)
+	relay(clientConn, remote)
+	t.logger.Debugw("Client disconnected", "addr", addr, "dc", dc)
+}
+
+// terminateClientTransport strips transport Telegram client uses to talk
+// to Telegram so plain abridged stream could be sent through the proxy.
+// Client may send abridged protocol tag or obfuscated2 frame.
+func terminateClientTransport(conn net.Conn) (io.ReadWriteCloser, error) {
+	frame := make([]byte, obfuscated2.FrameLen)
+	if _, err := io.ReadFull(conn, frame[:1]); err != nil {
+		return nil, errors.Annotate(err, "Cannot read protocol tag")
+	}
+	if frame[0] == abridgedTag {
+		return conn, nil
+	}
+
+	if _, err := io.ReadFull(conn, frame[1:]); err != nil {
+		return nil, errors.Annotate(err, "Cannot read obfuscated2 frame")
+	}
+	obfs, _, err := obfuscated2.ParseObfuscated2TelegramFrame(frame)
+	if err != nil {
+		return nil, errors.Annotate(err, "Only abridged protocol is supported")
+	}
+
+	return &Conn{conn: conn, obfs: obfs}, nil
+}
+
+func relay(left, right io.ReadWriteCloser) {
+	wait := &sync.WaitGroup{}
+	wait.Add(2)
+
+	go func() {
+		defer wait.Done()
+		io.Copy(left, right) // nolint: errcheck
+		left.Close()         // nolint: errcheck
+	}()
+	go func() {
+		defer wait.Done()
+		io.Copy(right, left) // nolint: errcheck
+		right.Close()        // nolint: errcheck
+	}()
+
+	wait.Wait()
+}
+
+// telegramDC finds DC client connects to. Known DC addresses are mapped
+// to their DC, other addresses of Telegram networks go to default DC.
+func (t *Tunnel) telegramDC(ip net.IP) (int16, bool) {
+	if dc, ok := proxy.TelegramDC(ip); ok {
+		return dc, true
+	}
+	if proxy.IsTelegramIP(ip) {
+		return t.defaultDC, true
+	}
+
+	return 0, false
+}
+
+// NewTunnel creates new local SOCKS5 server. Connections to Telegram
+// addresses which are not known DC addresses go to defaultDC.
+func NewTunnel(bindAddr string, proxyURL *ProxyURL, timeout time.Duration, defaultDC int16,
+	logger *zap.SugaredLogger) *Tunnel {
+	return &Tunnel{
+		bindAddr:  bindAddr,
+		proxyURL:  proxyURL,
+		timeout:   timeout,
+		defaultDC: defaultDC,
+		logger:    logger,
+	}
+}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTunnelTelegramDC(t *testing.T) {
+	tunnel := NewTunnel("127.0.0.1:0", nil, 0, 4, nil)
+
+	tests := []struct {
+		ip string
+		dc int16
+		ok bool
+	}{
+		{"149.154.175.100", 3, true},
+		{"149.154.167.151", -2, true},
+		{"149.154.167.222", 4, true},
+		{"2001:b28:f23f:f005::b", 4, true},
+		{"8.8.8.8", 0, false},
+	}
+	for _, test := range tests {
+		dc, ok := tunnel.telegramDC(net.ParseIP(test.ip))
+		assert.Equal(t, test.ok, ok, test.ip)
+		assert.Equal(t, test.dc, dc, test.ip)
+	}
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"encoding/hex"
+	"net"
+	"net/url"
+
+	"github.com/juju/errors"
+)
+
+// ProxyURL is a parsed proxy link, either tg://proxy or
+// https://t.me/proxy one.
+type ProxyURL struct {
+	Server string
+	Port   string
+	Secret []byte
+}
+
+// Addr returns host:port of the proxy.
+func (p *ProxyURL) Addr() string {
+	return net.JoinHostPort(p.Server, p.Port)
+}
+
+// ParseProxyURL parses a link to MTPROTO proxy.
+func ParseProxyURL(rawURL string) (*ProxyURL, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot parse URL")
+	}
+
+	switch {
+	case parsed.Scheme == "tg" && parsed.Host == "proxy":
+	case parsed.Scheme == "https" && parsed.Host == "t.me" && parsed.Path == "/proxy":
+	default:
+		return nil, errors.Errorf("Unsupported proxy URL %s", rawURL)
+	}
+
+	query := parsed.Query()
+	proxyURL := &ProxyURL{
+		Server: query.Get("server"),
+		Port:   query.Get("port"),
+	}
+	if proxyURL.Server == "" || proxyURL.Port == "" {
+		return nil, errors.New("Proxy URL has to have server and port")
+	}
+
+	proxyURL.Secret, err = hex.DecodeString(query.Get("secret"))
+	if err != nil || len(proxyURL.Secret) == 0 {
+		return nil, errors.New("Proxy URL has to have hexadecimal secret")
+	}
+
+	return proxyURL, nil
+}
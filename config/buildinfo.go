@@ -0,0 +1,64 @@
+package config
+
+// BuildInfo describes a build of mtg which is running.
+type BuildInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit"`
+	BuildDate string   `json:"build_date"`
+	GoVersion string   `json:"go_version"`
+	Features  []string `json:"features"`
+}
+
+// Features returns a list of optional features enabled by this
+// configuration.
+func (c *Config) Features() []string {
+	features := []string{}
+
+	if c.PreferIPv6 {
+		features = append(features, "ipv6")
+	}
+	if c.IPv6Only {
+		features = append(features, "ipv6-only")
+	}
+	if c.TestDCs {
+		features = append(features, "test-dcs")
+	}
+	if c.LogSampleFirst > 0 {
+		features = append(features, "log-sampling")
+	}
+	if c.SlowClientRate > 0 {
+		features = append(features, "slow-client-eviction")
+	}
+	switch c.RelayEngine {
+	case "epoll":
+		features = append(features, "epoll-relay")
+	case "io_uring":
+		features = append(features, "io-uring-relay")
+	}
+	if c.FastOpen {
+		features = append(features, "fast-open")
+	}
+	if c.MultipathTCP {
+		features = append(features, "mptcp")
+	}
+	if c.GeoIPDB != "" {
+		features = append(features, "geoip")
+	}
+	if c.KnockToken != "" {
+		features = append(features, "knock")
+	}
+	if c.TarpitMax > 0 {
+		features = append(features, "tarpit")
+	}
+	if c.ASNDB != "" {
+		features = append(features, "asn-filter")
+	}
+	if c.StatsAuthEnabled() {
+		features = append(features, "stats-auth")
+	}
+	if c.StatsTLSEnabled() {
+		features = append(features, "stats-tls")
+	}
+
+	return features
+}
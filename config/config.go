@@ -0,0 +1,153 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/9seconds/mtg/retry"
+)
+
+// Config represents common configuration of mtg.
+type Config struct {
+	Debug   bool
+	Verbose bool
+
+	BindIP     net.IP
+	BindPort   uint16
+	PublicPort uint16
+	ServerName string
+
+	StatsIP       net.IP
+	StatsPort     uint16
+	StatsToken    string
+	StatsUser     string
+	StatsPassword string
+	StatsTLSCert  string
+	StatsTLSKey   string
+
+	ReadTimeout         time.Duration
+	WriteTimeout        time.Duration
+	TelegramDialTimeout time.Duration
+	DCDialTimeouts      map[int16]time.Duration
+	DCReadTimeouts      map[int16]time.Duration
+	TimeoutPolicy       string
+	PreferIPv6          bool
+	IPv6Only            bool
+	ClientIPv6Only      bool
+	DefaultDC           int16
+	TestDCs             bool
+
+	ListenBacklog       int
+	ClientReadBuffer    int
+	ClientWriteBuffer   int
+	TelegramReadBuffer  int
+	TelegramWriteBuffer int
+	FastOpen            bool
+	MultipathTCP        bool
+	AbortiveClose       string
+
+	EgressIPs      []net.IP
+	EgressStrategy string
+	EgressPortFrom uint16
+	EgressPortTo   uint16
+
+	RelayBufferSize       int
+	BackpressureThreshold time.Duration
+	RelayLinger           time.Duration
+	RelayEngine           string
+	RelayJitter           time.Duration
+	TelegramReconnects    uint
+	ClientKeepAlive       time.Duration
+	TelegramKeepAlive     time.Duration
+	KeepAliveInterval     time.Duration
+	KeepAliveProbes       int
+	DrainPeriod           time.Duration
+	MaxConnections        int
+	MaxSessionLifetime    time.Duration
+	GeoIPDB               string
+	GeoIPReload           time.Duration
+	ASNDB                 string
+	AllowASNs             []uint32
+	DenyASNs              []uint32
+	KnockToken            string
+	KnockPort             uint16
+	KnockPeriod           time.Duration
+	TarpitMax             int
+	TarpitDuration        time.Duration
+	FingerprintLog        string
+	StateFile             string
+	DCProbeInterval       time.Duration
+	DCQuarantine          time.Duration
+	TrafficQuota          uint64
+	QuotaActions          []string
+	QuotaThrottleRate     int
+	QuotaWebhook          string
+	Webhooks              []string
+	WebhookEvents         []string
+	WebhookTemplate       string
+	EventBuffer           int
+
+	SlowClientRate    int
+	SlowClientTimeout time.Duration
+
+	Secret []byte
+
+	LogSampleTick       time.Duration
+	LogSampleFirst      uint64
+	LogSampleThereafter uint64
+
+	Retry retry.Policy
+	Build BuildInfo
+}
+
+// KnockAddr returns address proxy should listen on for UDP knock
+// packets.
+func (c *Config) KnockAddr() string {
+	return net.JoinHostPort(c.BindIP.String(), strconv.Itoa(int(c.KnockPort)))
+}
+
+// BindAddr returns address proxy should listen on.
+func (c *Config) BindAddr() string {
+	return net.JoinHostPort(c.BindIP.String(), strconv.Itoa(int(c.BindPort)))
+}
+
+// ListenNetwork returns network proxy should listen on. IPv6 only
+// listener does not accept IPv4 clients even on wildcard address.
+func (c *Config) ListenNetwork() string {
+	if c.ClientIPv6Only {
+		return "tcp6"
+	}
+
+	return "tcp"
+}
+
+// StatsAddr returns address stats server should listen on.
+func (c *Config) StatsAddr() string {
+	return net.JoinHostPort(c.StatsIP.String(), strconv.Itoa(int(c.StatsPort)))
+}
+
+// HexSecret returns secret as hexadecimal string, the way clients expect
+// it.
+func (c *Config) HexSecret() string {
+	return hex.EncodeToString(c.Secret)
+}
+
+// SecretID returns short identifier of the secret which can be shown
+// in metrics without disclosing the secret.
+func (c *Config) SecretID() string {
+	hash := sha256.Sum256(c.Secret)
+	return hex.EncodeToString(hash[:8])
+}
+
+// StatsTLSEnabled tells if stats server should be served over TLS.
+func (c *Config) StatsTLSEnabled() bool {
+	return c.StatsTLSCert != "" && c.StatsTLSKey != ""
+}
+
+// StatsAuthEnabled tells if stats server requires authentication.
+func (c *Config) StatsAuthEnabled() bool {
+	return c.StatsToken != "" || c.StatsUser != ""
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/9seconds/mtg/dctable"
+	"github.com/9seconds/mtg/proxy"
+	"github.com/9seconds/mtg/retry"
+	"github.com/juju/errors"
+)
+
+const dcTableTimeout = 30 * time.Second
+
+func updateDCTable() {
+	table, err := fetchDCTable(*updateDCTableURL)
+	if err != nil {
+		usage(err.Error())
+	}
+	if err := table.Save(*updateDCTablePath); err != nil {
+		usage(err.Error())
+	}
+	fmt.Printf("DC table with %d datacenters is written to %s\n", len(table.DCs), *updateDCTablePath)
+}
+
+func fetchDCTable(url string) (*dctable.Table, error) {
+	table, err := dctable.Fetch(url, dcTableTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if err := table.Validate(len(proxy.TelegramAddresses)); err != nil {
+		return nil, err
+	}
+
+	return table, nil
+}
+
+// applyDCTable overrides compiled-in datacenter addresses with ones from
+// cache file. Missing file is fine, compiled-in addresses are used then.
+func applyDCTable(path string) error {
+	table, err := dctable.Load(path)
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := table.Validate(len(proxy.TelegramAddresses)); err != nil {
+		return err
+	}
+
+	for _, entry := range table.DCs {
+		if err := proxy.SetTelegramAddress(entry.DC, net.JoinHostPort(entry.IPv4, "443"), false); err != nil {
+			return err
+		}
+		if entry.IPv6 == "" {
+			continue
+		}
+		if err := proxy.SetTelegramAddress(entry.DC, net.JoinHostPort(entry.IPv6, "443"), false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// refreshDCTable periodically updates cache file. New addresses are
+// used after restart.
+func refreshDCTable(url, path string, interval time.Duration, policy retry.Policy, logger proxy.Logger) {
+	for range time.Tick(interval) {
+		var table *dctable.Table
+		err := policy.Do(context.Background(), func() (err error) {
+			table, err = fetchDCTable(url)
+			return
+		})
+		if err == nil {
+			err = table.Save(path)
+		}
+		if err != nil {
+			logger.Warnw("Cannot update DC table", "url", url, "error", err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package dctable fetches and caches table of Telegram datacenter
+// addresses, so proxy can follow address changes without new release.
+package dctable
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const maxTableSize = 64 * 1024
+
+// Entry is a pair of addresses of one datacenter. DC is a number as
+// clients send it, starting from 1.
+type Entry struct {
+	DC   int16  `json:"dc"`
+	IPv4 string `json:"ipv4"`
+	IPv6 string `json:"ipv6,omitempty"`
+}
+
+// Table is a list of datacenter addresses. Datacenters which are not
+// listed keep compiled-in addresses.
+type Table struct {
+	DCs []Entry `json:"dcs"`
+}
+
+// Validate checks that table has correct DC numbers and IP addresses.
+// dcCount is a number of known datacenters.
+func (t *Table) Validate(dcCount int) error {
+	if len(t.DCs) == 0 {
+		return errors.New("DC table is empty")
+	}
+
+	for _, entry := range t.DCs {
+		if entry.DC < 1 || int(entry.DC) > dcCount {
+			return errors.Errorf("DC %d is out of range", entry.DC)
+		}
+		if ip := net.ParseIP(entry.IPv4); ip == nil || ip.To4() == nil {
+			return errors.Errorf("Incorrect IPv4 address of DC %d", entry.DC)
+		}
+		if entry.IPv6 == "" {
+			continue
+		}
+		if ip := net.ParseIP(entry.IPv6); ip == nil || ip.To4() != nil {
+			return errors.Errorf("Incorrect IPv6 address of DC %d", entry.DC)
+		}
+	}
+
+	return nil
+}
+
+// Save writes table to file. File is replaced atomically, so it is never
+// left half-written.
+func (t *Table) Save(path string) error {
+	content, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return errors.Annotate(err, "Cannot encode DC table")
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return errors.Annotate(err, "Cannot create DC table file")
+	}
+	defer os.Remove(temp.Name()) // nolint: errcheck
+
+	if _, err = temp.Write(content); err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Annotate(err, "Cannot write DC table file")
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return errors.Annotate(err, "Cannot replace DC table file")
+	}
+
+	return nil
+}
+
+// Load reads table from cache file.
+func Load(path string) (*Table, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot read DC table file")
+	}
+
+	table := &Table{}
+	if err := json.Unmarshal(content, table); err != nil {
+		return nil, errors.Annotate(err, "Cannot decode DC table file")
+	}
+
+	return table, nil
+}
+
+// Fetch downloads table in the same JSON format as cache file has.
+func Fetch(url string, timeout time.Duration) (*Table, error) {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot fetch DC table")
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("DC table server has responded with %s", resp.Status)
+	}
+
+	table := &Table{}
+	decoder := json.NewDecoder(&io.LimitedReader{R: resp.Body, N: maxTableSize})
+	if err := decoder.Decode(table); err != nil {
+		return nil, errors.Annotate(err, "Cannot decode DC table")
+	}
+
+	return table, nil
+}
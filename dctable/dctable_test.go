@@ -0,0 +1,57 @@
+package dctable
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	table := &Table{DCs: []Entry{
+		{DC: 1, IPv4: "149.154.175.50", IPv6: "2001:b28:f23d:f001::a"},
+		{DC: 2, IPv4: "149.154.167.51"},
+	}}
+	assert.Nil(t, table.Validate(5))
+
+	assert.NotNil(t, (&Table{}).Validate(5))
+	assert.NotNil(t, (&Table{DCs: []Entry{{DC: 6, IPv4: "149.154.175.50"}}}).Validate(5))
+	assert.NotNil(t, (&Table{DCs: []Entry{{DC: 1, IPv4: "2001:b28:f23d:f001::a"}}}).Validate(5))
+	assert.NotNil(t, (&Table{DCs: []Entry{{DC: 1, IPv4: "149.154.175.50", IPv6: "149.154.175.51"}}}).Validate(5))
+}
+
+func TestFetchSaveLoad(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"dcs": [{"dc": 2, "ipv4": "149.154.167.50", "ipv6": "2001:67c:4e8:f002::a"}]}`)) // nolint: errcheck
+	}))
+	defer server.Close()
+
+	table, err := Fetch(server.URL, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, []Entry{{DC: 2, IPv4: "149.154.167.50", IPv6: "2001:67c:4e8:f002::a"}}, table.DCs)
+
+	dir, err := ioutil.TempDir("", "dctable")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	path := filepath.Join(dir, "dcs.json")
+	assert.Nil(t, table.Save(path))
+	loaded, err := Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, table, loaded)
+}
+
+func TestFetchError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := Fetch(server.URL, time.Second)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,64 @@
+// Package dns builds resolver which sends queries to given DNS servers
+// instead of ones from system configuration. Hosting providers'
+// resolvers sometimes blackhole Telegram-related names.
+package dns
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const defaultPort = 53
+
+// NewResolver returns resolver which queries given servers in
+// round-robin order. Servers are IP addresses with optional port, like
+// 1.1.1.1 or [2606:4700:4700::1111]:53.
+func NewResolver(servers []string, timeout time.Duration) (*net.Resolver, error) {
+	if len(servers) == 0 {
+		return nil, errors.New("No DNS servers")
+	}
+
+	addrs := make([]string, len(servers))
+	for i, server := range servers {
+		addr, err := normalizeAddress(server)
+		if err != nil {
+			return nil, err
+		}
+		addrs[i] = addr
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var counter uint32
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			idx := atomic.AddUint32(&counter, 1) % uint32(len(addrs))
+			return dialer.DialContext(ctx, network, addrs[idx])
+		},
+	}, nil
+}
+
+func normalizeAddress(server string) (string, error) {
+	if ip := net.ParseIP(server); ip != nil {
+		return net.JoinHostPort(ip.String(), strconv.Itoa(defaultPort)), nil
+	}
+
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		return "", errors.Annotatef(err, "Incorrect DNS server %s", server)
+	}
+	if net.ParseIP(host) == nil {
+		return "", errors.Errorf("DNS server %s has to be an IP address", server)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", errors.Errorf("Incorrect port of DNS server %s", server)
+	}
+
+	return server, nil
+}
@@ -0,0 +1,82 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeAddress(t *testing.T) {
+	addr, err := normalizeAddress("1.1.1.1")
+	assert.Nil(t, err)
+	assert.Equal(t, "1.1.1.1:53", addr)
+
+	addr, err = normalizeAddress("2606:4700:4700::1111")
+	assert.Nil(t, err)
+	assert.Equal(t, "[2606:4700:4700::1111]:53", addr)
+
+	addr, err = normalizeAddress("127.0.0.1:5353")
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:5353", addr)
+
+	_, err = normalizeAddress("dns.google:53")
+	assert.NotNil(t, err)
+	_, err = normalizeAddress("1.1.1.1:dns")
+	assert.NotNil(t, err)
+}
+
+// serveDNS answers every A query with 10.0.0.1.
+func serveDNS(conn net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		end := 12
+		for end < n && buf[end] != 0 {
+			end += int(buf[end]) + 1
+		}
+		end += 5
+		if end > n {
+			continue
+		}
+		query := buf[:end]
+
+		answer := append([]byte{}, query...)
+		answer[2] |= 0x80
+		answer[3] = 0
+		binary.BigEndian.PutUint16(answer[6:], 0)
+		binary.BigEndian.PutUint16(answer[10:], 0)
+		if binary.BigEndian.Uint16(query[end-4:]) == 1 {
+			answer[7] = 1
+			answer = append(answer, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 10, 0, 0, 1)
+		}
+		conn.WriteTo(answer, addr) // nolint: errcheck
+	}
+}
+
+func TestResolver(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close() // nolint: errcheck
+	go serveDNS(conn)
+
+	resolver, err := NewResolver([]string{conn.LocalAddr().String()}, time.Second)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := resolver.LookupHost(ctx, "telegram.example")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.1"}, addrs)
+}
+
+func TestNewResolverNoServers(t *testing.T) {
+	_, err := NewResolver(nil, time.Second)
+	assert.NotNil(t, err)
+}
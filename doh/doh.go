@@ -0,0 +1,221 @@
+// Package doh implements DNS-over-HTTPS (RFC 8484) resolver. It is used
+// to resolve auxiliary hostnames if local resolver is not trusted.
+package doh
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const (
+	typeA    uint16 = 1
+	typeAAAA uint16 = 28
+	classIN  uint16 = 1
+
+	mimeType    = "application/dns-message"
+	maxResponse = 64 * 1024
+)
+
+// Resolver resolves hostnames with DoH server. URL of the server should
+// contain IP address, otherwise it is resolved with system resolver.
+type Resolver struct {
+	url    string
+	client *http.Client
+	dialer net.Dialer
+}
+
+// LookupIP returns IPv4 and IPv6 addresses of the host.
+func (r *Resolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+
+	ips := []net.IP{}
+	var lastErr error
+	for _, qtype := range []uint16{typeA, typeAAAA} {
+		found, err := r.query(ctx, host, qtype)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ips = append(ips, found...)
+	}
+
+	if len(ips) == 0 {
+		if lastErr == nil {
+			lastErr = errors.Errorf("No addresses for %s", host)
+		}
+		return nil, lastErr
+	}
+
+	return ips, nil
+}
+
+// DialContext connects to the address resolving its host with DoH. It
+// can be used as DialContext of http.Transport.
+func (r *Resolver) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, errors.Annotate(err, "Incorrect address")
+	}
+	ips, err := r.LookupIP(ctx, host)
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot resolve host")
+	}
+
+	for _, ip := range ips {
+		var conn net.Conn
+		conn, err = r.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+
+	return nil, err
+}
+
+// HTTPClient returns HTTP client which resolves hostnames with DoH.
+func (r *Resolver) HTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         r.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+	}
+}
+
+func (r *Resolver) query(ctx context.Context, host string, qtype uint16) ([]net.IP, error) {
+	message, err := makeQuery(host, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", r.url, bytes.NewReader(message))
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot create DoH request")
+	}
+	req.Header.Set("Content-Type", mimeType)
+	req.Header.Set("Accept", mimeType)
+
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot send DoH request")
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("DoH server has responded with %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: maxResponse})
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot read DoH response")
+	}
+
+	return parseResponse(body, qtype)
+}
+
+// makeQuery builds DNS query message. ID is 0 as RFC 8484 recommends
+// for HTTP caching.
+func makeQuery(host string, qtype uint16) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.Write([]byte{0, 0, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, errors.Errorf("Incorrect hostname %s", host)
+		}
+		buf.WriteByte(byte(len(label)))
+		buf.WriteString(label)
+	}
+	buf.WriteByte(0)
+	binary.Write(buf, binary.BigEndian, qtype)   // nolint: errcheck
+	binary.Write(buf, binary.BigEndian, classIN) // nolint: errcheck
+
+	return buf.Bytes(), nil
+}
+
+func parseResponse(message []byte, qtype uint16) ([]net.IP, error) {
+	if len(message) < 12 {
+		return nil, errors.New("DNS response is too short")
+	}
+	if rcode := message[3] & 0x0f; rcode != 0 {
+		return nil, errors.Errorf("DNS response has error code %d", rcode)
+	}
+	qdcount := int(binary.BigEndian.Uint16(message[4:6]))
+	ancount := int(binary.BigEndian.Uint16(message[6:8]))
+
+	offset := 12
+	var err error
+	for i := 0; i < qdcount; i++ {
+		if offset, err = skipName(message, offset); err != nil {
+			return nil, err
+		}
+		offset += 4
+	}
+
+	ips := []net.IP{}
+	for i := 0; i < ancount; i++ {
+		if offset, err = skipName(message, offset); err != nil {
+			return nil, err
+		}
+		if offset+10 > len(message) {
+			return nil, errors.New("DNS answer is truncated")
+		}
+		rtype := binary.BigEndian.Uint16(message[offset:])
+		rdlength := int(binary.BigEndian.Uint16(message[offset+8:]))
+		offset += 10
+		if offset+rdlength > len(message) {
+			return nil, errors.New("DNS answer is truncated")
+		}
+
+		rdata := message[offset : offset+rdlength]
+		offset += rdlength
+		if rtype != qtype {
+			continue
+		}
+		if (rtype == typeA && rdlength == net.IPv4len) || (rtype == typeAAAA && rdlength == net.IPv6len) {
+			ips = append(ips, net.IP(append([]byte{}, rdata...)))
+		}
+	}
+
+	return ips, nil
+}
+
+// skipName returns offset right after domain name which starts at
+// given offset. Names may end with compression pointer.
+func skipName(message []byte, offset int) (int, error) {
+	for offset < len(message) {
+		length := int(message[offset])
+		switch {
+		case length == 0:
+			return offset + 1, nil
+		case length&0xc0 == 0xc0:
+			return offset + 2, nil
+		default:
+			offset += length + 1
+		}
+	}
+
+	return 0, errors.New("DNS name is truncated")
+}
+
+// NewResolver creates resolver which uses DoH server with given URL,
+// like https://1.1.1.1/dns-query.
+func NewResolver(url string, timeout time.Duration) *Resolver {
+	return &Resolver{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+		dialer: net.Dialer{Timeout: timeout},
+	}
+}
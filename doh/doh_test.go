@@ -0,0 +1,76 @@
+package doh
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// makeAnswer responds to query with one record which refers to the
+// question name with compression pointer.
+func makeAnswer(query []byte, qtype uint16, rdata []byte) []byte {
+	answer := append([]byte{}, query...)
+	answer[2] |= 0x80
+	answer[7] = 1
+
+	record := []byte{0xc0, 12, 0, 0, 0, 1, 0, 0, 0, 60, 0, 0}
+	binary.BigEndian.PutUint16(record[2:], qtype)
+	binary.BigEndian.PutUint16(record[10:], uint16(len(rdata)))
+
+	return append(append(answer, record...), rdata...)
+}
+
+func TestLookupIP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, mimeType, r.Header.Get("Content-Type"))
+		query, _ := ioutil.ReadAll(r.Body)
+		qtype := binary.BigEndian.Uint16(query[len(query)-4:])
+
+		w.Header().Set("Content-Type", mimeType)
+		if qtype == typeA {
+			w.Write(makeAnswer(query, typeA, net.ParseIP("10.0.0.1").To4()))
+		} else {
+			w.Write(makeAnswer(query, typeAAAA, net.ParseIP("2001:db8::1")))
+		}
+	}))
+	defer server.Close()
+
+	resolver := NewResolver(server.URL, time.Second)
+	ips, err := resolver.LookupIP(context.Background(), "example.com")
+	assert.Nil(t, err)
+	assert.Len(t, ips, 2)
+	assert.True(t, ips[0].Equal(net.ParseIP("10.0.0.1")))
+	assert.True(t, ips[1].Equal(net.ParseIP("2001:db8::1")))
+}
+
+func TestLookupIPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, _ := ioutil.ReadAll(r.Body)
+		query[3] |= 3
+		w.Write(query)
+	}))
+	defer server.Close()
+
+	resolver := NewResolver(server.URL, time.Second)
+	_, err := resolver.LookupIP(context.Background(), "example.com")
+	assert.NotNil(t, err)
+}
+
+func TestLookupIPLiteral(t *testing.T) {
+	resolver := NewResolver("http://127.0.0.1:1", time.Second)
+	ips, err := resolver.LookupIP(context.Background(), "127.0.0.1")
+	assert.Nil(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("127.0.0.1")}, ips)
+}
+
+func TestMakeQueryIncorrectHost(t *testing.T) {
+	_, err := makeQuery("example..com", typeA)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/9seconds/mtg/proxy"
+	"go.uber.org/zap"
+)
+
+// dumpOnSignal writes diagnostic dump of the server each time dump
+// signal is received. Dump goes to timestamped file in dir or to stderr,
+// next to the log, if dir is empty.
+func dumpOnSignal(srv *proxy.Server, dir string, logger *zap.SugaredLogger) {
+	if len(dumpSignals) == 0 {
+		return
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, dumpSignals...)
+
+	for range signals {
+		buf := &bytes.Buffer{}
+		if err := srv.WriteDump(buf); err != nil {
+			logger.Warnw("Cannot make diagnostic dump", "error", err)
+			continue
+		}
+		if dir == "" {
+			os.Stderr.Write(buf.Bytes()) // nolint: errcheck
+			continue
+		}
+
+		name := filepath.Join(dir, "mtg-dump-"+time.Now().Format("20060102T150405")+".txt")
+		if err := ioutil.WriteFile(name, buf.Bytes(), 0600); err != nil {
+			logger.Warnw("Cannot write diagnostic dump", "path", name, "error", err)
+			continue
+		}
+		logger.Infow("Diagnostic dump is written", "path", name)
+	}
+}
@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// dumpSignals is empty because Windows has no SIGUSR1.
+var dumpSignals []os.Signal
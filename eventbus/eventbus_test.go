@@ -0,0 +1,175 @@
+package eventbus
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/proxy"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func testSession() proxy.SessionInfo {
+	return proxy.SessionInfo{
+		SocketID: 1,
+		Addr:     &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1000},
+		DC:       2,
+		BytesIn:  10,
+		BytesOut: 20,
+		Duration: 3 * time.Second,
+	}
+}
+
+func TestNew(t *testing.T) {
+	bus, err := New("nats://127.0.0.1:4222/fleet/eu", "host", "id", zap.NewNop().Sugar())
+	assert.Nil(t, err)
+	assert.Equal(t, "fleet.eu", bus.prefix)
+
+	bus, err = New("mqtt://127.0.0.1:1883", "host", "id", zap.NewNop().Sugar())
+	assert.Nil(t, err)
+	assert.Equal(t, "mtg", bus.prefix)
+
+	_, err = New("kafka://127.0.0.1:9092", "host", "id", zap.NewNop().Sugar())
+	assert.NotNil(t, err)
+	_, err = New("nats:///mtg", "host", "id", zap.NewNop().Sugar())
+	assert.NotNil(t, err)
+}
+
+func TestBusDrops(t *testing.T) {
+	bus, _ := New("nats://127.0.0.1:4222", "host", "id", zap.NewNop().Sugar())
+	hook := bus.Hook(EventConnect)
+	for i := 0; i <= queueSize; i++ {
+		hook(testSession())
+	}
+
+	assert.EqualValues(t, 1, bus.Dropped())
+}
+
+func TestNATS(t *testing.T) {
+	lsock, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer lsock.Close()
+	lines := make(chan string, 10)
+	go func() {
+		sock, err := lsock.Accept()
+		if err != nil {
+			return
+		}
+		defer sock.Close()
+
+		sock.Write([]byte("INFO {\"server_id\":\"test\"}\r\n")) // nolint: errcheck
+		reader := bufio.NewReader(sock)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- strings.TrimSpace(line)
+			if line == "PING\r\n" {
+				sock.Write([]byte("PONG\r\n")) // nolint: errcheck
+			}
+		}
+	}()
+
+	bus, _ := New("nats://"+lsock.Addr().String()+"/fleet", "host", "id", zap.NewNop().Sugar())
+	go bus.Run()
+	bus.Hook(EventDisconnect)(testSession())
+
+	assert.True(t, strings.HasPrefix(<-lines, "CONNECT "))
+	assert.Equal(t, "PING", <-lines)
+	pub := strings.Fields(<-lines)
+	assert.Equal(t, []string{"PUB", "fleet.disconnect"}, pub[:2])
+
+	event := SessionEvent{}
+	assert.Nil(t, json.Unmarshal([]byte(<-lines), &event))
+	assert.Equal(t, "disconnect", event.Event)
+	assert.Equal(t, "127.0.0.1:1000", event.Addr)
+	assert.EqualValues(t, 20, event.BytesOut)
+	assert.Equal(t, 3.0, event.Duration)
+}
+
+func TestMQTT(t *testing.T) {
+	lsock, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer lsock.Close()
+	packets := make(chan []byte, 2)
+	go func() {
+		sock, err := lsock.Accept()
+		if err != nil {
+			return
+		}
+		defer sock.Close()
+
+		for i := 0; i < 2; i++ {
+			header := make([]byte, 2)
+			if _, err = io.ReadFull(sock, header); err != nil {
+				return
+			}
+			length := int(header[1] & 0x7f)
+			if header[1]&0x80 != 0 {
+				extra := []byte{0}
+				io.ReadFull(sock, extra) // nolint: errcheck
+				length += int(extra[0]) * 128
+			}
+			body := make([]byte, length)
+			if _, err = io.ReadFull(sock, body); err != nil {
+				return
+			}
+			packets <- append(header[:1], body...)
+			if header[0] == mqttConnect {
+				sock.Write([]byte{mqttConnack, 2, 0, 0}) // nolint: errcheck
+			}
+		}
+	}()
+
+	bus, _ := New("mqtt://"+lsock.Addr().String()+"/fleet", "host", "id", zap.NewNop().Sugar())
+	go bus.Run()
+	bus.Hook(EventConnect)(testSession())
+
+	connect := <-packets
+	assert.Equal(t, byte(mqttConnect), connect[0])
+	assert.Equal(t, "MQTT", string(connect[3:7]))
+
+	publish := <-packets
+	assert.Equal(t, byte(mqttPublish), publish[0])
+	topicLength := int(publish[1])<<8 | int(publish[2])
+	assert.Equal(t, "fleet/connect", string(publish[3:3+topicLength]))
+
+	event := SessionEvent{}
+	assert.Nil(t, json.Unmarshal(publish[3+topicLength:], &event))
+	assert.Equal(t, "connect", event.Event)
+	assert.Equal(t, "id", event.SecretID)
+}
+
+func TestMQTTPacketLength(t *testing.T) {
+	packet := mqttPacket(mqttPublish, make([]byte, 200))
+
+	assert.Equal(t, []byte{mqttPublish, 0xc8, 0x01}, packet[:3])
+	assert.Len(t, packet, 203)
+}
+
+func TestNATSConnectCredentials(t *testing.T) {
+	assert.Equal(t, "CONNECT {\"verbose\":false,\"pedantic\":false,\"name\":\"mtg\"}\r\nPING\r\n",
+		string(natsConnect(nil)))
+
+	connect := string(natsConnect(url.UserPassword("user", "pass")))
+	assert.Contains(t, connect, "\"user\":\"user\",\"pass\":\"pass\"")
+}
+
+func TestMQTTConnectCredentials(t *testing.T) {
+	body := mqttConnectBody("mtg", nil)
+	assert.Equal(t, byte(mqttCleanSession), body[7])
+	assert.Len(t, body, 15)
+
+	body = mqttConnectBody("mtg", url.UserPassword("user", "pass"))
+	assert.Equal(t, byte(mqttCleanSession|mqttUsernameFlag|mqttPasswordFlag), body[7])
+	assert.Equal(t, "\x00\x04user\x00\x04pass", string(body[15:]))
+
+	body = mqttConnectBody("mtg", url.User("user"))
+	assert.Equal(t, byte(mqttCleanSession|mqttUsernameFlag), body[7])
+	assert.Equal(t, "\x00\x04user", string(body[15:]))
+}
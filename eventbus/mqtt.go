@@ -0,0 +1,129 @@
+package eventbus
+
+import (
+	"encoding/hex"
+	"io"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/9seconds/mtg/random"
+	"github.com/juju/errors"
+)
+
+// Types of MQTT 3.1.1 control packets which are used.
+const (
+	mqttConnect = 0x10
+	mqttConnack = 0x20
+	mqttPublish = 0x30
+)
+
+// Flags of MQTT connect packet.
+const (
+	mqttCleanSession = 0x02
+	mqttPasswordFlag = 0x40
+	mqttUsernameFlag = 0x80
+)
+
+// mqttConn publishes messages with QoS 0. Keep alive is disabled, so
+// connection needs no pings.
+type mqttConn struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (m *mqttConn) publish(topic string, payload []byte) error {
+	body := mqttString(nil, topic)
+	body = append(body, payload...)
+
+	m.conn.SetWriteDeadline(time.Now().Add(m.timeout)) // nolint: errcheck
+	_, err := m.conn.Write(mqttPacket(mqttPublish, body))
+
+	return err
+}
+
+func (m *mqttConn) Close() error {
+	return m.conn.Close()
+}
+
+func mqttString(data []byte, value string) []byte {
+	data = append(data, byte(len(value)>>8), byte(len(value)))
+	return append(data, value...)
+}
+
+// mqttPacket prepends fixed header to packet body. Remaining length is
+// encoded with 7 bits per byte.
+func mqttPacket(kind byte, body []byte) []byte {
+	packet := []byte{kind}
+	length := len(body)
+	for {
+		encoded := byte(length % 128)
+		if length /= 128; length > 0 {
+			encoded |= 0x80
+		}
+		packet = append(packet, encoded)
+		if length == 0 {
+			break
+		}
+	}
+
+	return append(packet, body...)
+}
+
+// mqttConnectBody makes body of connect packet: protocol name, level 4,
+// flags, keep alive 0 and payload. Credentials are sent only if they
+// are set.
+func mqttConnectBody(clientID string, user *url.Userinfo) []byte {
+	flags := byte(mqttCleanSession)
+	password, hasPassword := "", false
+	if user != nil {
+		flags |= mqttUsernameFlag
+		if password, hasPassword = user.Password(); hasPassword {
+			flags |= mqttPasswordFlag
+		}
+	}
+
+	body := mqttString(nil, "MQTT")
+	body = append(body, 4, flags, 0, 0)
+	body = mqttString(body, clientID)
+	if user != nil {
+		body = mqttString(body, user.Username())
+	}
+	if hasPassword {
+		body = mqttString(body, password)
+	}
+
+	return body
+}
+
+func dialMQTT(addr string, user *url.Userinfo, timeout time.Duration) (conn, error) {
+	clientID := make([]byte, 8)
+	if _, err := random.Read(clientID); err != nil {
+		return nil, errors.Annotate(err, "Cannot generate MQTT client id")
+	}
+
+	sock, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot connect to MQTT broker")
+	}
+
+	body := mqttConnectBody("mtg-"+hex.EncodeToString(clientID), user)
+
+	sock.SetDeadline(time.Now().Add(timeout)) // nolint: errcheck
+	if _, err = sock.Write(mqttPacket(mqttConnect, body)); err != nil {
+		sock.Close() // nolint: errcheck
+		return nil, errors.Annotate(err, "Cannot send MQTT connect")
+	}
+	reply := make([]byte, 4)
+	if _, err = io.ReadFull(sock, reply); err != nil {
+		sock.Close() // nolint: errcheck
+		return nil, errors.Annotate(err, "Cannot read MQTT connack")
+	}
+	if reply[0] != mqttConnack || reply[3] != 0 {
+		sock.Close() // nolint: errcheck
+		return nil, errors.Errorf("MQTT connect is rejected with code %d", reply[3])
+	}
+	sock.SetDeadline(time.Time{}) // nolint: errcheck
+
+	return &mqttConn{conn: sock, timeout: timeout}, nil
+}
@@ -0,0 +1,120 @@
+package eventbus
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// natsConnect is CONNECT command followed by PING. Credentials are
+// sent only if they are set.
+func natsConnect(user *url.Userinfo) []byte {
+	options := struct {
+		Verbose  bool   `json:"verbose"`
+		Pedantic bool   `json:"pedantic"`
+		Name     string `json:"name"`
+		User     string `json:"user,omitempty"`
+		Pass     string `json:"pass,omitempty"`
+	}{Name: "mtg"}
+	if user != nil {
+		options.User = user.Username()
+		options.Pass, _ = user.Password()
+	}
+	data, _ := json.Marshal(options) // nolint: gas
+
+	return append(append([]byte("CONNECT "), data...), "\r\nPING\r\n"...)
+}
+
+// natsConn publishes messages with NATS text protocol. Server pings
+// have to be answered, otherwise server drops the connection.
+type natsConn struct {
+	conn    net.Conn
+	timeout time.Duration
+	mutex   sync.Mutex
+}
+
+func (n *natsConn) write(data []byte) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.conn.SetWriteDeadline(time.Now().Add(n.timeout)) // nolint: errcheck
+	_, err := n.conn.Write(data)
+
+	return err
+}
+
+func (n *natsConn) publish(subject string, payload []byte) error {
+	data := make([]byte, 0, len(subject)+len(payload)+32)
+	data = append(data, "PUB "+subject+" "+strconv.Itoa(len(payload))+"\r\n"...)
+	data = append(data, payload...)
+	data = append(data, "\r\n"...)
+
+	return n.write(data)
+}
+
+func (n *natsConn) readLoop(reader *bufio.Reader) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if strings.HasPrefix(line, "PING") {
+			n.write([]byte("PONG\r\n")) // nolint: errcheck
+		}
+	}
+}
+
+func (n *natsConn) Close() error {
+	return n.conn.Close()
+}
+
+func dialNATS(addr string, user *url.Userinfo, timeout time.Duration) (conn, error) {
+	sock, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot connect to NATS")
+	}
+
+	sock.SetDeadline(time.Now().Add(timeout)) // nolint: errcheck
+	reader := bufio.NewReader(sock)
+	if err = natsHandshake(sock, reader, user); err != nil {
+		sock.Close() // nolint: errcheck
+		return nil, err
+	}
+	sock.SetDeadline(time.Time{}) // nolint: errcheck
+
+	nc := &natsConn{conn: sock, timeout: timeout}
+	go nc.readLoop(reader)
+
+	return nc, nil
+}
+
+// natsHandshake reads server INFO, sends CONNECT and waits for PONG, so
+// errors like authorization violation are reported on connect.
+func natsHandshake(sock net.Conn, reader *bufio.Reader, user *url.Userinfo) error {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return errors.Annotate(err, "Cannot read NATS server info")
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return errors.Errorf("Unexpected NATS greeting %q", strings.TrimSpace(line))
+	}
+
+	if _, err = sock.Write(natsConnect(user)); err != nil {
+		return errors.Annotate(err, "Cannot send NATS connect")
+	}
+	if line, err = reader.ReadString('\n'); err != nil {
+		return errors.Annotate(err, "Cannot read NATS connect reply")
+	}
+	if !strings.HasPrefix(line, "PONG") {
+		return errors.Errorf("NATS connect is rejected: %s", strings.TrimSpace(line))
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/9seconds/mtg/eventbus"
+	"github.com/9seconds/mtg/proxy"
+)
+
+// publishEvents makes proxy publish session events to configured event
+// bus.
+func publishEvents(srv *proxy.Server, conf *config.Config, logger proxy.Logger) {
+	if *eventBusURL == "" {
+		return
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = conf.ServerName
+	}
+	bus, err := eventbus.New(*eventBusURL, host, conf.SecretID(), logger)
+	if err != nil {
+		usage(err.Error())
+	}
+
+	srv.OnConnect(bus.Hook(eventbus.EventConnect))
+	srv.OnDisconnect(bus.Hook(eventbus.EventDisconnect))
+	go bus.Run()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/9seconds/mtg/firewall"
+)
+
+func printFirewall() {
+	rules := &firewall.Rules{
+		ProxyPort: *firewallBindPort,
+		KnockPort: *firewallKnockPort,
+		RateLimit: *firewallRateLimit,
+		BanSet:    *firewallBanSet,
+	}
+	if !firewallStatsIP.IsLoopback() {
+		rules.StatsPort = *firewallStatsPort
+	}
+	for _, value := range *firewallStatsAllow {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				usage("Stats allow has to be IP address or CIDR.")
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			network = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+		}
+		rules.StatsAllow = append(rules.StatsAllow, network)
+	}
+
+	output, err := rules.Generate(*firewallFormat)
+	if err != nil {
+		usage(err.Error())
+	}
+	fmt.Print(output)
+}
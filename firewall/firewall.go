@@ -0,0 +1,172 @@
+// Package firewall generates host firewall rules for proxy ports.
+package firewall
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+
+	"github.com/juju/errors"
+)
+
+// Formats of generated rules.
+const (
+	FormatNFTables = "nftables"
+	FormatIPTables = "iptables"
+	FormatUFW      = "ufw"
+)
+
+// Rules describes what has to be reachable from outside.
+type Rules struct {
+	// ProxyPort is a TCP port clients connect to.
+	ProxyPort uint16
+	// StatsPort is a TCP port of stats server. 0 means that stats
+	// server is not exposed.
+	StatsPort uint16
+	// StatsAllow is a list of networks which may access stats server.
+	// Empty list means everyone.
+	StatsAllow []*net.IPNet
+	// KnockPort is a UDP port for knock packets. 0 means that UDP
+	// knocking is disabled.
+	KnockPort uint16
+	// RateLimit is how many new connections per minute single address
+	// may open to proxy port. 0 means no limit.
+	RateLimit uint
+	// BanSet is a name of address set which is dropped before any
+	// other rule. Addresses are added to the set by external tools,
+	// like fail2ban. Empty name disables the set.
+	BanSet string
+}
+
+// Generate returns rules in given format.
+func (r *Rules) Generate(format string) (string, error) {
+	if r.ProxyPort == 0 {
+		return "", errors.New("Proxy port is not set")
+	}
+
+	buf := &bytes.Buffer{}
+	switch format {
+	case FormatNFTables:
+		r.nftables(buf)
+	case FormatIPTables:
+		r.iptables(buf)
+	case FormatUFW:
+		if r.BanSet != "" {
+			return "", errors.New("ufw does not support address sets")
+		}
+		r.ufw(buf)
+	default:
+		return "", errors.Errorf("Unknown format %s", format)
+	}
+
+	return buf.String(), nil
+}
+
+func (r *Rules) nftables(buf *bytes.Buffer) {
+	fmt.Fprintln(buf, "table inet mtg {")
+	if r.BanSet != "" {
+		fmt.Fprintf(buf, "\tset %s4 {\n\t\ttype ipv4_addr\n\t\tflags timeout\n\t}\n", r.BanSet)
+		fmt.Fprintf(buf, "\tset %s6 {\n\t\ttype ipv6_addr\n\t\tflags timeout\n\t}\n", r.BanSet)
+	}
+
+	fmt.Fprintln(buf, "\tchain input {")
+	fmt.Fprintln(buf, "\t\ttype filter hook input priority 0; policy accept;")
+	if r.BanSet != "" {
+		fmt.Fprintf(buf, "\t\tip saddr @%s4 drop\n", r.BanSet)
+		fmt.Fprintf(buf, "\t\tip6 saddr @%s6 drop\n", r.BanSet)
+	}
+	if r.RateLimit > 0 {
+		fmt.Fprintf(buf,
+			"\t\ttcp dport %d ct state new meter mtg-rate4 { ip saddr limit rate over %d/minute } drop\n",
+			r.ProxyPort, r.RateLimit)
+		fmt.Fprintf(buf,
+			"\t\ttcp dport %d ct state new meter mtg-rate6 { ip6 saddr limit rate over %d/minute } drop\n",
+			r.ProxyPort, r.RateLimit)
+	}
+	fmt.Fprintf(buf, "\t\ttcp dport %d accept\n", r.ProxyPort)
+
+	if r.StatsPort != 0 {
+		for _, network := range r.StatsAllow {
+			family := "ip"
+			if network.IP.To4() == nil {
+				family = "ip6"
+			}
+			fmt.Fprintf(buf, "\t\t%s saddr %s tcp dport %d accept\n", family, network, r.StatsPort)
+		}
+		if len(r.StatsAllow) > 0 {
+			fmt.Fprintf(buf, "\t\ttcp dport %d drop\n", r.StatsPort)
+		} else {
+			fmt.Fprintf(buf, "\t\ttcp dport %d accept\n", r.StatsPort)
+		}
+	}
+	if r.KnockPort != 0 {
+		fmt.Fprintf(buf, "\t\tudp dport %d accept\n", r.KnockPort)
+	}
+
+	fmt.Fprintln(buf, "\t}")
+	fmt.Fprintln(buf, "}")
+}
+
+func (r *Rules) iptables(buf *bytes.Buffer) {
+	if r.BanSet != "" {
+		fmt.Fprintf(buf, "ipset -exist create %s4 hash:ip family inet timeout 0\n", r.BanSet)
+		fmt.Fprintf(buf, "ipset -exist create %s6 hash:ip family inet6 timeout 0\n", r.BanSet)
+	}
+
+	for _, cmd := range []string{"iptables", "ip6tables"} {
+		suffix := "4"
+		if cmd == "ip6tables" {
+			suffix = "6"
+		}
+
+		if r.BanSet != "" {
+			fmt.Fprintf(buf, "%s -A INPUT -m set --match-set %s%s src -j DROP\n", cmd, r.BanSet, suffix)
+		}
+		if r.RateLimit > 0 {
+			fmt.Fprintf(buf,
+				"%s -A INPUT -p tcp --dport %d -m conntrack --ctstate NEW -m hashlimit --hashlimit-above %d/minute --hashlimit-mode srcip --hashlimit-name mtg-rate%s -j DROP\n",
+				cmd, r.ProxyPort, r.RateLimit, suffix)
+		}
+		fmt.Fprintf(buf, "%s -A INPUT -p tcp --dport %d -j ACCEPT\n", cmd, r.ProxyPort)
+
+		if r.StatsPort != 0 {
+			for _, network := range r.StatsAllow {
+				if (network.IP.To4() == nil) != (cmd == "ip6tables") {
+					continue
+				}
+				fmt.Fprintf(buf, "%s -A INPUT -p tcp -s %s --dport %d -j ACCEPT\n", cmd, network, r.StatsPort)
+			}
+			if len(r.StatsAllow) == 0 {
+				fmt.Fprintf(buf, "%s -A INPUT -p tcp --dport %d -j ACCEPT\n", cmd, r.StatsPort)
+			} else {
+				fmt.Fprintf(buf, "%s -A INPUT -p tcp --dport %d -j DROP\n", cmd, r.StatsPort)
+			}
+		}
+		if r.KnockPort != 0 {
+			fmt.Fprintf(buf, "%s -A INPUT -p udp --dport %d -j ACCEPT\n", cmd, r.KnockPort)
+		}
+	}
+}
+
+func (r *Rules) ufw(buf *bytes.Buffer) {
+	if r.RateLimit > 0 {
+		fmt.Fprintln(buf, "# ufw limit has fixed rate of 6 connections per 30 seconds")
+		fmt.Fprintf(buf, "ufw limit %d/tcp\n", r.ProxyPort)
+	} else {
+		fmt.Fprintf(buf, "ufw allow %d/tcp\n", r.ProxyPort)
+	}
+
+	if r.StatsPort != 0 {
+		for _, network := range r.StatsAllow {
+			fmt.Fprintf(buf, "ufw allow from %s to any port %d proto tcp\n", network, r.StatsPort)
+		}
+		if len(r.StatsAllow) == 0 {
+			fmt.Fprintf(buf, "ufw allow %d/tcp\n", r.StatsPort)
+		} else {
+			fmt.Fprintf(buf, "ufw deny %d/tcp\n", r.StatsPort)
+		}
+	}
+	if r.KnockPort != 0 {
+		fmt.Fprintf(buf, "ufw allow %d/udp\n", r.KnockPort)
+	}
+}
@@ -0,0 +1,72 @@
+package firewall
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeRules() *Rules {
+	_, v4, _ := net.ParseCIDR("10.0.0.0/8")
+	_, v6, _ := net.ParseCIDR("fd00::/8")
+
+	return &Rules{
+		ProxyPort:  3128,
+		StatsPort:  3129,
+		StatsAllow: []*net.IPNet{v4, v6},
+		KnockPort:  3130,
+		RateLimit:  30,
+		BanSet:     "mtg-banned",
+	}
+}
+
+func TestGenerateNFTables(t *testing.T) {
+	output, err := makeRules().Generate(FormatNFTables)
+	assert.Nil(t, err)
+
+	assert.Contains(t, output, "set mtg-banned4 {")
+	assert.Contains(t, output, "ip6 saddr @mtg-banned6 drop")
+	assert.Contains(t, output, "tcp dport 3128 ct state new meter mtg-rate4 { ip saddr limit rate over 30/minute } drop")
+	assert.Contains(t, output, "ip saddr 10.0.0.0/8 tcp dport 3129 accept")
+	assert.Contains(t, output, "ip6 saddr fd00::/8 tcp dport 3129 accept")
+	assert.Contains(t, output, "tcp dport 3129 drop")
+	assert.Contains(t, output, "udp dport 3130 accept")
+	assert.True(t, strings.Index(output, "@mtg-banned4 drop") < strings.Index(output, "tcp dport 3128 accept"))
+}
+
+func TestGenerateIPTables(t *testing.T) {
+	output, err := makeRules().Generate(FormatIPTables)
+	assert.Nil(t, err)
+
+	assert.Contains(t, output, "ipset -exist create mtg-banned6 hash:ip family inet6 timeout 0")
+	assert.Contains(t, output, "iptables -A INPUT -m set --match-set mtg-banned4 src -j DROP")
+	assert.Contains(t, output, "--hashlimit-above 30/minute")
+	assert.Contains(t, output, "iptables -A INPUT -p tcp -s 10.0.0.0/8 --dport 3129 -j ACCEPT")
+	assert.Contains(t, output, "ip6tables -A INPUT -p tcp -s fd00::/8 --dport 3129 -j ACCEPT")
+	assert.NotContains(t, output, "iptables -A INPUT -p tcp -s fd00::/8")
+	assert.Contains(t, output, "ip6tables -A INPUT -p udp --dport 3130 -j ACCEPT")
+}
+
+func TestGenerateUFW(t *testing.T) {
+	rules := makeRules()
+	_, err := rules.Generate(FormatUFW)
+	assert.NotNil(t, err)
+
+	rules.BanSet = ""
+	rules.StatsPort = 0
+	output, err := rules.Generate(FormatUFW)
+	assert.Nil(t, err)
+	assert.Contains(t, output, "ufw limit 3128/tcp")
+	assert.NotContains(t, output, "3129")
+	assert.Contains(t, output, "ufw allow 3130/udp")
+}
+
+func TestGenerateIncorrect(t *testing.T) {
+	_, err := makeRules().Generate("pf")
+	assert.NotNil(t, err)
+
+	_, err = (&Rules{}).Generate(FormatNFTables)
+	assert.NotNil(t, err)
+}
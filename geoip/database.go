@@ -0,0 +1,50 @@
+package geoip
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// Database is MMDB file which can be reloaded while it is used, for
+// example after it was updated by geoipupdate.
+type Database struct {
+	path   string
+	reader atomic.Value
+}
+
+// Reload reads database file again. Previous version is kept if file
+// cannot be read.
+func (d *Database) Reload() error {
+	reader, err := Open(d.path)
+	if err != nil {
+		return err
+	}
+	d.reader.Store(reader)
+
+	return nil
+}
+
+// Path returns path to the database file.
+func (d *Database) Path() string {
+	return d.path
+}
+
+// Country returns ISO code of the country of IP address.
+func (d *Database) Country(ip net.IP) (string, error) {
+	return d.reader.Load().(*Reader).Country(ip)
+}
+
+// ASN returns number of autonomous system of IP address.
+func (d *Database) ASN(ip net.IP) (uint32, error) {
+	return d.reader.Load().(*Reader).ASN(ip)
+}
+
+// OpenDatabase reads MMDB database which can be reloaded later.
+func OpenDatabase(path string) (*Database, error) {
+	db := &Database{path: path}
+	if err := db.Reload(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
@@ -0,0 +1,36 @@
+package geoip
+
+import "net"
+
+// Country returns ISO code of the country of IP address. Registered
+// country is used if database has no country for the address. Empty
+// string is returned if country is unknown.
+func (r *Reader) Country(ip net.IP) (string, error) {
+	value, err := r.Lookup(ip)
+	if err != nil {
+		return "", err
+	}
+	record, _ := value.(map[string]interface{})
+
+	for _, field := range []string{"country", "registered_country"} {
+		country, _ := record[field].(map[string]interface{})
+		if code, ok := country["iso_code"].(string); ok {
+			return code, nil
+		}
+	}
+
+	return "", nil
+}
+
+// ASN returns number of autonomous system of IP address. 0 is returned
+// if it is unknown.
+func (r *Reader) ASN(ip net.IP) (uint32, error) {
+	value, err := r.Lookup(ip)
+	if err != nil {
+		return 0, err
+	}
+	record, _ := value.(map[string]interface{})
+	asn, _ := record["autonomous_system_number"].(uint64)
+
+	return uint32(asn), nil
+}
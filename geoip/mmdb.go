@@ -0,0 +1,349 @@
+// Package geoip reads MaxMind DB (MMDB) files like GeoLite2 Country
+// and ASN databases.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net"
+
+	"github.com/juju/errors"
+)
+
+const (
+	dataSectionSeparator = 16
+	maxMetadataSize      = 128 * 1024
+	maxDecodeDepth       = 32
+)
+
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// Types of data section fields.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// Reader looks up records of MMDB file. It is safe for concurrent use.
+type Reader struct {
+	buffer     []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+
+	// DatabaseType is a type from metadata, like GeoLite2-Country.
+	DatabaseType string
+}
+
+// Lookup returns record for given IP address. Maps are decoded into
+// map[string]interface{}, arrays into []interface{}, numbers into
+// uint64, int64 or float64. It returns nil if there is no record.
+func (r *Reader) Lookup(ip net.IP) (interface{}, error) {
+	pointer, err := r.findPointer(ip)
+	if err != nil || pointer == 0 {
+		return nil, err
+	}
+
+	offset := pointer - r.nodeCount - dataSectionSeparator
+	if offset >= uint(len(r.data)) {
+		return nil, errors.New("Incorrect data pointer in search tree")
+	}
+	value, _, err := r.decode(offset, 0)
+
+	return value, err
+}
+
+func (r *Reader) findPointer(ip net.IP) (uint, error) {
+	node := uint(0)
+	bits := 128
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+		bits = 32
+		node = r.ipv4Start
+	} else if r.ipVersion == 4 {
+		return 0, errors.New("Cannot look up IPv6 address in IPv4 database")
+	}
+
+	for i := 0; i < bits && node < r.nodeCount; i++ {
+		bit := (ip[i/8] >> uint(7-i%8)) & 1
+		var err error
+		if node, err = r.readNode(node, bit); err != nil {
+			return 0, err
+		}
+	}
+
+	switch {
+	case node == r.nodeCount:
+		return 0, nil
+	case node > r.nodeCount:
+		return node, nil
+	}
+	return 0, errors.New("Search tree is too deep")
+}
+
+func (r *Reader) readNode(node uint, bit byte) (uint, error) {
+	offset := node * r.recordSize / 4
+	if offset+r.recordSize/4 > uint(len(r.buffer)) {
+		return 0, errors.New("Search tree is truncated")
+	}
+	b := r.buffer[offset:]
+
+	switch r.recordSize {
+	case 24:
+		if bit == 0 {
+			return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3])<<16 | uint(b[4])<<8 | uint(b[5]), nil
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6]), nil
+	default:
+		if bit == 0 {
+			return uint(binary.BigEndian.Uint32(b)), nil
+		}
+		return uint(binary.BigEndian.Uint32(b[4:])), nil
+	}
+}
+
+// decode decodes field at given offset of data section. It returns
+// value and offset of the next field.
+func (r *Reader) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, errors.New("Data section is nested too deep")
+	}
+
+	data := r.data
+	if offset >= uint(len(data)) {
+		return nil, 0, errors.New("Data section is truncated")
+	}
+	ctrl := data[offset]
+	offset++
+
+	kind := int(ctrl >> 5)
+	if kind == typePointer {
+		pointer, next, err := r.decodePointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := r.decode(pointer, depth+1)
+		return value, next, err
+	}
+	if kind == typeExtended {
+		if offset >= uint(len(data)) {
+			return nil, 0, errors.New("Data section is truncated")
+		}
+		kind = 7 + int(data[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		extra := size - 28
+		if offset+extra > uint(len(data)) {
+			return nil, 0, errors.New("Data section is truncated")
+		}
+		value := uint(0)
+		for _, b := range data[offset : offset+extra] {
+			value = value<<8 | uint(b)
+		}
+		offset += extra
+		switch extra {
+		case 1:
+			size = 29 + value
+		case 2:
+			size = 285 + value
+		default:
+			size = 65821 + value
+		}
+	}
+
+	if (kind == typeMap || kind == typeArray) && size > uint(len(data))-offset {
+		return nil, 0, errors.New("Data section is truncated")
+	}
+
+	switch kind {
+	case typeMap:
+		return r.decodeMap(size, offset, depth)
+	case typeArray:
+		return r.decodeArray(size, offset, depth)
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(data)) {
+		return nil, 0, errors.New("Data section is truncated")
+	}
+	value := data[offset : offset+size]
+	next := offset + size
+
+	switch kind {
+	case typeString:
+		return string(value), next, nil
+	case typeBytes, typeUint128:
+		return append([]byte{}, value...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("Incorrect size of double")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(value)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("Incorrect size of float")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(value))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		return decodeUint(value), next, nil
+	case typeInt32:
+		return int64(int32(decodeUint(value))), next, nil
+	}
+
+	return nil, 0, errors.Errorf("Unknown data type %d", kind)
+}
+
+func (r *Reader) decodePointer(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint((ctrl>>3)&0x3) + 1
+	if offset+size > uint(len(r.data)) {
+		return 0, 0, errors.New("Data section is truncated")
+	}
+
+	value := uint(0)
+	if size != 4 {
+		value = uint(ctrl & 0x7)
+	}
+	for _, b := range r.data[offset : offset+size] {
+		value = value<<8 | uint(b)
+	}
+
+	switch size {
+	case 2:
+		value += 2048
+	case 3:
+		value += 526336
+	}
+
+	return value, offset + size, nil
+}
+
+func (r *Reader) decodeMap(size, offset uint, depth int) (interface{}, uint, error) {
+	result := make(map[string]interface{}, size)
+	for i := uint(0); i < size; i++ {
+		key, next, err := r.decode(offset, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		name, ok := key.(string)
+		if !ok {
+			return nil, 0, errors.New("Map key is not a string")
+		}
+		if result[name], offset, err = r.decode(next, depth+1); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return result, offset, nil
+}
+
+func (r *Reader) decodeArray(size, offset uint, depth int) (interface{}, uint, error) {
+	result := make([]interface{}, size)
+	for i := range result {
+		var err error
+		if result[i], offset, err = r.decode(offset, depth+1); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return result, offset, nil
+}
+
+func decodeUint(data []byte) uint64 {
+	value := uint64(0)
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+
+	return value
+}
+
+// NewReader parses MMDB database from its content.
+func NewReader(buffer []byte) (*Reader, error) {
+	start := len(buffer) - maxMetadataSize
+	if start < 0 {
+		start = 0
+	}
+	idx := bytes.LastIndex(buffer[start:], metadataMarker)
+	if idx < 0 {
+		return nil, errors.New("Cannot find MMDB metadata")
+	}
+	metadataStart := start + idx + len(metadataMarker)
+
+	reader := &Reader{data: buffer[metadataStart:]}
+	value, _, err := reader.decode(0, 0)
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot decode MMDB metadata")
+	}
+	metadata, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("MMDB metadata is not a map")
+	}
+
+	nodeCount, _ := metadata["node_count"].(uint64)
+	recordSize, _ := metadata["record_size"].(uint64)
+	ipVersion, _ := metadata["ip_version"].(uint64)
+	reader.DatabaseType, _ = metadata["database_type"].(string)
+	if recordSize != 24 && recordSize != 28 && recordSize != 32 {
+		return nil, errors.Errorf("Unsupported record size %d", recordSize)
+	}
+	if ipVersion != 4 && ipVersion != 6 {
+		return nil, errors.Errorf("Unsupported IP version %d", ipVersion)
+	}
+
+	treeSize := nodeCount * recordSize / 4
+	if treeSize+dataSectionSeparator > uint64(start+idx) {
+		return nil, errors.New("MMDB search tree is truncated")
+	}
+	reader.buffer = buffer[:treeSize]
+	reader.data = buffer[treeSize+dataSectionSeparator : start+idx]
+	reader.nodeCount = uint(nodeCount)
+	reader.recordSize = uint(recordSize)
+	reader.ipVersion = uint(ipVersion)
+
+	if ipVersion == 6 {
+		for i := 0; i < 96 && reader.ipv4Start < reader.nodeCount; i++ {
+			if reader.ipv4Start, err = reader.readNode(reader.ipv4Start, 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return reader, nil
+}
+
+// Open reads MMDB database from file.
+func Open(path string) (*Reader, error) {
+	buffer, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot read MMDB file")
+	}
+
+	return NewReader(buffer)
+}
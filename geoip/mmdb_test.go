@@ -0,0 +1,162 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encode writes value in MMDB data section format. Only types and sizes
+// used by tests are supported.
+func encode(buf *bytes.Buffer, value interface{}) {
+	writeCtrl := func(kind int, size int) {
+		sizeBits := size
+		if size >= 29 {
+			sizeBits = 29
+		}
+		if kind > 7 {
+			buf.WriteByte(byte(sizeBits))
+			buf.WriteByte(byte(kind - 7))
+		} else {
+			buf.WriteByte(byte(kind<<5 | sizeBits))
+		}
+		if size >= 29 {
+			buf.WriteByte(byte(size - 29))
+		}
+	}
+
+	switch value := value.(type) {
+	case string:
+		writeCtrl(typeString, len(value))
+		buf.WriteString(value)
+	case uint32:
+		writeCtrl(typeUint32, 4)
+		binary.Write(buf, binary.BigEndian, value) // nolint: errcheck
+	case map[string]interface{}:
+		writeCtrl(typeMap, len(value))
+		keys := []string{}
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			encode(buf, key)
+			encode(buf, value[key])
+		}
+	}
+}
+
+// makeDatabase creates IPv4 database with 24-bit records which has
+// record only for given /8 network.
+func makeDatabase(network byte, record map[string]interface{}) []byte {
+	data := &bytes.Buffer{}
+	encode(data, record)
+
+	const nodeCount = 8
+	tree := &bytes.Buffer{}
+	for i := 0; i < nodeCount; i++ {
+		next := uint32(i + 1)
+		if i == nodeCount-1 {
+			next = nodeCount + dataSectionSeparator
+		}
+		records := [2]uint32{nodeCount, nodeCount}
+		records[(network>>uint(7-i))&1] = next
+		for _, value := range records {
+			tree.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write(tree.Bytes())
+	buf.Write(make([]byte, dataSectionSeparator))
+	buf.Write(data.Bytes())
+	buf.Write(metadataMarker)
+	encode(buf, map[string]interface{}{
+		"node_count":    uint32(nodeCount),
+		"record_size":   uint32(24),
+		"ip_version":    uint32(4),
+		"database_type": "Test",
+	})
+
+	return buf.Bytes()
+}
+
+func TestReaderLookup(t *testing.T) {
+	reader, err := NewReader(makeDatabase(10, map[string]interface{}{
+		"country": map[string]interface{}{"iso_code": "NL"},
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, "Test", reader.DatabaseType)
+
+	country, err := reader.Country(net.ParseIP("10.1.2.3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "NL", country)
+
+	country, err = reader.Country(net.ParseIP("11.1.2.3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "", country)
+
+	_, err = reader.Country(net.ParseIP("2001:db8::1"))
+	assert.NotNil(t, err)
+}
+
+func TestReaderASN(t *testing.T) {
+	reader, err := NewReader(makeDatabase(192, map[string]interface{}{
+		"autonomous_system_number":       uint32(64500),
+		"autonomous_system_organization": "Example",
+	}))
+	assert.Nil(t, err)
+
+	asn, err := reader.ASN(net.ParseIP("192.0.2.1"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(64500), asn)
+
+	asn, err = reader.ASN(net.ParseIP("10.0.0.1"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), asn)
+}
+
+func TestReaderIncorrect(t *testing.T) {
+	_, err := NewReader([]byte("not a database"))
+	assert.NotNil(t, err)
+
+	database := makeDatabase(10, map[string]interface{}{})
+	_, err = NewReader(database[:20])
+	assert.NotNil(t, err)
+}
+
+func TestDatabaseReload(t *testing.T) {
+	fp, err := ioutil.TempFile("", "geoip")
+	assert.Nil(t, err)
+	defer os.Remove(fp.Name())
+	fp.Close()
+
+	write := func(country string) {
+		database := makeDatabase(10, map[string]interface{}{
+			"country": map[string]interface{}{"iso_code": country},
+		})
+		assert.Nil(t, ioutil.WriteFile(fp.Name(), database, 0600))
+	}
+
+	write("NL")
+	db, err := OpenDatabase(fp.Name())
+	assert.Nil(t, err)
+	country, _ := db.Country(net.ParseIP("10.0.0.1"))
+	assert.Equal(t, "NL", country)
+
+	write("DE")
+	assert.Nil(t, db.Reload())
+	country, _ = db.Country(net.ParseIP("10.0.0.1"))
+	assert.Equal(t, "DE", country)
+
+	assert.Nil(t, ioutil.WriteFile(fp.Name(), []byte("broken"), 0600))
+	assert.NotNil(t, db.Reload())
+	country, _ = db.Country(net.ParseIP("10.0.0.1"))
+	assert.Equal(t, "DE", country)
+}
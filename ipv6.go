@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net"
+
+	"github.com/juju/errors"
+)
+
+const (
+	ipifyURLv4 = "https://api.ipify.org"
+	ipifyURLv6 = "https://api6.ipify.org"
+)
+
+// checkGlobalIPv6 checks that host has at least one global IPv6 address,
+// so IPv6 only proxy can be reached from Internet. Unique local
+// addresses (fc00::/7) are not global.
+func checkGlobalIPv6() error {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return errors.Annotate(err, "Cannot get addresses of network interfaces")
+	}
+
+	for _, addr := range addrs {
+		network, ok := addr.(*net.IPNet)
+		if !ok || network.IP.To4() != nil {
+			continue
+		}
+		if network.IP.IsGlobalUnicast() && network.IP[0]&0xfe != 0xfc {
+			return nil
+		}
+	}
+
+	return errors.New("Host has no global IPv6 address")
+}
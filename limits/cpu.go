@@ -0,0 +1,83 @@
+package limits
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// SetMaxProcs sets GOMAXPROCS according to CPU quota of the cgroup
+// process runs in. Nothing is done if GOMAXPROCS environment variable is
+// set or there is no quota. It returns current GOMAXPROCS value.
+func SetMaxProcs() int {
+	if _, ok := os.LookupEnv("GOMAXPROCS"); ok {
+		return runtime.GOMAXPROCS(0)
+	}
+
+	quota, err := cpuQuota(cgroupRoot)
+	if err != nil {
+		return runtime.GOMAXPROCS(0)
+	}
+
+	procs := int(math.Floor(quota))
+	if procs < 1 {
+		procs = 1
+	}
+	if procs < runtime.NumCPU() {
+		runtime.GOMAXPROCS(procs)
+	}
+
+	return runtime.GOMAXPROCS(0)
+}
+
+// cpuQuota returns an amount of CPUs allowed to use by cgroup. Both
+// cgroup v2 and v1 are supported.
+func cpuQuota(root string) (float64, error) {
+	if data, err := ioutil.ReadFile(filepath.Join(root, "cpu.max")); err == nil {
+		chunks := strings.Fields(string(data))
+		if len(chunks) != 2 {
+			return 0, errors.Errorf("Incorrect cpu.max format %q", data)
+		}
+		if chunks[0] == "max" {
+			return 0, errors.New("No CPU quota")
+		}
+
+		return parseQuota(chunks[0], chunks[1])
+	}
+
+	quota, err := ioutil.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+	if err != nil {
+		return 0, errors.Annotate(err, "Cannot read CPU quota")
+	}
+	period, err := ioutil.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, errors.Annotate(err, "Cannot read CPU period")
+	}
+
+	return parseQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+func parseQuota(quota, period string) (float64, error) {
+	quotaValue, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil {
+		return 0, errors.Annotate(err, "Incorrect CPU quota")
+	}
+	if quotaValue <= 0 {
+		return 0, errors.New("No CPU quota")
+	}
+
+	periodValue, err := strconv.ParseInt(period, 10, 64)
+	if err != nil || periodValue <= 0 {
+		return 0, errors.Errorf("Incorrect CPU period %q", period)
+	}
+
+	return float64(quotaValue) / float64(periodValue), nil
+}
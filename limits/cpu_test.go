@@ -0,0 +1,71 @@
+package limits
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeCgroup(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir("", "cgroup")
+	assert.Nil(t, err)
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0700))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0600))
+	}
+
+	return root
+}
+
+func TestCPUQuotaV2(t *testing.T) {
+	root := makeCgroup(t, map[string]string{"cpu.max": "250000 100000\n"})
+	defer os.RemoveAll(root)
+
+	quota, err := cpuQuota(root)
+	assert.Nil(t, err)
+	assert.Equal(t, 2.5, quota)
+}
+
+func TestCPUQuotaV2Unlimited(t *testing.T) {
+	root := makeCgroup(t, map[string]string{"cpu.max": "max 100000\n"})
+	defer os.RemoveAll(root)
+
+	_, err := cpuQuota(root)
+	assert.Error(t, err)
+}
+
+func TestCPUQuotaV1(t *testing.T) {
+	root := makeCgroup(t, map[string]string{
+		"cpu/cpu.cfs_quota_us":  "50000\n",
+		"cpu/cpu.cfs_period_us": "100000\n",
+	})
+	defer os.RemoveAll(root)
+
+	quota, err := cpuQuota(root)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.5, quota)
+}
+
+func TestCPUQuotaV1Unlimited(t *testing.T) {
+	root := makeCgroup(t, map[string]string{
+		"cpu/cpu.cfs_quota_us":  "-1\n",
+		"cpu/cpu.cfs_period_us": "100000\n",
+	})
+	defer os.RemoveAll(root)
+
+	_, err := cpuQuota(root)
+	assert.Error(t, err)
+}
+
+func TestCPUQuotaAbsent(t *testing.T) {
+	root := makeCgroup(t, nil)
+	defer os.RemoveAll(root)
+
+	_, err := cpuQuota(root)
+	assert.Error(t, err)
+}
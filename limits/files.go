@@ -0,0 +1,12 @@
+package limits
+
+// openFilesReserve is an amount of descriptors used by proxy besides
+// client sessions: listeners, stats server, health checks and so on.
+const openFilesReserve = 64
+
+// OpenFilesFor returns an amount of open files required to serve given
+// amount of connections. Each session holds client and Telegram
+// sockets.
+func OpenFilesFor(connections int) uint64 {
+	return 2*uint64(connections) + openFilesReserve
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package limits
+
+import "github.com/juju/errors"
+
+// RaiseOpenFiles raises soft limit of open files up to hard limit. It
+// is supported only on Linux and macOS.
+func RaiseOpenFiles() (uint64, error) {
+	return 0, errors.New("Open files limit is supported only on Linux and macOS")
+}
+
+// CountOpenFiles returns an amount of file descriptors opened by the
+// process. It is supported only on Linux and macOS.
+func CountOpenFiles() (int, error) {
+	return 0, errors.New("Counting open files is supported only on Linux and macOS")
+}
@@ -0,0 +1,12 @@
+package limits
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenFilesFor(t *testing.T) {
+	assert.Equal(t, uint64(openFilesReserve), OpenFilesFor(0))
+	assert.Equal(t, uint64(2000+openFilesReserve), OpenFilesFor(1000))
+}
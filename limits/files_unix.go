@@ -0,0 +1,49 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package limits
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/juju/errors"
+)
+
+// RaiseOpenFiles raises soft limit of open files up to hard limit. It
+// returns resulting soft limit.
+func RaiseOpenFiles() (uint64, error) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, errors.Annotate(err, "Cannot get open files limit")
+	}
+	if limit.Cur >= limit.Max {
+		return limit.Cur, nil
+	}
+
+	current := limit.Cur
+	limit.Cur = limit.Max
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return current, errors.Annotate(err, "Cannot raise open files limit")
+	}
+
+	return limit.Cur, nil
+}
+
+// CountOpenFiles returns an amount of file descriptors opened by the
+// process.
+func CountOpenFiles() (int, error) {
+	dir, err := os.Open("/dev/fd")
+	if err != nil {
+		return 0, errors.Annotate(err, "Cannot open descriptors directory")
+	}
+	defer dir.Close() // nolint: errcheck
+
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return 0, errors.Annotate(err, "Cannot list descriptors")
+	}
+
+	// descriptor of /dev/fd itself is listed as well
+	return len(names) - 1, nil
+}
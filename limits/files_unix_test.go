@@ -0,0 +1,25 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package limits
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountOpenFiles(t *testing.T) {
+	before, err := CountOpenFiles()
+	assert.Nil(t, err)
+	assert.True(t, before > 0)
+
+	file, err := os.Open(os.DevNull)
+	assert.Nil(t, err)
+	defer file.Close() // nolint: errcheck
+
+	after, err := CountOpenFiles()
+	assert.Nil(t, err)
+	assert.Equal(t, before+1, after)
+}
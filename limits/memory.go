@@ -0,0 +1,13 @@
+//go:build go1.19
+// +build go1.19
+
+package limits
+
+import "runtime/debug"
+
+// SetMemoryLimit sets soft memory limit of Go runtime like GOMEMLIMIT
+// environment variable does.
+func SetMemoryLimit(limit int64) error {
+	debug.SetMemoryLimit(limit)
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !go1.19
+// +build !go1.19
+
+package limits
+
+import "github.com/juju/errors"
+
+// SetMemoryLimit sets soft memory limit of Go runtime like GOMEMLIMIT
+// environment variable does. It requires Go 1.19 or newer.
+func SetMemoryLimit(limit int64) error {
+	return errors.New("Memory limit is supported only if built with Go 1.19 or newer")
+}
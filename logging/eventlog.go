@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+type eventReporter interface {
+	Report(level zapcore.Level, message string) error
+}
+
+// eventLogCore writes entries to system event log. Time and level are
+// recorded by event log itself, so only message and fields are
+// encoded.
+type eventLogCore struct {
+	zapcore.LevelEnabler
+
+	encoder  zapcore.Encoder
+	reporter eventReporter
+}
+
+func (e *eventLogCore) With(fields []zapcore.Field) zapcore.Core {
+	encoder := e.encoder.Clone()
+	for i := range fields {
+		fields[i].AddTo(encoder)
+	}
+
+	return &eventLogCore{
+		LevelEnabler: e.LevelEnabler,
+		encoder:      encoder,
+		reporter:     e.reporter,
+	}
+}
+
+func (e *eventLogCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if e.Enabled(entry.Level) {
+		return checked.AddCore(entry, e)
+	}
+
+	return checked
+}
+
+func (e *eventLogCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := e.encoder.EncodeEntry(entry, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	return e.reporter.Report(entry.Level, strings.TrimSpace(buf.String()))
+}
+
+func (e *eventLogCore) Sync() error {
+	return nil
+}
+
+func newEventLogCore(reporter eventReporter, enabler zapcore.LevelEnabler) zapcore.Core {
+	return &eventLogCore{
+		LevelEnabler: enabler,
+		encoder: zapcore.NewJSONEncoder(zapcore.EncoderConfig{
+			MessageKey:     "msg",
+			NameKey:        "logger",
+			LineEnding:     zapcore.DefaultLineEnding,
+			EncodeDuration: zapcore.StringDurationEncoder,
+		}),
+		reporter: reporter,
+	}
+}
+
+// NewEventLogCore returns core which writes entries enabled by enabler
+// to event log.
+func NewEventLogCore(log *EventLog, enabler zapcore.LevelEnabler) zapcore.Core {
+	return newEventLogCore(log, enabler)
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package logging
+
+import (
+	"github.com/juju/errors"
+	"go.uber.org/zap/zapcore"
+)
+
+// EventLog writes messages to Windows Event Log. It is not available
+// on other platforms.
+type EventLog struct{}
+
+// Report does nothing.
+func (e *EventLog) Report(level zapcore.Level, message string) error {
+	return nil
+}
+
+// Close does nothing.
+func (e *EventLog) Close() error {
+	return nil
+}
+
+// OpenEventLog returns error, event log is supported on Windows only.
+func OpenEventLog(source string) (*EventLog, error) {
+	return nil, errors.New("Event log is supported on Windows only")
+}
@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type eventReport struct {
+	level   zapcore.Level
+	message string
+}
+
+type fakeEventReporter struct {
+	reports []eventReport
+}
+
+func (f *fakeEventReporter) Report(level zapcore.Level, message string) error {
+	f.reports = append(f.reports, eventReport{level: level, message: message})
+	return nil
+}
+
+func TestEventLogCore(t *testing.T) {
+	reporter := &fakeEventReporter{}
+	logger := zap.New(newEventLogCore(reporter, zapcore.WarnLevel)).With(zap.String("addr", "127.0.0.1"))
+
+	logger.Info("Client connected")
+	logger.Warn("Cannot set socket buffers", zap.Int("size", 10))
+	logger.Error("Cannot create listen socket")
+
+	assert.Equal(t, []eventReport{
+		{level: zapcore.WarnLevel, message: `{"msg":"Cannot set socket buffers","addr":"127.0.0.1","size":10}`},
+		{level: zapcore.ErrorLevel, message: `{"msg":"Cannot create listen socket","addr":"127.0.0.1"}`},
+	}, reporter.reports)
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/juju/errors"
+	"go.uber.org/zap/zapcore"
+)
+
+// Event types of ReportEvent.
+const (
+	eventlogError       = 0x0001
+	eventlogWarning     = 0x0002
+	eventlogInformation = 0x0004
+
+	eventID = 1
+)
+
+var (
+	advapi32                  = syscall.NewLazyDLL("advapi32.dll")
+	procRegisterEventSource   = advapi32.NewProc("RegisterEventSourceW")
+	procDeregisterEventSource = advapi32.NewProc("DeregisterEventSource")
+	procReportEvent           = advapi32.NewProc("ReportEventW")
+)
+
+// EventLog writes messages to Windows Event Log.
+type EventLog struct {
+	handle uintptr
+}
+
+// Report writes message to event log with event type which corresponds
+// to given level.
+func (e *EventLog) Report(level zapcore.Level, message string) error {
+	eventType := eventlogInformation
+	switch {
+	case level >= zapcore.ErrorLevel:
+		eventType = eventlogError
+	case level == zapcore.WarnLevel:
+		eventType = eventlogWarning
+	}
+
+	text, err := syscall.UTF16PtrFromString(message)
+	if err != nil {
+		return errors.Annotate(err, "Incorrect event message")
+	}
+	strings := []*uint16{text}
+
+	ok, _, err := procReportEvent.Call(e.handle, uintptr(eventType), 0, eventID, 0,
+		uintptr(len(strings)), 0, uintptr(unsafe.Pointer(&strings[0])), 0)
+	if ok == 0 {
+		return errors.Annotate(err, "Cannot report event")
+	}
+
+	return nil
+}
+
+// Close deregisters event source.
+func (e *EventLog) Close() error {
+	if ok, _, err := procDeregisterEventSource.Call(e.handle); ok == 0 {
+		return errors.Annotate(err, "Cannot deregister event source")
+	}
+
+	return nil
+}
+
+// OpenEventLog registers event source with given name.
+func OpenEventLog(source string) (*EventLog, error) {
+	name, err := syscall.UTF16PtrFromString(source)
+	if err != nil {
+		return nil, errors.Annotate(err, "Incorrect event source")
+	}
+
+	handle, _, err := procRegisterEventSource.Call(0, uintptr(unsafe.Pointer(name)))
+	if handle == 0 {
+		return nil, errors.Annotate(err, "Cannot register event source")
+	}
+
+	return &EventLog{handle: handle}, nil
+}
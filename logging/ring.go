@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/9seconds/mtg/ring"
+	"go.uber.org/zap/zapcore"
+)
+
+// RingEntry is a log entry kept in memory.
+type RingEntry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"msg"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+func (e *RingEntry) matches(filters map[string]string) bool {
+	for key, value := range filters {
+		if key == "level" {
+			if e.Level != value {
+				return false
+			}
+			continue
+		}
+		field, ok := e.Fields[key]
+		if !ok || fmt.Sprint(field) != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Ring keeps last log entries in memory, so lines of a single session
+// can be found by socketid without external log storage.
+type Ring struct {
+	entries *ring.Ring
+}
+
+// Entries returns entries, oldest first, which have all given fields.
+// Field values are compared in their text form, level is matched with
+// level name.
+func (r *Ring) Entries(filters map[string]string) []RingEntry {
+	entries := []RingEntry{}
+	for _, item := range r.entries.Items() {
+		if entry := item.(RingEntry); entry.matches(filters) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// ServeHTTP responds with entries filtered by query parameters, like
+// /logs?socketid=42.
+func (r *Ring) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	filters := map[string]string{}
+	for key, values := range req.URL.Query() {
+		filters[key] = values[0]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(r.Entries(filters)) // nolint: errcheck, gas
+}
+
+// Core returns core which writes entries enabled by enabler to the
+// ring.
+func (r *Ring) Core(enabler zapcore.LevelEnabler) zapcore.Core {
+	return &ringCore{LevelEnabler: enabler, ring: r}
+}
+
+// NewRing creates ring which keeps size last entries.
+func NewRing(size int) *Ring {
+	return &Ring{entries: ring.New(size)}
+}
+
+type ringCore struct {
+	zapcore.LevelEnabler
+
+	ring   *Ring
+	fields []zapcore.Field
+}
+
+func (c *ringCore) With(fields []zapcore.Field) zapcore.Core {
+	return &ringCore{
+		LevelEnabler: c.LevelEnabler,
+		ring:         c.ring,
+		fields:       append(c.fields[:len(c.fields):len(c.fields)], fields...),
+	}
+}
+
+func (c *ringCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+
+	return checked
+}
+
+func (c *ringCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	encoder := zapcore.NewMapObjectEncoder()
+	for i := range c.fields {
+		c.fields[i].AddTo(encoder)
+	}
+	for i := range fields {
+		fields[i].AddTo(encoder)
+	}
+	// ring is served over HTTP, secret must not leak there
+	delete(encoder.Fields, "secret")
+
+	c.ring.entries.Add(RingEntry{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+		Fields:  encoder.Fields,
+	})
+
+	return nil
+}
+
+func (c *ringCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRingEntries(t *testing.T) {
+	ring := NewRing(3)
+	logger := zap.New(ring.Core(zapcore.InfoLevel))
+	session := logger.With(zap.String("socketid", "1"))
+
+	logger.Debug("Not kept")
+	session.Info("Client connected", zap.Binary("secret", []byte{1}))
+	logger.Info("Listener is added", zap.String("socketid", "2"))
+	session.Warn("Cannot initialize Telegram connection", zap.Int16("dc", 2))
+	session.Warn("Dead peer detected, close connection")
+
+	entries := ring.Entries(map[string]string{"socketid": "1"})
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "Cannot initialize Telegram connection", entries[0].Message)
+	assert.EqualValues(t, 2, entries[0].Fields["dc"])
+	assert.Equal(t, "Dead peer detected, close connection", entries[1].Message)
+
+	assert.Len(t, ring.Entries(map[string]string{"socketid": "1", "dc": "2"}), 1)
+	assert.Len(t, ring.Entries(map[string]string{"level": "info"}), 1)
+	assert.Len(t, ring.Entries(nil), 3)
+}
+
+func TestRingDropsSecret(t *testing.T) {
+	ring := NewRing(1)
+	zap.New(ring.Core(zapcore.InfoLevel)).Info("Client connected", zap.Binary("secret", []byte{1}))
+
+	_, ok := ring.Entries(nil)[0].Fields["secret"]
+	assert.False(t, ok)
+}
+
+func TestRingServeHTTP(t *testing.T) {
+	ring := NewRing(10)
+	logger := zap.New(ring.Core(zapcore.InfoLevel))
+	logger.Info("Client connected", zap.String("socketid", "1"))
+	logger.Info("Client connected", zap.String("socketid", "2"))
+
+	recorder := httptest.NewRecorder()
+	ring.ServeHTTP(recorder, httptest.NewRequest("GET", "/logs?socketid=2", nil))
+
+	entries := []RingEntry{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "2", entries[0].Fields["socketid"])
+}
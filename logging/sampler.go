@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// samplerState is shared between all cores derived with With.
+type samplerState struct {
+	tick       time.Duration
+	first      uint64
+	thereafter uint64
+	onSuppress func()
+
+	mutex    sync.Mutex
+	counters map[samplerKey]*samplerCounter
+}
+
+type samplerKey struct {
+	level   zapcore.Level
+	message string
+}
+
+type samplerCounter struct {
+	resetAt time.Time
+	count   uint64
+}
+
+// allow tells if an entry should be logged. Within every tick, first
+// entries with the same level and message are logged, then only every
+// thereafter-th one.
+func (s *samplerState) allow(entry zapcore.Entry) bool {
+	key := samplerKey{level: entry.Level, message: entry.Message}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	counter, ok := s.counters[key]
+	if !ok || !entry.Time.Before(counter.resetAt) {
+		counter = &samplerCounter{resetAt: entry.Time.Add(s.tick)}
+		s.counters[key] = counter
+	}
+	counter.count++
+
+	if counter.count <= s.first {
+		return true
+	}
+	return s.thereafter > 0 && (counter.count-s.first)%s.thereafter == 0
+}
+
+type samplingCore struct {
+	zapcore.Core
+
+	state *samplerState
+}
+
+func (s *samplingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &samplingCore{
+		Core:  s.Core.With(fields),
+		state: s.state,
+	}
+}
+
+func (s *samplingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !s.Enabled(entry.Level) {
+		return checked
+	}
+	if entry.Level < zapcore.ErrorLevel && !s.state.allow(entry) {
+		s.state.onSuppress()
+		return checked
+	}
+
+	return s.Core.Check(entry, checked)
+}
+
+// NewSamplingCore wraps core so it logs only first entries with the
+// same level and message within each tick and then every thereafter-th.
+// Suppressed entries are reported to onSuppress. Errors and more severe
+// entries are never sampled.
+func NewSamplingCore(core zapcore.Core, tick time.Duration, first, thereafter uint64,
+	onSuppress func()) zapcore.Core {
+	return &samplingCore{
+		Core: core,
+		state: &samplerState{
+			tick:       tick,
+			first:      first,
+			thereafter: thereafter,
+			onSuppress: onSuppress,
+			counters:   map[samplerKey]*samplerCounter{},
+		},
+	}
+}
@@ -0,0 +1,49 @@
+package logging
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSamplerAllow(t *testing.T) {
+	state := &samplerState{
+		tick:       time.Second,
+		first:      2,
+		thereafter: 3,
+		counters:   map[samplerKey]*samplerCounter{},
+	}
+	now := time.Now()
+	entry := zapcore.Entry{Level: zapcore.WarnLevel, Message: "msg", Time: now}
+
+	allowed := []bool{}
+	for i := 0; i < 8; i++ {
+		allowed = append(allowed, state.allow(entry))
+	}
+	assert.Equal(t, []bool{true, true, false, false, true, false, false, true}, allowed)
+
+	other := zapcore.Entry{Level: zapcore.WarnLevel, Message: "other", Time: now}
+	assert.True(t, state.allow(other))
+
+	entry.Time = now.Add(time.Second)
+	assert.True(t, state.allow(entry))
+}
+
+func TestSamplerNeverSuppressesErrors(t *testing.T) {
+	suppressed := 0
+	inner := zapcore.NewCore(
+		zapcore.NewJSONEncoder(zapcore.EncoderConfig{}),
+		zapcore.AddSync(ioutil.Discard),
+		zapcore.DebugLevel,
+	)
+	core := NewSamplingCore(inner, time.Second, 0, 0, func() {
+		suppressed++
+	})
+
+	assert.Nil(t, core.Check(zapcore.Entry{Level: zapcore.WarnLevel, Time: time.Now()}, nil))
+	assert.NotNil(t, core.Check(zapcore.Entry{Level: zapcore.ErrorLevel, Time: time.Now()}, nil))
+	assert.Equal(t, 1, suppressed)
+}
@@ -3,83 +3,666 @@ package main
 //go:generate scripts/generate_version.sh
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/9seconds/mtg/config"
+	"github.com/9seconds/mtg/dns"
+	"github.com/9seconds/mtg/doh"
+	"github.com/9seconds/mtg/firewall"
+	"github.com/9seconds/mtg/limits"
+	"github.com/9seconds/mtg/logging"
 	"github.com/9seconds/mtg/proxy"
+	"github.com/9seconds/mtg/retry"
+	"github.com/juju/errors"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
+const (
+	dohTimeout = 10 * time.Second
+	dnsTimeout = 5 * time.Second
+)
+
 var (
 	app = kingpin.New("mtg", "Simple MTPROTO proxy.")
 
-	debug = app.Flag("debug", "Run in debug mode.").
+	runCommand = app.Command("run", "Run proxy.").Default()
+
+	debug = runCommand.Flag("debug", "Run in debug mode.").
 		Short('d').
 		Envar("MTG_DEBUG").
 		Bool()
-	verbose = app.Flag("verbose", "Run in verbose mode.").
+	verbose = runCommand.Flag("verbose", "Run in verbose mode.").
 		Short('v').
 		Envar("MTG_VERBOSE").
 		Bool()
-	bindIP = app.Flag("bind-ip", "Which IP to bind to.").
+	bindIP = runCommand.Flag("bind-ip", "Which IP to bind to.").
 		Short('i').
 		Envar("MTG_IP").
 		Default("127.0.0.1").
 		IP()
-	bindPort = app.Flag("bind-port", "Which port to bind to.").
+	bindPort = runCommand.Flag("bind-port", "Which port to bind to.").
 			Short('p').
 			Envar("MTG_PORT").
 			Default("3128").
 			Uint16()
-	portToShow = app.Flag("show-bind-port",
+	portToShow = runCommand.Flag("show-bind-port",
 		"Which port to show in URL. Default is the value of bind-port").
 		Short('a').
 		Envar("MTG_SHOW_PORT").
 		Uint16()
-	statsIP = app.Flag("stats-ip", "Which IP bind stats server to").
+	statsIP = runCommand.Flag("stats-ip", "Which IP bind stats server to").
 		Short('t').
 		Envar("MTG_STATS_IP").
 		Default("127.0.0.1").
 		IP()
-	statsPort = app.Flag("stats-port", "Which port bind stats to.").
+	statsPort = runCommand.Flag("stats-port", "Which port bind stats to.").
 			Short('q').
 			Envar("MTG_STATS_PORT").
 			Default("3129").
 			Uint16()
-	readTimeout = app.Flag("read-timeout", "Socket read timeout.").
+	statsToken = runCommand.Flag("stats-token",
+		"Bearer token required to access stats server.").
+		Envar("MTG_STATS_TOKEN").
+		String()
+	statsTokenFile = runCommand.Flag("stats-token-file",
+		"File with a bearer token required to access stats server.").
+		Envar("MTG_STATS_TOKEN_FILE").
+		ExistingFile()
+	statsBasicAuth = runCommand.Flag("stats-basic-auth",
+		"Credentials for basic auth on stats server in user:password form.").
+		Envar("MTG_STATS_BASIC_AUTH").
+		String()
+	statsTLSCert = runCommand.Flag("stats-tls-cert",
+		"Path to PEM certificate to serve stats over TLS.").
+		Envar("MTG_STATS_TLS_CERT").
+		ExistingFile()
+	statsTLSKey = runCommand.Flag("stats-tls-key",
+		"Path to PEM private key to serve stats over TLS.").
+		Envar("MTG_STATS_TLS_KEY").
+		ExistingFile()
+	readTimeout = runCommand.Flag("read-timeout", "Socket read timeout.").
 			Short('r').
 			Envar("MTG_READ_TIMEOUT").
 			Default("30s").
 			Duration()
-	writeTimeout = app.Flag("write-timeout", "Socket write timeout.").
+	writeTimeout = runCommand.Flag("write-timeout", "Socket write timeout.").
 			Short('w').
 			Envar("MTG_WRITE_TIMEOUT").
 			Default("30s").
 			Duration()
-	serverName = app.Flag("server-name",
+	listenBacklog = runCommand.Flag("listen-backlog",
+		"Size of accept queue of listen socket (Linux only). 0 keeps system default.").
+		Envar("MTG_LISTEN_BACKLOG").
+		Default("0").
+		Int()
+	timeoutPolicy = runCommand.Flag("timeout-policy",
+		"absolute: each read and write has to finish within timeout; idle: connection times out only without traffic in both directions.").
+		Envar("MTG_TIMEOUT_POLICY").
+		Default("idle").
+		Enum("absolute", "idle")
+	telegramDialTimeout = runCommand.Flag("telegram-dial-timeout",
+		"Timeout of establishing connection to Telegram.").
+		Envar("MTG_TELEGRAM_DIAL_TIMEOUT").
+		Default("10s").
+		Duration()
+	dcDialTimeouts = runCommand.Flag("dc-dial-timeout",
+		"Override dial timeout of a single DC, like 5=20s. Can be repeated.").
+		Envar("MTG_DC_DIAL_TIMEOUT").
+		Strings()
+	dcReadTimeouts = runCommand.Flag("dc-read-timeout",
+		"Override read timeout of connections to a single DC, like 5=1m. Can be repeated.").
+		Envar("MTG_DC_READ_TIMEOUT").
+		Strings()
+	clientReadBuffer = runCommand.Flag("client-read-buffer",
+		"Size of kernel receive buffer (SO_RCVBUF) of client sockets. 0 keeps system default.").
+		Envar("MTG_CLIENT_READ_BUFFER").
+		Default("0").
+		Bytes()
+	clientWriteBuffer = runCommand.Flag("client-write-buffer",
+		"Size of kernel send buffer (SO_SNDBUF) of client sockets. 0 keeps system default.").
+		Envar("MTG_CLIENT_WRITE_BUFFER").
+		Default("0").
+		Bytes()
+	telegramReadBuffer = runCommand.Flag("telegram-read-buffer",
+		"Size of kernel receive buffer (SO_RCVBUF) of Telegram sockets. 0 keeps system default.").
+		Envar("MTG_TELEGRAM_READ_BUFFER").
+		Default("0").
+		Bytes()
+	telegramWriteBuffer = runCommand.Flag("telegram-write-buffer",
+		"Size of kernel send buffer (SO_SNDBUF) of Telegram sockets. 0 keeps system default.").
+		Envar("MTG_TELEGRAM_WRITE_BUFFER").
+		Default("0").
+		Bytes()
+	fastOpen = runCommand.Flag("fast-open",
+		"Enable TCP Fast Open on listener and Telegram connections (Linux only).").
+		Envar("MTG_FAST_OPEN").
+		Bool()
+	multipathTCP = runCommand.Flag("mptcp",
+		"Use Multipath TCP for listener and Telegram connections if kernel supports it.").
+		Envar("MTG_MPTCP").
+		Bool()
+	abortiveClose = runCommand.Flag("abortive-close",
+		"When to close client connections with RST instead of FIN: never, misbehaving (failed handshake, slow client) or always.").
+		Envar("MTG_ABORTIVE_CLOSE").
+		Default("never").
+		Enum("never", "misbehaving", "always")
+	egressIPs = runCommand.Flag("egress-ip",
+		"Local address for Telegram connections. Can be repeated to use a pool of addresses.").
+		Envar("MTG_EGRESS_IP").
+		IPList()
+	egressStrategy = runCommand.Flag("egress-ip-strategy",
+		"How to choose egress IP from the pool: round-robin or client-hash (same client goes out from the same IP).").
+		Envar("MTG_EGRESS_IP_STRATEGY").
+		Default("round-robin").
+		Enum("round-robin", "client-hash")
+	egressPortRange = runCommand.Flag("egress-port-range",
+		"Range of local ports for Telegram connections, like 20000-60000 (Linux 6.3+).").
+		Envar("MTG_EGRESS_PORT_RANGE").
+		String()
+	dohURL = runCommand.Flag("doh-url",
+		"DNS-over-HTTPS server to resolve auxiliary hostnames with, like https://1.1.1.1/dns-query.").
+		Envar("MTG_DOH_URL").
+		String()
+	dnsServers = runCommand.Flag("dns-server",
+		"DNS server to use for proxy's own lookups instead of system ones, like 1.1.1.1 or 9.9.9.9:53. Can be repeated.").
+		Envar("MTG_DNS_SERVER").
+		Strings()
+	serverName = runCommand.Flag("server-name",
 		"Which server name to use. Default is IP address resolved by ipify.").
 		Short('s').
 		Envar("MTG_SERVER").
 		String()
-	preferIPv6 = app.Flag("prefer-ipv6", "Use IPv6").
+	defaultDC = runCommand.Flag("default-dc",
+		"Which DC to use for clients asking for unknown DC (e.g. CDN).").
+		Envar("MTG_DEFAULT_DC").
+		Default("2").
+		Int16()
+	dcAddrs = runCommand.Flag("dc-addr",
+		"Override address of a single DC, like 2=149.154.167.51:443. Can be repeated.").
+		Envar("MTG_DC_ADDR").
+		Strings()
+	dcTable = runCommand.Flag("dc-table",
+		"Cache file with DC addresses, written by update-dc-table. It is consulted before compiled-in addresses.").
+		Envar("MTG_DC_TABLE").
+		String()
+	dcTableURL = runCommand.Flag("dc-table-url",
+		"URL to refresh DC table cache file from in background. New addresses are used after restart.").
+		Envar("MTG_DC_TABLE_URL").
+		String()
+	dcTableRefresh = runCommand.Flag("dc-table-refresh",
+		"How often to refresh DC table cache file.").
+		Envar("MTG_DC_TABLE_REFRESH").
+		Default("24h").
+		Duration()
+	logSampleTick = runCommand.Flag("log-sample-tick",
+		"Interval within which repeated log messages are sampled.").
+		Envar("MTG_LOG_SAMPLE_TICK").
+		Default("1s").
+		Duration()
+	logSampleFirst = runCommand.Flag("log-sample-first",
+		"How many same messages to log within a tick before sampling. 0 disables sampling.").
+		Envar("MTG_LOG_SAMPLE_FIRST").
+		Default("100").
+		Uint64()
+	logSampleThereafter = runCommand.Flag("log-sample-thereafter",
+		"Log every Nth message after the first ones within a tick.").
+		Envar("MTG_LOG_SAMPLE_THEREAFTER").
+		Default("100").
+		Uint64()
+	relayBufferSize = runCommand.Flag("relay-buffer-size",
+		"Maximal amount of in-flight data per connection direction.").
+		Envar("MTG_RELAY_BUFFER_SIZE").
+		Default("32KB").
+		Bytes()
+	backpressureThreshold = runCommand.Flag("backpressure-threshold",
+		"Count a backpressure event if peer does not accept data for that long.").
+		Envar("MTG_BACKPRESSURE_THRESHOLD").
+		Default("1s").
+		Duration()
+	relayLinger = runCommand.Flag("relay-linger",
+		"How long to wait for another direction after one side has closed connection.").
+		Envar("MTG_RELAY_LINGER").
+		Default("5s").
+		Duration()
+	relayJitter = runCommand.Flag("relay-jitter",
+		"Delay writes to clients for a random time up to this value and coalesce them to blur packet timings. 0 disables jitter.").
+		Envar("MTG_RELAY_JITTER").
+		Duration()
+	telegramReconnects = runCommand.Flag("telegram-reconnects",
+		"How many times to restore broken Telegram connection during the session. Data which was in flight when connection has broken may be lost. 0 disables reconnects.").
+		Envar("MTG_TELEGRAM_RECONNECTS").
+		Default("0").
+		Uint()
+	retryAttempts = runCommand.Flag("retry-attempts",
+		"How many times to try to connect to Telegram or to fetch DC table. 1 means no retries.").
+		Envar("MTG_RETRY_ATTEMPTS").
+		Default("1").
+		Uint()
+	retryDelay = runCommand.Flag("retry-delay", "Delay before the first retry.").
+			Envar("MTG_RETRY_DELAY").
+			Default("200ms").
+			Duration()
+	retryMultiplier = runCommand.Flag("retry-multiplier", "Multiplier of delay for each next retry.").
+			Envar("MTG_RETRY_MULTIPLIER").
+			Default("2").
+			Float64()
+	retryJitter = runCommand.Flag("retry-jitter",
+		"Share of retry delay it is randomly changed by, from 0 to 1.").
+		Envar("MTG_RETRY_JITTER").
+		Default("0.2").
+		Float64()
+	clientKeepAlive = runCommand.Flag("client-keepalive",
+		"Idle time before TCP keepalive probes are sent to client. 0 disables keepalive.").
+		Envar("MTG_CLIENT_KEEPALIVE").
+		Default("30s").
+		Duration()
+	telegramKeepAlive = runCommand.Flag("telegram-keepalive",
+		"Idle time before TCP keepalive probes are sent to Telegram. 0 disables keepalive.").
+		Envar("MTG_TELEGRAM_KEEPALIVE").
+		Default("30s").
+		Duration()
+	keepAliveInterval = runCommand.Flag("keepalive-interval",
+		"Interval between TCP keepalive probes (Linux only).").
+		Envar("MTG_KEEPALIVE_INTERVAL").
+		Default("10s").
+		Duration()
+	keepAliveProbes = runCommand.Flag("keepalive-probes",
+		"How many unanswered TCP keepalive probes mean that peer is dead (Linux only).").
+		Envar("MTG_KEEPALIVE_PROBES").
+		Default("3").
+		Int()
+	relayEngine = runCommand.Flag("relay-engine",
+		"How to relay data: goroutines per connection, shared epoll loops or io_uring (Linux only).").
+		Envar("MTG_RELAY_ENGINE").
+		Default("goroutines").
+		Enum("goroutines", "epoll", "io_uring")
+	maxConnections = runCommand.Flag("max-connections",
+		"Maximal amount of concurrent client connections. 0 means no limit.").
+		Envar("MTG_MAX_CONNECTIONS").
+		Default("0").
+		Int()
+	maxSessionLifetime = runCommand.Flag("max-session-lifetime",
+		"Close client sessions after that time to make clients reconnect. 0 means no limit.").
+		Envar("MTG_MAX_SESSION_LIFETIME").
+		Default("0s").
+		Duration()
+	geoIPDB = runCommand.Flag("geoip-db",
+		"Path to GeoIP country database in MMDB format to collect statistics by client country.").
+		Envar("MTG_GEOIP_DB").
+		ExistingFile()
+	asnDB = runCommand.Flag("asn-db",
+		"Path to GeoIP ASN database in MMDB format to filter clients by autonomous system.").
+		Envar("MTG_ASN_DB").
+		ExistingFile()
+	allowASNs = runCommand.Flag("allow-asn",
+		"Accept clients only from this autonomous system. Can be repeated.").
+		Envar("MTG_ALLOW_ASN").
+		Uint32List()
+	denyASNs = runCommand.Flag("deny-asn",
+		"Reject clients from this autonomous system. Can be repeated.").
+		Envar("MTG_DENY_ASN").
+		Uint32List()
+	geoIPReload = runCommand.Flag("geoip-reload",
+		"How often to reload GeoIP databases. 0 disables reloading.").
+		Envar("MTG_GEOIP_RELOAD").
+		Default("24h").
+		Duration()
+	knockToken = runCommand.Flag("knock-token",
+		"Accept only clients which have knocked with this token by UDP packet or /knock?token= request to stats server.").
+		Envar("MTG_KNOCK_TOKEN").
+		String()
+	knockPort = runCommand.Flag("knock-port",
+		"UDP port on bind IP to receive knock packets. 0 disables UDP knocking.").
+		Envar("MTG_KNOCK_PORT").
+		Uint16()
+	knockPeriod = runCommand.Flag("knock-period",
+		"How long client may connect after it has knocked.").
+		Envar("MTG_KNOCK_PERIOD").
+		Default("10m").
+		Duration()
+	tarpitMax = runCommand.Flag("tarpit-max",
+		"Hold up to that many filtered connections open, reading them slowly, instead of closing. 0 disables tarpit.").
+		Envar("MTG_TARPIT_MAX").
+		Default("0").
+		Int()
+	tarpitDuration = runCommand.Flag("tarpit-duration",
+		"How long to hold filtered connection in tarpit.").
+		Envar("MTG_TARPIT_DURATION").
+		Default("5m").
+		Duration()
+	fingerprintLog = runCommand.Flag("fingerprint-log",
+		"File to write JSON fingerprints of clients which have failed handshake.").
+		Envar("MTG_FINGERPRINT_LOG").
+		String()
+	stateFile = runCommand.Flag("state-file",
+		"File to keep lifetime connection and traffic counters across restarts.").
+		Envar("MTG_STATE_FILE").
+		String()
+	dumpDir = runCommand.Flag("dump-dir",
+		"Directory to write diagnostic dumps to on SIGUSR1. Dumps go to stderr if not set.").
+		Envar("MTG_DUMP_DIR").
+		String()
+	eventBusURL = runCommand.Flag("event-bus",
+		"NATS or MQTT broker URL to publish session events to, like nats://127.0.0.1:4222/mtg.").
+		Envar("MTG_EVENT_BUS").
+		String()
+	metricsPushInterval = runCommand.Flag("metrics-push-interval",
+		"How often to push metrics to external monitoring systems.").
+		Envar("MTG_METRICS_PUSH_INTERVAL").
+		Default("10s").
+		Duration()
+	influxDBURL = runCommand.Flag("influxdb-url",
+		"InfluxDB write endpoint to push metrics to, like http://localhost:8086/write?db=mtg.").
+		Envar("MTG_INFLUXDB_URL").
+		String()
+	influxDBToken = runCommand.Flag("influxdb-token",
+		"InfluxDB 2.x API token.").
+		Envar("MTG_INFLUXDB_TOKEN").
+		String()
+	graphiteAddr = runCommand.Flag("graphite-addr",
+		"Graphite carbon plaintext receiver to push metrics to, like localhost:2003.").
+		Envar("MTG_GRAPHITE_ADDR").
+		String()
+	graphitePrefix = runCommand.Flag("graphite-prefix",
+		"Prefix of Graphite metric paths.").
+		Envar("MTG_GRAPHITE_PREFIX").
+		Default("mtg").
+		String()
+	pushgatewayURL = runCommand.Flag("pushgateway-url",
+		"Prometheus Pushgateway to push metrics to, like http://localhost:9091.").
+		Envar("MTG_PUSHGATEWAY_URL").
+		String()
+	pushgatewayJob = runCommand.Flag("pushgateway-job",
+		"Job label of metrics pushed to Pushgateway.").
+		Envar("MTG_PUSHGATEWAY_JOB").
+		Default("mtg").
+		String()
+	pushgatewayInstance = runCommand.Flag("pushgateway-instance",
+		"Instance label of metrics pushed to Pushgateway. Default is host name.").
+		Envar("MTG_PUSHGATEWAY_INSTANCE").
+		String()
+	drainPeriod = runCommand.Flag("drain-period",
+		"Default period to let existing connections finish on drain.").
+		Envar("MTG_DRAIN_PERIOD").
+		Default("5m").
+		Duration()
+	slowClientRate = runCommand.Flag("slow-client-rate",
+		"Evict clients which consume less bytes per second than that. 0 disables eviction.").
+		Envar("MTG_SLOW_CLIENT_RATE").
+		Default("0").
+		Bytes()
+	slowClientTimeout = runCommand.Flag("slow-client-timeout",
+		"How long client may stay below slow client rate before eviction.").
+		Envar("MTG_SLOW_CLIENT_TIMEOUT").
+		Default("1m").
+		Duration()
+	trafficQuota = runCommand.Flag("traffic-quota",
+		"Client traffic of the secret after which quota actions are taken. 0 means no quota.").
+		Envar("MTG_TRAFFIC_QUOTA").
+		Default("0").
+		Bytes()
+	quotaActions = runCommand.Flag("quota-action",
+		"What to do when traffic quota is exceeded: throttle, refuse new sessions or disconnect active ones. Can be repeated.").
+		Envar("MTG_QUOTA_ACTION").
+		Enums(proxy.QuotaActionThrottle, proxy.QuotaActionRefuse, proxy.QuotaActionDisconnect)
+	quotaThrottleRate = runCommand.Flag("quota-throttle-rate",
+		"Bytes per second each session is limited to after traffic quota is exceeded.").
+		Envar("MTG_QUOTA_THROTTLE_RATE").
+		Default("64KB").
+		Bytes()
+	quotaWebhook = runCommand.Flag("quota-webhook",
+		"URL to POST notification to when traffic quota is exceeded.").
+		Envar("MTG_QUOTA_WEBHOOK").
+		String()
+	webhookURLs = runCommand.Flag("webhook",
+		"URL to POST proxy events to, like start, stop or DC failures. Can be repeated.").
+		Envar("MTG_WEBHOOK").
+		Strings()
+	webhookEvents = runCommand.Flag("webhook-event",
+		"Event to send to webhooks. Can be repeated, all events are sent by default.").
+		Envar("MTG_WEBHOOK_EVENT").
+		Enums(proxy.Events...)
+	webhookTemplateFile = runCommand.Flag("webhook-template",
+		"File with Go template of webhook payload. Event is sent as JSON by default.").
+		Envar("MTG_WEBHOOK_TEMPLATE").
+		ExistingFile()
+	memoryLimit = runCommand.Flag("memory-limit",
+		"Soft memory limit of Go runtime, like GOMEMLIMIT. 0 means no limit.").
+		Envar("MTG_MEMORY_LIMIT").
+		Default("0").
+		Bytes()
+	dcProbeInterval = runCommand.Flag("dc-probe-interval",
+		"How often to check that each DC is reachable over IPv4 and IPv6, like 10m. Every check dials all DCs. 0 disables checks.").
+		Envar("MTG_DC_PROBE_INTERVAL").
+		Default("0").
+		Duration()
+	dcQuarantine = runCommand.Flag("dc-quarantine",
+		"How long to avoid Telegram address which keeps failing while others work. 0 disables quarantine.").
+		Envar("MTG_DC_QUARANTINE").
+		Default("1m").
+		Duration()
+	testDCs = runCommand.Flag("test-dcs",
+		"Use Telegram test environment datacenters.").
+		Envar("MTG_TEST_DCS").
+		Bool()
+	preferIPv6 = runCommand.Flag("prefer-ipv6", "Use IPv6").
 			Short('6').
 			Envar("MTG_USE_IPV6").
 			Bool()
+	ipv6Only = runCommand.Flag("ipv6-only",
+		"Connect to Telegram only with IPv6, never fall back to IPv4.").
+		Envar("MTG_IPV6_ONLY").
+		Bool()
+	clientIPv6Only = runCommand.Flag("client-ipv6-only",
+		"Accept clients only over IPv6 and announce IPv6 address. Requires global IPv6 address.").
+		Envar("MTG_CLIENT_IPV6_ONLY").
+		Bool()
+
+	eventBuffer = runCommand.Flag("event-buffer",
+		"How many last connects, disconnects, failures and rejections to keep in memory for /events endpoint of stats server. 0 disables it.").
+		Envar("MTG_EVENT_BUFFER").
+		Default("0").
+		Int()
+	logBuffer = runCommand.Flag("log-buffer",
+		"How many last log lines to keep in memory for /logs endpoint of stats server. 0 disables it.").
+		Envar("MTG_LOG_BUFFER").
+		Default("0").
+		Int()
+	eventLog = runCommand.Flag("eventlog",
+		"Also write warnings, errors, start and stop of proxy to Windows Event Log.").
+		Envar("MTG_EVENTLOG").
+		Bool()
+
+	secret = runCommand.Arg("secret", "Secret of this proxy.").
+		Envar("MTG_SECRET").
+		Required().
+		String()
+
+	selfUpdateCommand = app.Command("self-update",
+		"Update mtg binary to the latest release. Checksum comes from the same GitHub release, so it protects only from corrupted downloads, not from compromised release or repository.")
+	selfUpdateRepository = selfUpdateCommand.Flag("repository",
+		"GitHub repository to fetch releases from.").
+		Default("9seconds/mtg").
+		String()
+	selfUpdateForce = selfUpdateCommand.Flag("force",
+		"Update even if the latest release is already installed.").
+		Bool()
+
+	updateDCTableCommand = app.Command("update-dc-table",
+		"Fetch current DC addresses and write them to cache file.")
+	updateDCTablePath = updateDCTableCommand.Flag("dc-table", "Cache file to write.").
+				Envar("MTG_DC_TABLE").
+				Required().
+				String()
+	updateDCTableURL = updateDCTableCommand.Arg("url",
+		"URL of DC table in JSON format.").
+		Envar("MTG_DC_TABLE_URL").
+		Required().
+		String()
+
+	reportCommand = app.Command("report",
+		"Export traffic of secrets for a date range from state file.")
+	reportStateFile = reportCommand.Flag("state-file", "State file of proxy.").
+			Envar("MTG_STATE_FILE").
+			Required().
+			String()
+	reportFormat = reportCommand.Flag("format", "Output format.").
+			Default(reportFormatCSV).
+			Enum(reportFormatCSV, reportFormatJSON)
+	reportSince = reportCommand.Flag("since", "First day of the range, YYYY-MM-DD in UTC.").
+			Default("1970-01-01").
+			String()
+	reportUntil = reportCommand.Flag("until", "Last day of the range, YYYY-MM-DD in UTC. Today by default.").
+			String()
+
+	setupCommand = app.Command("init",
+		"Interactively create environment file with proxy configuration.")
+	setupFile = setupCommand.Arg("file", "Environment file to write.").
+			Default("mtg.env").
+			String()
+
+	benchCommand = app.Command("bench",
+		"Load test MTPROTO proxy with synthetic clients.")
+	benchClients = benchCommand.Flag("clients", "Number of concurrent clients.").
+			Short('c').
+			Default("10").
+			Int()
+	benchDuration = benchCommand.Flag("duration", "How long to run the test.").
+			Short('t').
+			Default("30s").
+			Duration()
+	benchDC = benchCommand.Flag("dc", "Telegram datacenter to use (1-5).").
+		Default("2").
+		Int16()
+	benchTimeout = benchCommand.Flag("timeout", "Network timeout.").
+			Default("10s").
+			Duration()
+	benchSeed = benchCommand.Flag("seed",
+		"Generate handshakes and requests from given seed to make runs repeatable. Never use it against production proxy.").
+		Int64()
+	benchURL = benchCommand.Arg("url",
+		"Proxy URL (tg://proxy?... or https://t.me/proxy?...).").
+		Required().
+		String()
+
+	pingCommand = app.Command("ping",
+		"Check that MTPROTO proxy accepts handshake and reaches Telegram.")
+	pingDC = pingCommand.Flag("dc", "Telegram datacenter to use (1-5).").
+		Default("2").
+		Int16()
+	pingTimeout = pingCommand.Flag("timeout", "Network timeout.").
+			Default("10s").
+			Duration()
+	pingURL = pingCommand.Arg("url",
+		"Proxy URL (tg://proxy?... or https://t.me/proxy?...).").
+		Required().
+		String()
 
-	secret = app.Arg("secret", "Secret of this proxy.").Required().String()
+	firewallCommand = app.Command("firewall",
+		"Print host firewall rules for proxy configuration.")
+	firewallFormat = firewallCommand.Flag("format", "Format of rules.").
+			Default(firewall.FormatNFTables).
+			Enum(firewall.FormatNFTables, firewall.FormatIPTables, firewall.FormatUFW)
+	firewallBindPort = firewallCommand.Flag("bind-port", "Which port proxy binds to.").
+				Short('p').
+				Envar("MTG_PORT").
+				Default("3128").
+				Uint16()
+	firewallStatsIP = firewallCommand.Flag("stats-ip", "Which IP stats server binds to.").
+			Short('t').
+			Envar("MTG_STATS_IP").
+			Default("127.0.0.1").
+			IP()
+	firewallStatsPort = firewallCommand.Flag("stats-port", "Which port stats server binds to.").
+				Short('q').
+				Envar("MTG_STATS_PORT").
+				Default("3129").
+				Uint16()
+	firewallStatsAllow = firewallCommand.Flag("stats-allow",
+		"Network which may access stats server. Everyone if not set.").
+		Strings()
+	firewallKnockPort = firewallCommand.Flag("knock-port",
+		"UDP port to receive knock packets. 0 disables UDP knocking.").
+		Envar("MTG_KNOCK_PORT").
+		Uint16()
+	firewallRateLimit = firewallCommand.Flag("rate-limit",
+		"How many new connections per minute single address may open. 0 means no limit.").
+		Uint()
+	firewallBanSet = firewallCommand.Flag("ban-set",
+		"Name of address set to drop, filled by external tools like fail2ban.").
+		String()
+
+	clientCommand = app.Command("client",
+		"Run local SOCKS5 server which tunnels Telegram through remote proxy.")
+	clientDebug = clientCommand.Flag("debug", "Run in debug mode.").
+			Short('d').
+			Bool()
+	clientVerbose = clientCommand.Flag("verbose", "Run in verbose mode.").
+			Short('v').
+			Bool()
+	clientBindIP = clientCommand.Flag("bind-ip", "Which IP to bind SOCKS5 server to.").
+			Short('i').
+			Default("127.0.0.1").
+			IP()
+	clientBindPort = clientCommand.Flag("bind-port", "Which port to bind SOCKS5 server to.").
+			Short('p').
+			Default("1080").
+			Uint16()
+	clientTimeout = clientCommand.Flag("timeout", "Network timeout.").
+			Default("30s").
+			Duration()
+	clientDefaultDC = clientCommand.Flag("default-dc",
+		"DC to use for Telegram addresses which are not known DC addresses.").
+		Default("2").
+		Int16()
+	clientURL = clientCommand.Arg("url",
+		"Proxy URL (tg://proxy?... or https://t.me/proxy?...).").
+		Required().
+		String()
 )
 
 func main() {
 	app.Version(version)
-	kingpin.MustParse(app.Parse(os.Args[1:]))
 
+	switch kingpin.MustParse(app.Parse(os.Args[1:])) {
+	case runCommand.FullCommand():
+		runProxy()
+	case selfUpdateCommand.FullCommand():
+		selfUpdate()
+	case updateDCTableCommand.FullCommand():
+		updateDCTable()
+	case reportCommand.FullCommand():
+		printReport()
+	case setupCommand.FullCommand():
+		runSetup()
+	case benchCommand.FullCommand():
+		bench()
+	case pingCommand.FullCommand():
+		ping()
+	case clientCommand.FullCommand():
+		runClient()
+	case firewallCommand.FullCommand():
+		printFirewall()
+	}
+}
+
+func runProxy() {
 	secretBytes, err := hex.DecodeString(*secret)
 	if err != nil {
 		usage("Secret has to be hexadecimal string.")
@@ -89,47 +672,408 @@ func main() {
 		*portToShow = *bindPort
 	}
 
-	if *serverName == "" {
-		resp, err := http.Get("https://api.ipify.org")
-		if err != nil || resp.StatusCode != http.StatusOK {
-			usage("Cannot get local IP address.")
+	if *statsTokenFile != "" {
+		tokenBytes, err := ioutil.ReadFile(*statsTokenFile)
+		if err != nil {
+			usage("Cannot read stats token file.")
+		}
+		*statsToken = strings.TrimSpace(string(tokenBytes))
+	}
+
+	dcCount := len(proxy.TelegramAddresses)
+	if *testDCs {
+		dcCount = len(proxy.TelegramTestAddresses)
+	}
+	if *defaultDC < 1 || int(*defaultDC) > dcCount {
+		usage("Default DC is out of range.")
+	}
+	if *dcTable != "" {
+		if err := applyDCTable(*dcTable); err != nil {
+			usage(err.Error())
+		}
+	}
+	if *dcTableURL != "" {
+		if *dcTable == "" {
+			usage("DC table URL requires DC table file.")
+		}
+		if *dcTableRefresh <= 0 {
+			usage("DC table refresh interval has to be positive.")
 		}
-		myIPBytes, err := ioutil.ReadAll(resp.Body)
-		resp.Body.Close() // nolint: errcheck
+	}
+	for _, value := range *dcAddrs {
+		chunks := strings.SplitN(value, "=", 2)
+		if len(chunks) != 2 {
+			usage("DC address has to be in dc=ip:port form.")
+		}
+		dc, err := strconv.ParseInt(chunks[0], 10, 16)
+		if err != nil {
+			usage("DC address has to be in dc=ip:port form.")
+		}
+		if err := proxy.SetTelegramAddress(int16(dc), chunks[1], *testDCs); err != nil {
+			usage(err.Error())
+		}
+	}
+
+	dcDialTimeoutsParsed, err := parseDCDurations(*dcDialTimeouts, *testDCs)
+	if err != nil {
+		usage("DC dial timeout: " + err.Error())
+	}
+	dcReadTimeoutsParsed, err := parseDCDurations(*dcReadTimeouts, *testDCs)
+	if err != nil {
+		usage("DC read timeout: " + err.Error())
+	}
+
+	if *retryAttempts < 1 {
+		usage("Retry attempts has to be positive.")
+	}
+	if *retryMultiplier < 1 {
+		usage("Retry multiplier cannot be less than 1.")
+	}
+	if *retryJitter < 0 || *retryJitter > 1 {
+		usage("Retry jitter has to be from 0 to 1.")
+	}
+
+	if *metricsPushInterval <= 0 {
+		usage("Metrics push interval has to be positive.")
+	}
+
+	if *logBuffer < 0 || *eventBuffer < 0 {
+		usage("Buffer size cannot be negative.")
+	}
+
+	if *quotaThrottleRate <= 0 {
+		usage("Quota throttle rate has to be positive.")
+	}
 
+	webhookTemplate := ""
+	if *webhookTemplateFile != "" {
+		templateBytes, err := ioutil.ReadFile(*webhookTemplateFile)
 		if err != nil {
+			usage("Cannot read webhook template.")
+		}
+		if _, err = proxy.ParseWebhookTemplate(string(templateBytes)); err != nil {
+			usage(err.Error())
+		}
+		webhookTemplate = string(templateBytes)
+	}
+
+	if *relayBufferSize <= 0 {
+		usage("Relay buffer size has to be positive.")
+	}
+
+	if (*statsTLSCert == "") != (*statsTLSKey == "") {
+		usage("Both stats TLS certificate and key have to be set.")
+	}
+
+	var egressPortFrom, egressPortTo uint16
+	if *egressPortRange != "" {
+		egressPortFrom, egressPortTo, err = parsePortRange(*egressPortRange)
+		if err != nil {
+			usage("Egress port range has to be in from-to form.")
+		}
+	}
+
+	if (len(*allowASNs) > 0 || len(*denyASNs) > 0) && *asnDB == "" {
+		usage("ASN filter requires ASN database.")
+	}
+
+	var statsUser, statsPassword string
+	if *statsBasicAuth != "" {
+		chunks := strings.SplitN(*statsBasicAuth, ":", 2)
+		if len(chunks) != 2 || chunks[0] == "" {
+			usage("Stats basic auth has to be in user:password form.")
+		}
+		statsUser, statsPassword = chunks[0], chunks[1]
+	}
+
+	if len(*dnsServers) > 0 {
+		resolver, err := dns.NewResolver(*dnsServers, dnsTimeout)
+		if err != nil {
+			usage(err.Error())
+		}
+		net.DefaultResolver = resolver
+	}
+
+	ipifyURL := ipifyURLv4
+	if *clientIPv6Only {
+		if bindIP.To4() != nil {
+			if !bindIP.IsUnspecified() {
+				usage("Bind IP has to be IPv6 address if clients are accepted only over IPv6.")
+			}
+			*bindIP = net.IPv6unspecified
+		}
+		if err := checkGlobalIPv6(); err != nil {
+			usage(err.Error())
+		}
+		ipifyURL = ipifyURLv6
+	}
+
+	if *serverName == "" {
+		httpClient := http.DefaultClient
+		if *dohURL != "" {
+			httpClient = doh.NewResolver(*dohURL, dohTimeout).HTTPClient(dohTimeout)
+		}
+		if *serverName, err = publicIP(httpClient, ipifyURL); err != nil {
 			usage("Cannot get local IP address.")
 		}
-		*serverName = strings.TrimSpace(string(myIPBytes))
 	}
 
+	conf := &config.Config{
+		Debug:          *debug,
+		Verbose:        *verbose,
+		BindIP:         *bindIP,
+		BindPort:       *bindPort,
+		PublicPort:     *portToShow,
+		ServerName:     *serverName,
+		StatsIP:        *statsIP,
+		StatsPort:      *statsPort,
+		StatsToken:     *statsToken,
+		StatsUser:      statsUser,
+		StatsPassword:  statsPassword,
+		StatsTLSCert:   *statsTLSCert,
+		StatsTLSKey:    *statsTLSKey,
+		ReadTimeout:    *readTimeout,
+		WriteTimeout:   *writeTimeout,
+		PreferIPv6:     *preferIPv6,
+		IPv6Only:       *ipv6Only,
+		ClientIPv6Only: *clientIPv6Only,
+		DefaultDC:      *defaultDC,
+		TestDCs:        *testDCs,
+
+		TelegramDialTimeout: *telegramDialTimeout,
+		DCDialTimeouts:      dcDialTimeoutsParsed,
+		DCReadTimeouts:      dcReadTimeoutsParsed,
+		TimeoutPolicy:       *timeoutPolicy,
+		ListenBacklog:       *listenBacklog,
+		ClientReadBuffer:    int(*clientReadBuffer),
+		ClientWriteBuffer:   int(*clientWriteBuffer),
+		TelegramReadBuffer:  int(*telegramReadBuffer),
+		TelegramWriteBuffer: int(*telegramWriteBuffer),
+		FastOpen:            *fastOpen,
+		MultipathTCP:        *multipathTCP,
+		AbortiveClose:       *abortiveClose,
+
+		EgressIPs:      *egressIPs,
+		EgressStrategy: *egressStrategy,
+		EgressPortFrom: egressPortFrom,
+		EgressPortTo:   egressPortTo,
+
+		RelayBufferSize:       int(*relayBufferSize),
+		BackpressureThreshold: *backpressureThreshold,
+		RelayLinger:           *relayLinger,
+		TelegramReconnects:    *telegramReconnects,
+		RelayJitter:           *relayJitter,
+		ClientKeepAlive:       *clientKeepAlive,
+		TelegramKeepAlive:     *telegramKeepAlive,
+		KeepAliveInterval:     *keepAliveInterval,
+		KeepAliveProbes:       *keepAliveProbes,
+		RelayEngine:           *relayEngine,
+		DrainPeriod:           *drainPeriod,
+		MaxConnections:        *maxConnections,
+		MaxSessionLifetime:    *maxSessionLifetime,
+		GeoIPDB:               *geoIPDB,
+		GeoIPReload:           *geoIPReload,
+		ASNDB:                 *asnDB,
+		AllowASNs:             *allowASNs,
+		DenyASNs:              *denyASNs,
+		KnockToken:            *knockToken,
+		KnockPort:             *knockPort,
+		KnockPeriod:           *knockPeriod,
+		TarpitMax:             *tarpitMax,
+		TarpitDuration:        *tarpitDuration,
+		FingerprintLog:        *fingerprintLog,
+		StateFile:             *stateFile,
+		DCProbeInterval:       *dcProbeInterval,
+		DCQuarantine:          *dcQuarantine,
+		TrafficQuota:          uint64(*trafficQuota),
+		QuotaActions:          *quotaActions,
+		QuotaThrottleRate:     int(*quotaThrottleRate),
+		QuotaWebhook:          *quotaWebhook,
+		Webhooks:              *webhookURLs,
+		WebhookEvents:         *webhookEvents,
+		WebhookTemplate:       webhookTemplate,
+		EventBuffer:           *eventBuffer,
+
+		SlowClientRate:    int(*slowClientRate),
+		SlowClientTimeout: *slowClientTimeout,
+		Secret:            secretBytes,
+
+		LogSampleTick:       *logSampleTick,
+		LogSampleFirst:      *logSampleFirst,
+		LogSampleThereafter: *logSampleThereafter,
+
+		Retry: retry.Policy{
+			Attempts:   *retryAttempts,
+			Delay:      *retryDelay,
+			Multiplier: *retryMultiplier,
+			Jitter:     *retryJitter,
+		},
+		Build: config.BuildInfo{
+			Version:   tag,
+			Commit:    commit,
+			BuildDate: buildDate,
+			GoVersion: runtime.Version(),
+		},
+	}
+
+	var events *logging.EventLog
+	if *eventLog {
+		if events, err = logging.OpenEventLog("mtg"); err != nil {
+			usage(err.Error())
+		}
+		defer events.Close() // nolint: errcheck
+	}
+
+	if conf.StatsTLSEnabled() {
+		if _, err := tls.LoadX509KeyPair(conf.StatsTLSCert, conf.StatsTLSKey); err != nil {
+			usage("Cannot load stats TLS certificate: " + err.Error())
+		}
+	}
+
+	stat := proxy.NewStats(conf)
+	var ring *logging.Ring
+	if *logBuffer > 0 {
+		ring = logging.NewRing(*logBuffer)
+		stat.Handle("/logs", ring.ServeHTTP)
+	}
+	logger := makeLogger(*debug, *verbose, func(core zapcore.Core) zapcore.Core {
+		if events != nil {
+			core = zapcore.NewTee(core, logging.NewEventLogCore(events, zapcore.WarnLevel))
+		}
+		if conf.LogSampleFirst > 0 {
+			core = logging.NewSamplingCore(core, conf.LogSampleTick,
+				conf.LogSampleFirst, conf.LogSampleThereafter, stat.AddSuppressedLog)
+		}
+		// ring keeps session lines regardless of verbosity, except
+		// debug ones which are too many
+		if ring != nil {
+			level := zapcore.InfoLevel
+			if *debug {
+				level = zapcore.DebugLevel
+			}
+			core = zapcore.NewTee(core, ring.Core(level))
+		}
+		return core
+	})
+
+	if conf.StateFile != "" {
+		if err := stat.LoadState(conf.StateFile); err != nil {
+			logger.Warnw("Cannot load state", "path", conf.StateFile, "error", err)
+		}
+	}
+
+	procs := limits.SetMaxProcs()
+	openFiles, err := limits.RaiseOpenFiles()
+	if err != nil {
+		logger.Warnw("Cannot raise open files limit", "error", err)
+	}
+	if openFiles > 0 && conf.MaxConnections > 0 && openFiles < limits.OpenFilesFor(conf.MaxConnections) {
+		logger.Warnw("Open files limit is too low for max connections",
+			"open_files", openFiles,
+			"max_connections", conf.MaxConnections,
+			"required", limits.OpenFilesFor(conf.MaxConnections),
+		)
+	}
+	if *memoryLimit > 0 {
+		if err := limits.SetMemoryLimit(int64(*memoryLimit)); err != nil {
+			logger.Warnw("Cannot set memory limit", "error", err)
+		}
+	}
+
+	// startup line is shown regardless of verbosity
+	banner := logger
+	if !*debug && !*verbose {
+		banner = makeLogger(false, true, nil)
+	}
+	banner.Infow("Starting mtg",
+		"version", conf.Build.Version,
+		"commit", conf.Build.Commit,
+		"build_date", conf.Build.BuildDate,
+		"go_version", conf.Build.GoVersion,
+		"features", conf.Features(),
+		"gomaxprocs", procs,
+		"open_files", openFiles,
+	)
+
+	go func() {
+		if err := stat.Serve(); err != nil {
+			logger.Errorw("Cannot serve stats", "addr", conf.StatsAddr(), "error", err)
+		}
+	}()
+	pushMetrics(conf, stat, logger)
+	if *dcTableURL != "" {
+		go refreshDCTable(*dcTableURL, *dcTable, *dcTableRefresh, conf.Retry, logger)
+	}
+	printJSON(stat.URLs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		cancel()
+	}()
+
+	if events != nil {
+		events.Report(zapcore.InfoLevel, "mtg "+tag+" is started") // nolint: errcheck
+	}
+
+	srv := proxy.NewServer(conf, logger, stat)
+	go dumpOnSignal(srv, *dumpDir, logger)
+	publishEvents(srv, conf, logger)
+	if err := srv.ServeContext(ctx); err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	if events != nil {
+		events.Report(zapcore.InfoLevel, "mtg is stopped") // nolint: errcheck
+	}
+}
+
+func makeLogger(debug, verbose bool, wrapCore func(zapcore.Core) zapcore.Core) *zap.SugaredLogger {
 	atom := zap.NewAtomicLevel()
-	if *debug {
+	if debug {
 		atom.SetLevel(zapcore.DebugLevel)
-	} else if *verbose {
+	} else if verbose {
 		atom.SetLevel(zapcore.InfoLevel)
 	} else {
 		atom.SetLevel(zapcore.ErrorLevel)
 	}
 	encoderCfg := zap.NewProductionEncoderConfig()
-	logger := zap.New(zapcore.NewCore(
+
+	core := zapcore.NewCore(
 		zapcore.NewJSONEncoder(encoderCfg),
 		zapcore.Lock(os.Stderr),
 		atom,
-	)).Sugar()
+	)
+	if wrapCore != nil {
+		core = wrapCore(core)
+	}
 
-	stat := proxy.NewStats(*serverName, *portToShow, *secret)
-	go stat.Serve(*statsIP, *statsPort)
-	printURLs(stat.URLs)
+	return zap.New(core).Sugar()
+}
 
-	srv := proxy.NewServer(*bindIP, int(*bindPort), secretBytes, logger,
-		*readTimeout, *writeTimeout, *preferIPv6, stat)
-	if err := srv.Serve(); err != nil {
-		logger.Fatal(err.Error())
+// publicIP asks ipify which IP address this host is seen from.
+func publicIP(httpClient *http.Client, ipifyURL string) (string, error) {
+	resp, err := httpClient.Get(ipifyURL)
+	if err != nil {
+		return "", err
 	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("Unexpected status %d", resp.StatusCode)
+	}
+	myIPBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(myIPBytes)), nil
 }
 
-func printURLs(data interface{}) {
+func printJSON(data interface{}) {
 	encoder := json.NewEncoder(os.Stdout)
 	encoder.SetEscapeHTML(false)
 	encoder.SetIndent("", "  ")
@@ -140,6 +1084,55 @@ func printURLs(data interface{}) {
 	}
 }
 
+// parseDCDurations parses values like 5=20s into durations keyed by DC
+// number.
+func parseDCDurations(values []string, test bool) (map[int16]time.Duration, error) {
+	addresses := proxy.TelegramAddresses
+	if test {
+		addresses = proxy.TelegramTestAddresses
+	}
+
+	durations := map[int16]time.Duration{}
+	for _, value := range values {
+		chunks := strings.SplitN(value, "=", 2)
+		if len(chunks) != 2 {
+			return nil, errors.Errorf("%s has to be in dc=duration form", value)
+		}
+		dc, err := strconv.ParseInt(chunks[0], 10, 16)
+		if err != nil || dc < 1 || int(dc) > len(addresses) {
+			return nil, errors.Errorf("DC %s is out of range", chunks[0])
+		}
+		duration, err := time.ParseDuration(chunks[1])
+		if err != nil || duration <= 0 {
+			return nil, errors.Errorf("%s is not a positive duration", chunks[1])
+		}
+		durations[int16(dc)] = duration
+	}
+
+	return durations, nil
+}
+
+func parsePortRange(value string) (uint16, uint16, error) {
+	chunks := strings.SplitN(value, "-", 2)
+	if len(chunks) != 2 {
+		return 0, 0, errors.New("Incorrect port range")
+	}
+
+	from, err := strconv.ParseUint(chunks[0], 10, 16)
+	if err != nil {
+		return 0, 0, errors.Annotate(err, "Incorrect first port")
+	}
+	to, err := strconv.ParseUint(chunks[1], 10, 16)
+	if err != nil {
+		return 0, 0, errors.Annotate(err, "Incorrect last port")
+	}
+	if from == 0 || from > to {
+		return 0, 0, errors.New("Incorrect port range")
+	}
+
+	return uint16(from), uint16(to), nil
+}
+
 func usage(msg string) {
 	io.WriteString(os.Stderr, msg+"\n") // nolint: errcheck
 	os.Exit(1)
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/9seconds/mtg/proxy"
+	"github.com/juju/errors"
+)
+
+var graphiteEscaper = strings.NewReplacer(".", "_", " ", "_", "/", "_")
+
+// Graphite sends metrics to Graphite carbon in plaintext protocol.
+// Metric paths are prefix.host.secret.name.
+type Graphite struct {
+	addr    string
+	prefix  string
+	timeout time.Duration
+}
+
+// Push sends all metrics over new TCP connection.
+func (g *Graphite) Push(metrics []proxy.Metric, tags map[string]string, now time.Time) error {
+	conn, err := net.DialTimeout("tcp", g.addr, g.timeout)
+	if err != nil {
+		return errors.Annotate(err, "Cannot connect to Graphite")
+	}
+	defer conn.Close() // nolint: errcheck
+
+	conn.SetWriteDeadline(time.Now().Add(g.timeout)) // nolint: errcheck
+	if _, err = conn.Write(g.makeLines(metrics, tags, now)); err != nil {
+		return errors.Annotate(err, "Cannot send metrics to Graphite")
+	}
+
+	return nil
+}
+
+func (g *Graphite) makeLines(metrics []proxy.Metric, tags map[string]string, now time.Time) []byte {
+	path := []string{}
+	if g.prefix != "" {
+		path = append(path, g.prefix)
+	}
+	for _, key := range []string{"host", "secret"} {
+		if value := tags[key]; value != "" {
+			path = append(path, graphiteEscaper.Replace(value))
+		}
+	}
+	prefix := strings.Join(path, ".")
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	buf := &bytes.Buffer{}
+	for _, metric := range metrics {
+		if prefix != "" {
+			buf.WriteString(prefix)
+			buf.WriteByte('.')
+		}
+		buf.WriteString(metric.Name)
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatUint(metric.Value, 10))
+		buf.WriteByte(' ')
+		buf.WriteString(timestamp)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes()
+}
+
+// NewGraphite creates Graphite sink which sends metrics to carbon
+// plaintext receiver at addr, usually on port 2003.
+func NewGraphite(addr, prefix string, timeout time.Duration) *Graphite {
+	return &Graphite{
+		addr:    addr,
+		prefix:  prefix,
+		timeout: timeout,
+	}
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphiteLines(t *testing.T) {
+	sink := NewGraphite("127.0.0.1:2003", "mtg", time.Second)
+	lines := sink.makeLines(testMetrics,
+		map[string]string{"host": "proxy.example.com", "secret": "abcd"},
+		time.Unix(100, 0))
+
+	assert.Equal(t,
+		"mtg.proxy_example_com.abcd.connections_all 10 100\n"+
+			"mtg.proxy_example_com.abcd.traffic_incoming 2048 100\n",
+		string(lines))
+}
+
+func TestGraphitePush(t *testing.T) {
+	lsock, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lsock.Close() // nolint: errcheck
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := lsock.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close() // nolint: errcheck
+		content, _ := ioutil.ReadAll(conn)
+		received <- string(content)
+	}()
+
+	sink := NewGraphite(lsock.Addr().String(), "", time.Second)
+	assert.Nil(t, sink.Push(testMetrics, nil, time.Unix(100, 0)))
+
+	select {
+	case content := <-received:
+		assert.Equal(t, "connections_all 10 100\ntraffic_incoming 2048 100\n", content)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Metrics are not received")
+	}
+}
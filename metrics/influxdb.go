@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/9seconds/mtg/proxy"
+	"github.com/juju/errors"
+)
+
+const influxDBMeasurement = "mtg"
+
+var influxDBEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// InfluxDB writes metrics to InfluxDB in line protocol. URL is a full
+// write endpoint: http://host:8086/write?db=mtg for InfluxDB 1.x or
+// http://host:8086/api/v2/write?org=org&bucket=mtg for 2.x.
+type InfluxDB struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// Push writes all metrics as fields of a single point.
+func (i *InfluxDB) Push(metrics []proxy.Metric, tags map[string]string, now time.Time) error {
+	req, err := http.NewRequest("POST", i.url, bytes.NewReader(makeInfluxDBLine(metrics, tags, now)))
+	if err != nil {
+		return errors.Annotate(err, "Cannot create InfluxDB request")
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if i.token != "" {
+		req.Header.Set("Authorization", "Token "+i.token)
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return errors.Annotate(err, "Cannot send metrics to InfluxDB")
+	}
+	resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("InfluxDB has responded with %s", resp.Status)
+	}
+
+	return nil
+}
+
+func makeInfluxDBLine(metrics []proxy.Metric, tags map[string]string, now time.Time) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(influxDBMeasurement)
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if tags[key] == "" {
+			continue
+		}
+		buf.WriteByte(',')
+		buf.WriteString(influxDBEscaper.Replace(key))
+		buf.WriteByte('=')
+		buf.WriteString(influxDBEscaper.Replace(tags[key]))
+	}
+
+	for idx, metric := range metrics {
+		if idx == 0 {
+			buf.WriteByte(' ')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(metric.Name)
+		buf.WriteByte('=')
+		buf.WriteString(strconv.FormatUint(metric.Value, 10))
+		buf.WriteByte('i')
+	}
+
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(now.UnixNano(), 10))
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+}
+
+// NewInfluxDB creates InfluxDB sink. Token is required by InfluxDB 2.x,
+// InfluxDB 1.x credentials may be passed in URL as u and p parameters.
+func NewInfluxDB(url, token string, timeout time.Duration) *InfluxDB {
+	return &InfluxDB{
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: timeout},
+	}
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMetrics = []proxy.Metric{
+	{Name: "connections_all", Value: 10},
+	{Name: "traffic_incoming", Value: 2048},
+}
+
+func TestMakeInfluxDBLine(t *testing.T) {
+	line := makeInfluxDBLine(testMetrics,
+		map[string]string{"secret": "abcd", "host": "my host,1", "empty": ""},
+		time.Unix(10, 5))
+
+	assert.Equal(t,
+		`mtg,host=my\ host\,1,secret=abcd connections_all=10i,traffic_incoming=2048i 10000000005`+"\n",
+		string(line))
+}
+
+func TestInfluxDBPush(t *testing.T) {
+	var body, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := ioutil.ReadAll(r.Body)
+		body = string(content)
+		auth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := NewInfluxDB(server.URL+"/api/v2/write?org=org&bucket=mtg", "token", time.Second)
+	assert.Nil(t, sink.Push(testMetrics, map[string]string{"host": "a"}, time.Unix(1, 0)))
+	assert.Equal(t, "mtg,host=a connections_all=10i,traffic_incoming=2048i 1000000000\n", body)
+	assert.Equal(t, "Token token", auth)
+}
+
+func TestInfluxDBPushError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sink := NewInfluxDB(server.URL+"/write?db=mtg", "", time.Second)
+	assert.NotNil(t, sink.Push(testMetrics, nil, time.Now()))
+}
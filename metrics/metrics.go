@@ -0,0 +1,28 @@
+// Package metrics pushes proxy statistics to external monitoring
+// systems.
+package metrics
+
+import (
+	"time"
+
+	"github.com/9seconds/mtg/proxy"
+)
+
+// Sink receives proxy metrics. Tags describe the proxy instance, like
+// host and secret.
+type Sink interface {
+	Push(metrics []proxy.Metric, tags map[string]string, now time.Time) error
+}
+
+// Push periodically sends metrics of the proxy to the sink. It never
+// returns, errors are logged.
+func Push(sink Sink, stat *proxy.Stats, tags map[string]string, interval time.Duration, logger proxy.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := sink.Push(stat.Metrics(), tags, now); err != nil {
+			logger.Warnw("Cannot push metrics", "error", err)
+		}
+	}
+}
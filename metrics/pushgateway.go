@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/9seconds/mtg/proxy"
+	"github.com/juju/errors"
+)
+
+const pushgatewayMetricPrefix = "mtg_"
+
+var pushgatewayEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Pushgateway pushes metrics to Prometheus Pushgateway. It is useful
+// if proxy cannot be scraped, like behind NAT.
+type Pushgateway struct {
+	url    string
+	client *http.Client
+}
+
+// Push replaces metrics of the proxy group in Pushgateway. Tags are
+// added as labels to every metric except host: proxy is identified by
+// instance label of the group.
+func (p *Pushgateway) Push(metrics []proxy.Metric, tags map[string]string, now time.Time) error {
+	req, err := http.NewRequest("PUT", p.url, bytes.NewReader(makePushgatewayBody(metrics, tags)))
+	if err != nil {
+		return errors.Annotate(err, "Cannot create Pushgateway request")
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return errors.Annotate(err, "Cannot send metrics to Pushgateway")
+	}
+	resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("Pushgateway has responded with %s", resp.Status)
+	}
+
+	return nil
+}
+
+func makePushgatewayBody(metrics []proxy.Metric, tags map[string]string) []byte {
+	keys := []string{}
+	for key, value := range tags {
+		if key != "host" && value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	labels := make([]string, len(keys))
+	for idx, key := range keys {
+		labels[idx] = fmt.Sprintf(`%s="%s"`, key, pushgatewayEscaper.Replace(tags[key]))
+	}
+	labelSet := ""
+	if len(labels) > 0 {
+		labelSet = "{" + strings.Join(labels, ",") + "}"
+	}
+
+	buf := &bytes.Buffer{}
+	for _, metric := range metrics {
+		name := pushgatewayMetricPrefix + metric.Name
+		kind := "counter"
+		if metric.Gauge {
+			kind = "gauge"
+		}
+		fmt.Fprintf(buf, "# TYPE %s %s\n%s%s %d\n", name, kind, name, labelSet, metric.Value)
+	}
+
+	return buf.Bytes()
+}
+
+// NewPushgateway creates Pushgateway sink. Metrics are pushed to the
+// group with given job and instance labels.
+func NewPushgateway(baseURL, job, instance string, timeout time.Duration) *Pushgateway {
+	path := "/metrics/job/" + url.PathEscape(job)
+	if instance != "" {
+		path += "/instance/" + url.PathEscape(instance)
+	}
+
+	return &Pushgateway{
+		url:    strings.TrimSuffix(baseURL, "/") + path,
+		client: &http.Client{Timeout: timeout},
+	}
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushgatewayBody(t *testing.T) {
+	metrics := append([]proxy.Metric{{Name: "connections_active", Value: 3, Gauge: true}}, testMetrics...)
+	body := makePushgatewayBody(metrics, map[string]string{"host": "a", "secret": `ab"cd`})
+
+	assert.Equal(t,
+		"# TYPE mtg_connections_active gauge\n"+
+			"mtg_connections_active{secret=\"ab\\\"cd\"} 3\n"+
+			"# TYPE mtg_connections_all counter\n"+
+			"mtg_connections_all{secret=\"ab\\\"cd\"} 10\n"+
+			"# TYPE mtg_traffic_incoming counter\n"+
+			"mtg_traffic_incoming{secret=\"ab\\\"cd\"} 2048\n",
+		string(body))
+}
+
+func TestPushgatewayPush(t *testing.T) {
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := ioutil.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.EscapedPath(), string(content)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sink := NewPushgateway(server.URL+"/", "mtg", "proxy 1", time.Second)
+	assert.Nil(t, sink.Push(testMetrics, nil, time.Now()))
+	assert.Equal(t, "PUT", method)
+	assert.Equal(t, "/metrics/job/mtg/instance/proxy%201", path)
+	assert.Contains(t, body, "mtg_connections_all 10\n")
+}
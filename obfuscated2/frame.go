@@ -2,10 +2,10 @@ package obfuscated2
 
 import (
 	"bytes"
-	"crypto/rand"
 	"encoding/binary"
 	"io"
 
+	"github.com/9seconds/mtg/random"
 	"github.com/juju/errors"
 )
 
@@ -29,6 +29,13 @@ const (
 
 var tgMagicBytes = []byte{tgMagicByte, tgMagicByte, tgMagicByte, tgMagicByte}
 
+// Magic bytes of other MTPROTO transports: intermediate and padded
+// intermediate. Proxy does not support them.
+var otherMagicBytes = [][]byte{
+	{0xee, 0xee, 0xee, 0xee},
+	{0xdd, 0xdd, 0xdd, 0xdd},
+}
+
 // Frame represents handshake frame. Telegram sends 64 bytes of obfuscated2
 // initialization data first.
 // https://blog.susanka.eu/how-telegram-obfuscates-its-mtproto-traffic/
@@ -51,13 +58,21 @@ func (f Frame) Magic() []byte {
 	return f[frameOffsetIV:frameOffsetMagic]
 }
 
-// DC returns number of datacenter IP client wants to use.
-func (f Frame) DC() (n int16) {
+// RawDC returns datacenter number as it is set by client. Numbers are
+// 1-based, negative numbers are used for media datacenters.
+func (f Frame) RawDC() (n int16) {
 	buf := bytes.NewReader(f[frameOffsetMagic:frameOffsetDC])
 	if err := binary.Read(buf, binary.LittleEndian, &n); err != nil {
 		n = 1
 	}
 
+	return n
+}
+
+// DC returns 0-based index of datacenter IP client wants to use.
+func (f Frame) DC() int16 {
+	n := f.RawDC()
+
 	if n < 0 {
 		n = -n
 	} else if n == 0 {
@@ -72,6 +87,19 @@ func (f Frame) Valid() bool {
 	return bytes.Equal(f.Magic(), tgMagicBytes)
 }
 
+// OtherTransport checks that *decrypted* frame has magic bytes of
+// MTPROTO transport other than abridged. It means that secret is
+// correct but client has chosen unsupported transport.
+func (f Frame) OtherTransport() bool {
+	for _, magic := range otherMagicBytes {
+		if bytes.Equal(f.Magic(), magic) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Invert inverts frame for extracting encryption keys. Pkease check that link:
 // https://blog.susanka.eu/how-telegram-obfuscates-its-mtproto-traffic/
 func (f Frame) Invert() Frame {
@@ -86,20 +114,23 @@ func (f Frame) Invert() Frame {
 }
 
 // ExtractFrame extracts exact obfuscated2 handshake frame from given reader.
+// On error, returned frame contains bytes read before the failure.
 func ExtractFrame(conn io.Reader) (Frame, error) {
 	buf := &bytes.Buffer{}
 	if _, err := io.CopyN(buf, conn, FrameLen); err != nil {
-		return nil, errors.Annotate(err, "Cannot extract obfuscated header")
+		return Frame(buf.Bytes()), errors.Annotate(err, "Cannot extract obfuscated header")
 	}
 
 	return Frame(buf.Bytes()), nil
 }
 
-func generateFrame() Frame {
+// generateFrame makes random frame from source. nil source means
+// crypto/rand.
+func generateFrame(source io.Reader) Frame {
 	data := make(Frame, FrameLen)
 
 	for {
-		if _, err := rand.Read(data); err != nil {
+		if _, err := random.ReadFrom(source, data); err != nil {
 			continue
 		}
 		if data[0] == 0xef {
@@ -3,6 +3,7 @@ package obfuscated2
 import (
 	"testing"
 
+	"github.com/9seconds/mtg/random"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -37,6 +38,16 @@ func TestFrameDC(t *testing.T) {
 	assert.Equal(t, int16(770), makeFrame().DC())
 }
 
+func TestFrameRawDC(t *testing.T) {
+	frame := makeFrame()
+	assert.Equal(t, int16(771), frame.RawDC())
+
+	frame[8+32+16+4] = 0xfe
+	frame[8+32+16+5] = 0xff
+	assert.Equal(t, int16(-2), frame.RawDC())
+	assert.Equal(t, int16(1), frame.DC())
+}
+
 func TestFrameValid(t *testing.T) {
 	frame := makeFrame()
 	assert.True(t, frame.Valid())
@@ -45,6 +56,15 @@ func TestFrameValid(t *testing.T) {
 	assert.False(t, frame.Valid())
 }
 
+func TestFrameOtherTransport(t *testing.T) {
+	frame := makeFrame()
+	assert.False(t, frame.OtherTransport())
+
+	copy(frame.Magic(), []byte{0xdd, 0xdd, 0xdd, 0xdd})
+	assert.True(t, frame.OtherTransport())
+	assert.False(t, frame.Valid())
+}
+
 func TestFrameDoubleInvert(t *testing.T) {
 	frame := makeFrame()
 	assert.Equal(t, frame, frame.Invert().Invert())
@@ -65,7 +85,7 @@ func TestFrameInvert(t *testing.T) {
 }
 
 func TestFrameGenerateValid(t *testing.T) {
-	assert.True(t, generateFrame().Valid())
+	assert.True(t, generateFrame(nil).Valid())
 }
 
 func makeFrame() Frame {
@@ -86,3 +106,12 @@ func makeFrame() Frame {
 
 	return f
 }
+
+func TestGenerateFrameDeterministic(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	_, first := MakeClientObfuscated2FrameFrom(random.NewDeterministicSource(1), secret, 2)
+	_, second := MakeClientObfuscated2FrameFrom(random.NewDeterministicSource(1), secret, 2)
+	assert.Equal(t, first, second)
+
+	assert.NotEqual(t, generateFrame(nil), generateFrame(nil))
+}
@@ -0,0 +1,49 @@
+//go:build go1.18
+// +build go1.18
+
+package obfuscated2
+
+import "testing"
+
+func checkParseError(t *testing.T, err error, allowed ...error) {
+	if err == nil {
+		return
+	}
+	for _, known := range allowed {
+		if err == known {
+			return
+		}
+	}
+	t.Fatalf("Unexpected error %v", err)
+}
+
+func FuzzParseObfuscated2ClientFrame(f *testing.F) {
+	secret := []byte{1, 2, 3, 4, 5}
+	_, frame := MakeClientObfuscated2Frame(secret, 2)
+	f.Add(secret, []byte(frame))
+	f.Add(secret, []byte(frame[:FrameLen-1]))
+	f.Add([]byte{}, []byte{})
+
+	f.Fuzz(func(t *testing.T, secret, data []byte) {
+		obfs, _, err := ParseObfuscated2ClientFrame(secret, data)
+		checkParseError(t, err, ErrShortFrame, ErrUnknownProtocol, ErrUnsupportedTransport)
+		if err == nil && obfs == nil {
+			t.Fatal("No ciphers for valid frame")
+		}
+	})
+}
+
+func FuzzParseObfuscated2TelegramFrame(f *testing.F) {
+	_, frame := MakeTelegramObfuscated2Frame()
+	f.Add([]byte(frame))
+	f.Add(append([]byte(frame), 1, 2, 3))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		obfs, dc, err := ParseObfuscated2TelegramFrame(data)
+		checkParseError(t, err, ErrShortFrame, ErrUnknownProtocol)
+		if err == nil && (obfs == nil || dc < 0) {
+			t.Fatalf("Incorrect result for valid frame: %v, %d", obfs, dc)
+		}
+	})
+}
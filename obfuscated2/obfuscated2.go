@@ -4,10 +4,35 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/sha256"
+	"encoding/binary"
+	"io"
 
 	"github.com/juju/errors"
 )
 
+// Errors of handshake frame parsing.
+var (
+	// ErrUnknownProtocol means that frame cannot be decrypted, usually
+	// because secret is wrong.
+	ErrUnknownProtocol = errors.New("Unknown protocol")
+	// ErrUnsupportedTransport means that frame is decrypted but client
+	// has chosen unsupported transport.
+	ErrUnsupportedTransport = errors.New("Unsupported transport")
+	// ErrShortFrame means that there is less data than handshake frame
+	// requires.
+	ErrShortFrame = errors.New("Frame is too short")
+)
+
+// frameFromData checks length of handshake data. Everything after
+// FrameLen bytes is not a part of frame.
+func frameFromData(data []byte) (Frame, error) {
+	if len(data) < FrameLen {
+		return nil, ErrShortFrame
+	}
+
+	return Frame(data[:FrameLen]), nil
+}
+
 // Obfuscated2 contains AES CTR encryption and decryption streams
 // for telegram connection.
 type Obfuscated2 struct {
@@ -32,9 +57,16 @@ func (o *Obfuscated2) Decrypt(data []byte) []byte {
 // ParseObfuscated2ClientFrame parses client frame. Please check this link for
 // details: http://telegra.ph/telegram-blocks-wtf-05-26
 //
+// Returned DC is a raw datacenter number client has asked for (see
+// Frame.RawDC). Errors are ErrShortFrame, ErrUnknownProtocol or
+// ErrUnsupportedTransport.
+//
 // Beware, link above is in russian.
 func ParseObfuscated2ClientFrame(secret, data []byte) (*Obfuscated2, int16, error) {
-	frame := Frame(data)
+	frame, err := frameFromData(data)
+	if err != nil {
+		return nil, 0, err
+	}
 
 	decHasher := sha256.New()
 	decHasher.Write(frame.Key()) // nolint: errcheck
@@ -49,8 +81,11 @@ func ParseObfuscated2ClientFrame(secret, data []byte) (*Obfuscated2, int16, erro
 
 	decryptedFrame := make(Frame, FrameLen)
 	decryptor.XORKeyStream(decryptedFrame, frame)
-	if !decryptedFrame.Valid() {
-		return nil, 0, errors.New("Unknown protocol")
+	switch {
+	case decryptedFrame.OtherTransport():
+		return nil, 0, ErrUnsupportedTransport
+	case !decryptedFrame.Valid():
+		return nil, 0, ErrUnknownProtocol
 	}
 
 	obfs := &Obfuscated2{
@@ -58,14 +93,14 @@ func ParseObfuscated2ClientFrame(secret, data []byte) (*Obfuscated2, int16, erro
 		encryptor: encryptor,
 	}
 
-	return obfs, decryptedFrame.DC(), nil
+	return obfs, decryptedFrame.RawDC(), nil
 }
 
 // MakeTelegramObfuscated2Frame creates new handshake frame to send to
 // Telegram.
 // https://blog.susanka.eu/how-telegram-obfuscates-its-mtproto-traffic/
 func MakeTelegramObfuscated2Frame() (*Obfuscated2, Frame) {
-	frame := generateFrame()
+	frame := generateFrame(nil)
 
 	encryptor := makeStreamCipher(frame.Key(), frame.IV())
 	decryptorFrame := frame.Invert()
@@ -84,6 +119,73 @@ func MakeTelegramObfuscated2Frame() (*Obfuscated2, Frame) {
 	return obfs, frame
 }
 
+// ParseObfuscated2TelegramFrame parses handshake frame the way Telegram
+// does: without any secret. This is a mirror of
+// MakeTelegramObfuscated2Frame and is useful to terminate obfuscated
+// connections of Telegram clients which talk to Telegram directly.
+// Errors are ErrShortFrame or ErrUnknownProtocol.
+func ParseObfuscated2TelegramFrame(data []byte) (*Obfuscated2, int16, error) {
+	frame, err := frameFromData(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	decryptor := makeStreamCipher(frame.Key(), frame.IV())
+	invertedFrame := frame.Invert()
+	encryptor := makeStreamCipher(invertedFrame.Key(), invertedFrame.IV())
+
+	decryptedFrame := make(Frame, FrameLen)
+	decryptor.XORKeyStream(decryptedFrame, frame)
+	if !decryptedFrame.Valid() {
+		return nil, 0, ErrUnknownProtocol
+	}
+
+	obfs := &Obfuscated2{
+		decryptor: decryptor,
+		encryptor: encryptor,
+	}
+
+	return obfs, decryptedFrame.DC(), nil
+}
+
+// MakeClientObfuscated2Frame creates new handshake frame to send to MTPROTO
+// proxy as a client. dc is a raw datacenter number client wants to connect
+// to. This is a mirror of ParseObfuscated2ClientFrame.
+func MakeClientObfuscated2Frame(secret []byte, dc int16) (*Obfuscated2, Frame) {
+	return MakeClientObfuscated2FrameFrom(nil, secret, dc)
+}
+
+// MakeClientObfuscated2FrameFrom is MakeClientObfuscated2Frame which
+// generates frame from given source of randomness. nil source means
+// crypto/rand.
+func MakeClientObfuscated2FrameFrom(source io.Reader, secret []byte, dc int16) (*Obfuscated2, Frame) {
+	frame := generateFrame(source)
+	binary.LittleEndian.PutUint16(frame[frameOffsetMagic:frameOffsetDC], uint16(dc))
+
+	encHasher := sha256.New()
+	encHasher.Write(frame.Key()) // nolint: errcheck
+	encHasher.Write(secret)      // nolint: errcheck
+	encryptor := makeStreamCipher(encHasher.Sum(nil), frame.IV())
+
+	invertedFrame := frame.Invert()
+	decHasher := sha256.New()
+	decHasher.Write(invertedFrame.Key()) // nolint: errcheck
+	decHasher.Write(secret)              // nolint: errcheck
+	decryptor := makeStreamCipher(decHasher.Sum(nil), invertedFrame.IV())
+
+	copyFrame := make(Frame, frameOffsetIV)
+	copy(copyFrame, frame)
+	encryptor.XORKeyStream(frame, frame)
+	copy(frame, copyFrame)
+
+	obfs := &Obfuscated2{
+		decryptor: decryptor,
+		encryptor: encryptor,
+	}
+
+	return obfs, frame
+}
+
 func makeStreamCipher(key, iv []byte) cipher.Stream {
 	block, _ := aes.NewCipher(key)
 	return cipher.NewCTR(block, iv)
@@ -33,7 +33,7 @@ func TestObfs2TelegramDecryptEncryptDecrypt(t *testing.T) {
 func TestObfs2Full(t *testing.T) {
 	secret := []byte{1, 2, 3, 4, 5}
 
-	clientFrame := generateFrame()
+	clientFrame := generateFrame(nil)
 	clientHasher := sha256.New()
 	clientHasher.Write(clientFrame.Key())
 	clientHasher.Write(secret)
@@ -76,3 +76,46 @@ func TestObfs2Full(t *testing.T) {
 
 	assert.Equal(t, finalMessage, message)
 }
+
+func TestObfs2ClientFrame(t *testing.T) {
+	secret := []byte{1, 2, 3, 4, 5}
+
+	clientObfs, frame := MakeClientObfuscated2Frame(secret, -2)
+	serverObfs, dc, err := ParseObfuscated2ClientFrame(secret, frame)
+	assert.Nil(t, err)
+	assert.Equal(t, int16(-2), dc)
+
+	message := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	assert.Equal(t, message, serverObfs.Decrypt(clientObfs.Encrypt(message)))
+	assert.Equal(t, message, clientObfs.Decrypt(serverObfs.Encrypt(message)))
+}
+
+func TestObfs2ClientFrameErrors(t *testing.T) {
+	secret := []byte{1, 2, 3, 4, 5}
+
+	_, frame := MakeClientObfuscated2Frame(secret, 2)
+	_, _, err := ParseObfuscated2ClientFrame([]byte{5, 4, 3, 2, 1}, frame)
+	assert.Equal(t, ErrUnknownProtocol, err)
+
+	// 0xef ^ 0x01 is 0xee, magic of intermediate transport.
+	for i := frameOffsetIV; i < frameOffsetMagic; i++ {
+		frame[i] ^= 0x01
+	}
+	_, _, err = ParseObfuscated2ClientFrame(secret, frame)
+	assert.Equal(t, ErrUnsupportedTransport, err)
+
+	_, _, err = ParseObfuscated2ClientFrame(secret, frame[:FrameLen-1])
+	assert.Equal(t, ErrShortFrame, err)
+	_, _, err = ParseObfuscated2TelegramFrame(nil)
+	assert.Equal(t, ErrShortFrame, err)
+}
+
+func TestObfs2ParseTelegramFrame(t *testing.T) {
+	tgObfs, frame := MakeTelegramObfuscated2Frame()
+	clientObfs, _, err := ParseObfuscated2TelegramFrame(frame)
+	assert.Nil(t, err)
+
+	message := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	assert.Equal(t, message, clientObfs.Decrypt(tgObfs.Encrypt(message)))
+	assert.Equal(t, message, tgObfs.Decrypt(clientObfs.Encrypt(message)))
+}
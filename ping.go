@@ -0,0 +1,55 @@
+package main
+
+import (
+	"time"
+
+	"github.com/9seconds/mtg/client"
+)
+
+type pingReport struct {
+	Addr      string `json:"addr"`
+	DC        int16  `json:"dc"`
+	Connect   string `json:"connect"`
+	RoundTrip string `json:"round_trip"`
+}
+
+// ping performs obfuscated2 handshake with proxy and a single request to
+// Telegram through it. Failure is reported with non-zero exit code.
+func ping() {
+	proxyURL, err := client.ParseProxyURL(*pingURL)
+	if err != nil {
+		usage(err.Error())
+	}
+	if *pingDC < 1 || *pingDC > 5 {
+		usage("DC has to be in 1-5 range.")
+	}
+
+	report, err := runPing(proxyURL, *pingDC, *pingTimeout)
+	if err != nil {
+		usage(err.Error())
+	}
+	printJSON(report)
+}
+
+// runPing connects to proxy and measures connect and round trip times.
+func runPing(proxyURL *client.ProxyURL, dc int16, timeout time.Duration) (*pingReport, error) {
+	started := time.Now()
+	conn, err := client.Dial(proxyURL.Addr(), proxyURL.Secret, dc, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close() // nolint: errcheck
+	connected := time.Now()
+
+	conn.SetDeadline(connected.Add(timeout)) // nolint: errcheck, gas
+	if _, err := client.RequestPQ(conn); err != nil {
+		return nil, err
+	}
+
+	return &pingReport{
+		Addr:      proxyURL.Addr(),
+		DC:        dc,
+		Connect:   connected.Sub(started).String(),
+		RoundTrip: time.Since(connected).String(),
+	}, nil
+}
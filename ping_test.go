@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/client"
+	"github.com/9seconds/mtg/obfuscated2"
+	"github.com/stretchr/testify/assert"
+)
+
+// servePing accepts a single connection and answers req_pq_multi like
+// Telegram does. If answer is false, connection is closed instead.
+func servePing(t *testing.T, secret []byte, answer bool) (string, <-chan int16) {
+	lsock, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	dcs := make(chan int16, 1)
+	go func() {
+		defer lsock.Close() // nolint: errcheck
+
+		conn, err := lsock.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close() // nolint: errcheck
+
+		frame := make([]byte, obfuscated2.FrameLen)
+		if _, err = io.ReadFull(conn, frame); err != nil {
+			return
+		}
+		obfs, dc, err := obfuscated2.ParseObfuscated2ClientFrame(secret, frame)
+		if err != nil {
+			return
+		}
+		dcs <- dc
+
+		// abridged length byte, unencrypted header, constructor, nonce
+		request := make([]byte, 1+20+4+16)
+		if _, err = io.ReadFull(conn, request); err != nil || !answer {
+			return
+		}
+		request = obfs.Decrypt(request)
+
+		response := make([]byte, 1+20+4+16+16)
+		response[0] = byte((len(response) - 1) / 4)
+		binary.LittleEndian.PutUint32(response[1+20:], 0x05162463)
+		copy(response[1+20+4:], request[1+20+4:])
+		conn.Write(obfs.Encrypt(response)) // nolint: errcheck
+	}()
+
+	return lsock.Addr().String(), dcs
+}
+
+func TestRunPing(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	addr, dcs := servePing(t, secret, true)
+	host, port, _ := net.SplitHostPort(addr)
+
+	report, err := runPing(&client.ProxyURL{Server: host, Port: port, Secret: secret}, 2, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, addr, report.Addr)
+	assert.Equal(t, int16(2), report.DC)
+	assert.Equal(t, int16(2), <-dcs)
+}
+
+func TestRunPingFailed(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	addr, _ := servePing(t, secret, false)
+	host, port, _ := net.SplitHostPort(addr)
+
+	_, err := runPing(&client.ProxyURL{Server: host, Port: port, Secret: secret}, 2, time.Second)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const listenOverflowsInterval = 10 * time.Second
+
+// parseListenOverflows extracts ListenOverflows counter from the
+// content of /proc/net/netstat. It has pairs of lines: names of TcpExt
+// counters and their values.
+func parseListenOverflows(r io.Reader) (uint64, error) {
+	var names []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "TcpExt:" {
+			continue
+		}
+		if names == nil {
+			names = fields
+			continue
+		}
+
+		for idx := 1; idx < len(names) && idx < len(fields); idx++ {
+			if names[idx] == "ListenOverflows" {
+				value, err := strconv.ParseUint(fields[idx], 10, 64)
+				if err != nil {
+					return 0, errors.Annotate(err, "Cannot parse ListenOverflows")
+				}
+				return value, nil
+			}
+		}
+		break
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, errors.Annotate(err, "Cannot read netstat")
+	}
+
+	return 0, errors.New("ListenOverflows counter is not found")
+}
+
+// monitorListenOverflows periodically reports how many connections
+// were dropped because accept queue was full. Kernel counts overflows
+// of all listeners on the host, not only of this proxy.
+func (s *Server) monitorListenOverflows(stopped <-chan struct{}) {
+	last, err := listenOverflows()
+	if err != nil {
+		s.logger.Debugw("Cannot monitor accept queue overflows", "error", err)
+		return
+	}
+
+	ticker := time.NewTicker(listenOverflowsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+		}
+
+		current, err := listenOverflows()
+		if err != nil || current <= last {
+			continue
+		}
+		s.collector.AddListenOverflows(int(current - last))
+		s.logger.Warnw("Accept queue has overflowed, consider increasing listen backlog",
+			"overflows", current-last,
+			"backlog", s.conf.ListenBacklog,
+		)
+		last = current
+	}
+}
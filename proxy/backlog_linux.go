@@ -0,0 +1,25 @@
+package proxy
+
+import (
+	"os"
+	"syscall"
+)
+
+// listenBacklog changes backlog of listening socket. Calling listen
+// again on already listening socket only updates its backlog. Kernel
+// caps it with net.core.somaxconn.
+func listenBacklog(backlog int) socketControl {
+	return func(fd uintptr) error {
+		return syscall.Listen(int(fd), backlog)
+	}
+}
+
+func listenOverflows() (uint64, error) {
+	fp, err := os.Open("/proc/net/netstat")
+	if err != nil {
+		return 0, err
+	}
+	defer fp.Close() // nolint: errcheck
+
+	return parseListenOverflows(fp)
+}
@@ -0,0 +1,25 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenBacklog(t *testing.T) {
+	lsock, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lsock.Close()
+
+	assert.Nil(t, controlListener(lsock, listenBacklog(16)))
+
+	conn, err := net.Dial("tcp", lsock.Addr().String())
+	assert.Nil(t, err)
+	conn.Close()
+}
+
+func TestListenOverflows(t *testing.T) {
+	_, err := listenOverflows()
+	assert.Nil(t, err)
+}
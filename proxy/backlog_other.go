@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package proxy
+
+import "github.com/juju/errors"
+
+var errBacklogUnsupported = errors.New("Listen backlog is configurable only on Linux")
+
+func listenBacklog(backlog int) socketControl {
+	return func(fd uintptr) error {
+		return errBacklogUnsupported
+	}
+}
+
+func listenOverflows() (uint64, error) {
+	return 0, errBacklogUnsupported
+}
@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListenOverflows(t *testing.T) {
+	netstat := "TcpExt: SyncookiesSent ListenOverflows ListenDrops\n" +
+		"TcpExt: 1 42 43\n" +
+		"IpExt: InNoRoutes ListenOverflows\n" +
+		"IpExt: 0 1\n"
+
+	value, err := parseListenOverflows(strings.NewReader(netstat))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(42), value)
+}
+
+func TestParseListenOverflowsMissing(t *testing.T) {
+	_, err := parseListenOverflows(strings.NewReader("IpExt: InNoRoutes\nIpExt: 0\n"))
+	assert.NotNil(t, err)
+}
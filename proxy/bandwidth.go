@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const bandwidthTick = 5 * time.Second
+
+// bandwidthWindows are averaging periods of bandwidth rates, like ones
+// of load average.
+var bandwidthWindows = [...]time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// bandwidthRate is exponentially weighted moving average of throughput
+// in bytes per second for each of bandwidthWindows.
+type bandwidthRate [len(bandwidthWindows)]float64
+
+func (r *bandwidthRate) update(rate float64, elapsed time.Duration) {
+	for i, window := range bandwidthWindows {
+		alpha := 1 - math.Exp(-elapsed.Seconds()/window.Seconds())
+		r[i] += alpha * (rate - r[i])
+	}
+}
+
+func (r *bandwidthRate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		M1  uint64 `json:"1m"`
+		M5  uint64 `json:"5m"`
+		M15 uint64 `json:"15m"`
+	}{uint64(r[0]), uint64(r[1]), uint64(r[2])})
+}
+
+// statsBandwidth is current throughput of the proxy, so dashboards need
+// no rate calculations over lifetime traffic counters.
+type statsBandwidth struct {
+	mutex      sync.RWMutex
+	incoming   bandwidthRate
+	outgoing   bandwidthRate
+	lastIn     uint64
+	lastOut    uint64
+	lastUpdate time.Time
+}
+
+// update adds traffic counters sampled at given time. The first sample
+// is a baseline only.
+func (s *statsBandwidth) update(incoming, outgoing uint64, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if elapsed := now.Sub(s.lastUpdate); !s.lastUpdate.IsZero() && elapsed > 0 {
+		s.incoming.update(float64(incoming-s.lastIn)/elapsed.Seconds(), elapsed)
+		s.outgoing.update(float64(outgoing-s.lastOut)/elapsed.Seconds(), elapsed)
+	}
+	s.lastIn = incoming
+	s.lastOut = outgoing
+	s.lastUpdate = now
+}
+
+func (s *statsBandwidth) rates() (bandwidthRate, bandwidthRate) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.incoming, s.outgoing
+}
+
+func (s *statsBandwidth) MarshalJSON() ([]byte, error) {
+	incoming, outgoing := s.rates()
+
+	return json.Marshal(map[string]*bandwidthRate{
+		"incoming": &incoming,
+		"outgoing": &outgoing,
+	})
+}
+
+func (s *statsBandwidth) metrics() []Metric {
+	incoming, outgoing := s.rates()
+
+	metrics := make([]Metric, 0, 2*len(bandwidthWindows))
+	for i, suffix := range []string{"1m", "5m", "15m"} {
+		metrics = append(metrics,
+			gaugeMetric("bandwidth_incoming_"+suffix, uint64(incoming[i])),
+			gaugeMetric("bandwidth_outgoing_"+suffix, uint64(outgoing[i])),
+		)
+	}
+
+	return metrics
+}
+
+// measureBandwidth periodically samples traffic counters to update
+// bandwidth rates.
+func (s *Server) measureBandwidth(stopped <-chan struct{}) {
+	ticker := time.NewTicker(bandwidthTick)
+	defer ticker.Stop()
+
+	for {
+		s.stats.Bandwidth.update(
+			atomic.LoadUint64(&s.stats.Traffic.Incoming),
+			atomic.LoadUint64(&s.stats.Traffic.Outgoing),
+			time.Now(),
+		)
+
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -42,6 +42,11 @@ func (c *CipherReadWriteCloser) Write(p []byte) (int, error) {
 	return allWritten, nil
 }
 
+// CloseWrite closes writing side of underlying connection.
+func (c *CipherReadWriteCloser) CloseWrite() error {
+	return closeWrite(c.conn)
+}
+
 // Close closes underlying connection.
 func (c *CipherReadWriteCloser) Close() error {
 	return c.conn.Close()
@@ -0,0 +1,18 @@
+package proxy
+
+import "io"
+
+// closeWriter is implemented by connections which support half-close,
+// like *net.TCPConn.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// closeWrite sends FIN to the peer if connection supports half-close.
+// Otherwise, nothing is done.
+func closeWrite(conn io.Writer) error {
+	if cw, ok := conn.(closeWriter); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
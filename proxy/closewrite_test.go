@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloseWritePropagatesThroughWrappers(t *testing.T) {
+	lsock, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lsock.Close()
+
+	go func() {
+		conn, err := lsock.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		data, _ := ioutil.ReadAll(conn)
+		conn.Write(data)
+	}()
+
+	conn, err := net.Dial("tcp", lsock.Addr().String())
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wConn io.ReadWriteCloser = newTimeoutReadWriteCloser(conn, time.Second, time.Second)
+	wConn = newTrafficReadWriteCloser(wConn, func(int) {}, func(int) {})
+	wConn = newCtxReadWriteCloser(ctx, cancel, wConn)
+	defer wConn.Close()
+
+	wConn.Write([]byte("hello"))
+	assert.Nil(t, closeWrite(wConn))
+
+	data, err := ioutil.ReadAll(wConn)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+	assert.Nil(t, ctx.Err())
+}
+
+func TestLingerUnblocksPendingRead(t *testing.T) {
+	lsock, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lsock.Close()
+
+	go func() {
+		conn, err := lsock.Accept()
+		if err == nil {
+			time.Sleep(time.Second)
+			conn.Close()
+		}
+	}()
+
+	conn, err := net.Dial("tcp", lsock.Addr().String())
+	assert.Nil(t, err)
+	wConn := newTimeoutReadWriteCloser(conn, time.Minute, time.Minute)
+	defer wConn.Close()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		wConn.setLinger(time.Now())
+	}()
+
+	started := time.Now()
+	_, err = wConn.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(started) < 500*time.Millisecond)
+}
@@ -0,0 +1,262 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/9seconds/mtg/config"
+)
+
+// StatsCollector receives events about work of the proxy. Kind of
+// non-MTPROTO traffic is one of http, tls, ssh, unknown or garbage.
+//
+// This interface is frozen: new events are added with optional
+// interfaces below, which are checked with type assertion, so existing
+// implementations keep working.
+type StatsCollector interface {
+	NewConnection()
+	CloseConnection()
+	AddIncomingTraffic(int)
+	AddOutgoingTraffic(int)
+	AddNonMTProto(kind string)
+	AddBackpressureEvent()
+	AddSlowClientEviction()
+}
+
+// HandshakeStatsCollector receives failed handshakes. Reason is one of
+// bad_secret, bad_transport, timeout or closed.
+type HandshakeStatsCollector interface {
+	AddHandshakeFailure(reason string)
+}
+
+// ListenerStatsCollector receives events of accepting connections.
+type ListenerStatsCollector interface {
+	AddListenOverflows(int)
+	AddFDExhaustion()
+}
+
+// FilterStatsCollector receives connections which are refused by
+// filters.
+type FilterStatsCollector interface {
+	AddFilteredConnection()
+	AddTarpittedConnection()
+}
+
+// ConnectionStatsCollector receives events of established connections.
+// Stream of dead peer is client or telegram.
+type ConnectionStatsCollector interface {
+	AddTelegramReconnect()
+	AddDeadPeer(stream string)
+}
+
+// SecretStatsCollector receives client traffic of the secret. Unlike
+// AddIncomingTraffic and AddOutgoingTraffic, it does not include
+// Telegram side of connections.
+type SecretStatsCollector interface {
+	AddSecretUpload(int)
+	AddSecretDownload(int)
+}
+
+// DCStatsCollector receives per-datacenter events. Upload is traffic
+// from client, download is traffic to client.
+type DCStatsCollector interface {
+	AddDCDial(dc int16, latency time.Duration, err error)
+	AddDCSession(dc int16, upload, download uint64, duration time.Duration)
+}
+
+// CountryStatsCollector receives per-country events. Country is known
+// if GeoIP database is configured.
+type CountryStatsCollector interface {
+	AddCountryConnection(country string)
+	AddCountryFailedHandshake(country string)
+	AddCountryTraffic(country string, incoming, outgoing uint64)
+}
+
+// multiStatsCollector passes events to each collector which supports
+// them.
+type multiStatsCollector []StatsCollector
+
+func (m multiStatsCollector) NewConnection() {
+	for _, collector := range m {
+		collector.NewConnection()
+	}
+}
+
+func (m multiStatsCollector) CloseConnection() {
+	for _, collector := range m {
+		collector.CloseConnection()
+	}
+}
+
+func (m multiStatsCollector) AddIncomingTraffic(n int) {
+	for _, collector := range m {
+		collector.AddIncomingTraffic(n)
+	}
+}
+
+func (m multiStatsCollector) AddOutgoingTraffic(n int) {
+	for _, collector := range m {
+		collector.AddOutgoingTraffic(n)
+	}
+}
+
+func (m multiStatsCollector) AddNonMTProto(kind string) {
+	for _, collector := range m {
+		collector.AddNonMTProto(kind)
+	}
+}
+
+func (m multiStatsCollector) AddBackpressureEvent() {
+	for _, collector := range m {
+		collector.AddBackpressureEvent()
+	}
+}
+
+func (m multiStatsCollector) AddSlowClientEviction() {
+	for _, collector := range m {
+		collector.AddSlowClientEviction()
+	}
+}
+
+func (m multiStatsCollector) AddHandshakeFailure(reason string) {
+	for _, collector := range m {
+		if ext, ok := collector.(HandshakeStatsCollector); ok {
+			ext.AddHandshakeFailure(reason)
+		}
+	}
+}
+
+func (m multiStatsCollector) AddListenOverflows(n int) {
+	for _, collector := range m {
+		if ext, ok := collector.(ListenerStatsCollector); ok {
+			ext.AddListenOverflows(n)
+		}
+	}
+}
+
+func (m multiStatsCollector) AddFDExhaustion() {
+	for _, collector := range m {
+		if ext, ok := collector.(ListenerStatsCollector); ok {
+			ext.AddFDExhaustion()
+		}
+	}
+}
+
+func (m multiStatsCollector) AddFilteredConnection() {
+	for _, collector := range m {
+		if ext, ok := collector.(FilterStatsCollector); ok {
+			ext.AddFilteredConnection()
+		}
+	}
+}
+
+func (m multiStatsCollector) AddTarpittedConnection() {
+	for _, collector := range m {
+		if ext, ok := collector.(FilterStatsCollector); ok {
+			ext.AddTarpittedConnection()
+		}
+	}
+}
+
+func (m multiStatsCollector) AddTelegramReconnect() {
+	for _, collector := range m {
+		if ext, ok := collector.(ConnectionStatsCollector); ok {
+			ext.AddTelegramReconnect()
+		}
+	}
+}
+
+func (m multiStatsCollector) AddDeadPeer(stream string) {
+	for _, collector := range m {
+		if ext, ok := collector.(ConnectionStatsCollector); ok {
+			ext.AddDeadPeer(stream)
+		}
+	}
+}
+
+func (m multiStatsCollector) AddSecretUpload(n int) {
+	for _, collector := range m {
+		if ext, ok := collector.(SecretStatsCollector); ok {
+			ext.AddSecretUpload(n)
+		}
+	}
+}
+
+func (m multiStatsCollector) AddSecretDownload(n int) {
+	for _, collector := range m {
+		if ext, ok := collector.(SecretStatsCollector); ok {
+			ext.AddSecretDownload(n)
+		}
+	}
+}
+
+func (m multiStatsCollector) AddDCDial(dc int16, latency time.Duration, err error) {
+	for _, collector := range m {
+		if ext, ok := collector.(DCStatsCollector); ok {
+			ext.AddDCDial(dc, latency, err)
+		}
+	}
+}
+
+func (m multiStatsCollector) AddDCSession(dc int16, upload, download uint64, duration time.Duration) {
+	for _, collector := range m {
+		if ext, ok := collector.(DCStatsCollector); ok {
+			ext.AddDCSession(dc, upload, download, duration)
+		}
+	}
+}
+
+func (m multiStatsCollector) AddCountryConnection(country string) {
+	for _, collector := range m {
+		if ext, ok := collector.(CountryStatsCollector); ok {
+			ext.AddCountryConnection(country)
+		}
+	}
+}
+
+func (m multiStatsCollector) AddCountryFailedHandshake(country string) {
+	for _, collector := range m {
+		if ext, ok := collector.(CountryStatsCollector); ok {
+			ext.AddCountryFailedHandshake(country)
+		}
+	}
+}
+
+func (m multiStatsCollector) AddCountryTraffic(country string, incoming, outgoing uint64) {
+	for _, collector := range m {
+		if ext, ok := collector.(CountryStatsCollector); ok {
+			ext.AddCountryTraffic(country, incoming, outgoing)
+		}
+	}
+}
+
+// NewMultiStatsCollector returns collector which passes all events to
+// each of given collectors.
+func NewMultiStatsCollector(collectors ...StatsCollector) StatsCollector {
+	return multiStatsCollector(collectors)
+}
+
+// makeServerCollector flattens collector into the list of collectors and
+// finds builtin statistics in it. If there is none, new one is added,
+// because server needs it for health checks and stats endpoint.
+func makeServerCollector(conf *config.Config, collector StatsCollector) (multiStatsCollector, *Stats) {
+	collectors, ok := collector.(multiStatsCollector)
+	if !ok {
+		collectors = multiStatsCollector{collector}
+	}
+	collectors = append(multiStatsCollector{}, collectors...)
+
+	for _, value := range collectors {
+		if stat, ok := value.(*Stats); ok {
+			return collectors, stat
+		}
+	}
+	stat := NewStats(conf)
+
+	return append(multiStatsCollector{stat}, collectors...), stat
+}
+
+// AddStatsCollector attaches additional collector to the server.
+// Builtin statistics keeps working. It has to be called before Serve.
+func (s *Server) AddStatsCollector(collector StatsCollector) {
+	s.collector = append(s.collector, collector)
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestAddStatsCollector(t *testing.T) {
+	conf := &config.Config{}
+	stat := NewStats(conf)
+	srv := NewServer(conf, zap.NewNop().Sugar(), stat)
+
+	first := NewStats(conf)
+	second := NewStats(conf)
+	srv.AddStatsCollector(first)
+	srv.AddStatsCollector(second)
+
+	srv.collector.NewConnection()
+	srv.collector.AddIncomingTraffic(10)
+	srv.collector.AddNonMTProto(trafficTLS)
+	srv.collector.AddHandshakeFailure(handshakeTimeout)
+	srv.pump.onBackpressure()
+	srv.collector.AddListenOverflows(3)
+
+	for _, s := range []*Stats{stat, first, second} {
+		assert.Equal(t, uint64(1), s.AllConnections)
+		assert.Equal(t, uint64(10), s.Traffic.Incoming)
+		assert.Equal(t, uint64(1), s.NonMTProto.TLS)
+		assert.Equal(t, uint64(1), s.HandshakeFailures.Timeout)
+		assert.Equal(t, uint64(1), s.BackpressureEvents)
+		assert.Equal(t, uint64(3), s.ListenOverflows)
+	}
+}
+
+// baseCollector implements StatsCollector only.
+type baseCollector struct {
+	connections int
+}
+
+func (b *baseCollector) NewConnection()         { b.connections++ }
+func (b *baseCollector) CloseConnection()       {}
+func (b *baseCollector) AddIncomingTraffic(int) {}
+func (b *baseCollector) AddOutgoingTraffic(int) {}
+func (b *baseCollector) AddNonMTProto(string)   {}
+func (b *baseCollector) AddBackpressureEvent()  {}
+func (b *baseCollector) AddSlowClientEviction() {}
+
+// dcCollector implements StatsCollector with per-datacenter events.
+type dcCollector struct {
+	baseCollector
+
+	sessions map[int16]uint64
+}
+
+func (d *dcCollector) AddDCDial(dc int16, latency time.Duration, err error) {}
+
+func (d *dcCollector) AddDCSession(dc int16, upload, download uint64, duration time.Duration) {
+	d.sessions[dc] += upload + download
+}
+
+func TestNewServerWithCollector(t *testing.T) {
+	conf := &config.Config{}
+	base := &baseCollector{}
+	srv := NewServer(conf, zap.NewNop().Sugar(), base)
+	assert.NotNil(t, srv.stats)
+
+	dcs := &dcCollector{sessions: map[int16]uint64{}}
+	srv.AddStatsCollector(dcs)
+
+	srv.collector.NewConnection()
+	srv.collector.AddHandshakeFailure(handshakeTimeout)
+	srv.collector.AddDCSession(2, 10, 20, time.Second)
+
+	assert.Equal(t, 1, base.connections)
+	assert.Equal(t, 1, dcs.connections)
+	assert.Equal(t, uint64(30), dcs.sessions[2])
+	assert.Equal(t, uint64(1), srv.stats.AllConnections)
+	assert.Equal(t, uint64(1), srv.stats.HandshakeFailures.Timeout)
+
+	stat := NewStats(conf)
+	srv = NewServer(conf, zap.NewNop().Sugar(), NewMultiStatsCollector(base, stat))
+	assert.Equal(t, stat, srv.stats)
+	assert.Len(t, srv.collector, 2)
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// countryUnknown is used for clients which are not found in GeoIP
+// database.
+const countryUnknown = "unknown"
+
+// statsCountry is a statistics of clients from one country.
+type statsCountry struct {
+	Connections      uint64 `json:"connections"`
+	FailedHandshakes uint64 `json:"failed_handshakes"`
+	Traffic          struct {
+		Incoming uint64 `json:"incoming"`
+		Outgoing uint64 `json:"outgoing"`
+	} `json:"traffic"`
+}
+
+// statsCountries is a statistics by client country.
+type statsCountries struct {
+	mutex     sync.RWMutex
+	countries map[string]*statsCountry
+}
+
+func (s *statsCountries) get(country string) *statsCountry {
+	s.mutex.RLock()
+	stat, ok := s.countries[country]
+	s.mutex.RUnlock()
+	if ok {
+		return stat
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if stat, ok = s.countries[country]; !ok {
+		stat = &statsCountry{}
+		s.countries[country] = stat
+	}
+
+	return stat
+}
+
+func (s *statsCountries) addConnection(country string) {
+	atomic.AddUint64(&s.get(country).Connections, 1)
+}
+
+func (s *statsCountries) addFailedHandshake(country string) {
+	atomic.AddUint64(&s.get(country).FailedHandshakes, 1)
+}
+
+func (s *statsCountries) addTraffic(country string, incoming, outgoing uint64) {
+	stat := s.get(country)
+	atomic.AddUint64(&stat.Traffic.Incoming, incoming)
+	atomic.AddUint64(&stat.Traffic.Outgoing, outgoing)
+}
+
+func (s *statsCountries) MarshalJSON() ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	countries := make(map[string]statsCountry, len(s.countries))
+	for country, stat := range s.countries {
+		value := statsCountry{
+			Connections:      atomic.LoadUint64(&stat.Connections),
+			FailedHandshakes: atomic.LoadUint64(&stat.FailedHandshakes),
+		}
+		value.Traffic.Incoming = atomic.LoadUint64(&stat.Traffic.Incoming)
+		value.Traffic.Outgoing = atomic.LoadUint64(&stat.Traffic.Outgoing)
+		countries[country] = value
+	}
+
+	return json.Marshal(countries)
+}
+
+func newStatsCountries() *statsCountries {
+	return &statsCountries{countries: map[string]*statsCountry{}}
+}
+
+// clientCountry returns ISO code of the client country. Empty string is
+// returned if GeoIP database is not configured.
+func (s *Server) clientCountry(addr net.Addr) string {
+	if s.geoDB == nil {
+		return ""
+	}
+
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return countryUnknown
+	}
+	country, err := s.geoDB.Country(tcpAddr.IP)
+	if err != nil || country == "" {
+		return countryUnknown
+	}
+
+	return country
+}
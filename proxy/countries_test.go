@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestStatsCountries(t *testing.T) {
+	countries := newStatsCountries()
+	countries.addConnection("NL")
+	countries.addConnection("NL")
+	countries.addFailedHandshake("NL")
+	countries.addTraffic("NL", 10, 20)
+	countries.addConnection(countryUnknown)
+
+	data, err := json.Marshal(countries)
+	assert.Nil(t, err)
+
+	var decoded map[string]statsCountry
+	assert.Nil(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, uint64(2), decoded["NL"].Connections)
+	assert.Equal(t, uint64(1), decoded["NL"].FailedHandshakes)
+	assert.Equal(t, uint64(10), decoded["NL"].Traffic.Incoming)
+	assert.Equal(t, uint64(20), decoded["NL"].Traffic.Outgoing)
+	assert.Equal(t, uint64(1), decoded[countryUnknown].Connections)
+}
+
+func TestStatsWithoutCountries(t *testing.T) {
+	conf := &config.Config{}
+	stat := NewStats(conf)
+	srv := NewServer(conf, zap.NewNop().Sugar(), stat)
+
+	assert.Equal(t, "", srv.clientCountry(&net.TCPAddr{IP: net.ParseIP("10.0.0.1")}))
+
+	data, err := json.Marshal(stat)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "countries")
+}
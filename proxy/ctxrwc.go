@@ -22,7 +22,7 @@ func (c *CtxReadWriteCloser) Read(p []byte) (int, error) {
 		return 0, errors.Annotate(c.ctx.Err(), "Read is failed because of closed context")
 	default:
 		n, err := c.conn.Read(p)
-		if err != nil {
+		if err != nil && err != io.EOF {
 			c.cancel()
 		}
 		return n, err
@@ -43,6 +43,15 @@ func (c *CtxReadWriteCloser) Write(p []byte) (int, error) {
 	}
 }
 
+// CloseWrite closes writing side of underlying connection.
+func (c *CtxReadWriteCloser) CloseWrite() error {
+	err := closeWrite(c.conn)
+	if err != nil {
+		c.cancel()
+	}
+	return err
+}
+
 // Close closes underlying connection.
 func (c *CtxReadWriteCloser) Close() error {
 	return c.conn.Close()
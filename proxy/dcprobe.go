@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const dcProbeTimeout = 10 * time.Second
+
+// statsDCProbe is a result of the last connect check of DC address.
+type statsDCProbe struct {
+	Reachable bool      `json:"reachable"`
+	LatencyMS uint64    `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// statsDCHealth keeps results of connect checks by DC and address
+// family.
+type statsDCHealth struct {
+	mutex  sync.RWMutex
+	probes map[int16]map[string]statsDCProbe
+}
+
+// set stores result of check and returns true if address was reachable
+// before or was not checked yet.
+func (s *statsDCHealth) set(dc int16, family string, probe statsDCProbe) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.probes[dc] == nil {
+		s.probes[dc] = map[string]statsDCProbe{}
+	}
+	previous, ok := s.probes[dc][family]
+	s.probes[dc][family] = probe
+
+	return !ok || previous.Reachable
+}
+
+func (s *statsDCHealth) MarshalJSON() ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	probes := make(map[string]map[string]statsDCProbe, len(s.probes))
+	for dc, families := range s.probes {
+		copied := make(map[string]statsDCProbe, len(families))
+		for family, probe := range families {
+			copied[family] = probe
+		}
+		probes[strconv.Itoa(int(dc))] = copied
+	}
+
+	return json.Marshal(probes)
+}
+
+func newStatsDCHealth() *statsDCHealth {
+	return &statsDCHealth{probes: map[int16]map[string]statsDCProbe{}}
+}
+
+// probeDCs periodically checks that every DC is reachable over IPv4
+// and IPv6. Checks are done with builtin dialer only, custom dialers
+// may have no notion of address family.
+func (s *Server) probeDCs(stopped <-chan struct{}) {
+	if s.stats.DCHealth == nil {
+		return
+	}
+	dialer, ok := s.dialer.(*tcpDialer)
+	if !ok {
+		s.logger.Debugw("DC health probing is disabled for custom dialer")
+		return
+	}
+
+	ticker := time.NewTicker(s.conf.DCProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		s.probeAllDCs(dialer.dial)
+
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) probeAllDCs(dial dialFunc) {
+	timeout := s.conf.TelegramDialTimeout
+	if timeout <= 0 {
+		timeout = dcProbeTimeout
+	}
+
+	wg := &sync.WaitGroup{}
+	addresses := telegramAddresses(s.conf.TestDCs)
+	for idx := range addresses {
+		dc := int16(idx + 1)
+		targets := map[string][2]string{
+			"ipv4": {"tcp4", addresses[idx].IPv4()},
+		}
+		if addresses[idx].v6 != "" {
+			targets["ipv6"] = [2]string{"tcp6", addresses[idx].IPv6()}
+		}
+
+		for family, target := range targets {
+			wg.Add(1)
+			go func(family, network, address string) {
+				defer wg.Done()
+				probe := probeDC(dial, network, address, timeout)
+				wasReachable := s.stats.DCHealth.set(dc, family, probe)
+				if !probe.Reachable {
+					s.logger.Debugw("DC address is unreachable", "dc", dc, "address", address, "error", probe.Error)
+					if wasReachable {
+						s.notify(EventDCUnhealthy, map[string]interface{}{
+							"dc":      dc,
+							"family":  family,
+							"address": address,
+							"error":   probe.Error,
+						})
+					}
+				}
+			}(family, target[0], target[1])
+		}
+	}
+	wg.Wait()
+}
+
+func probeDC(dial dialFunc, network, address string, timeout time.Duration) statsDCProbe {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	probe := statsDCProbe{CheckedAt: time.Now()}
+	conn, err := dial(ctx, network, address)
+	if err != nil {
+		probe.Error = err.Error()
+		return probe
+	}
+	conn.Close() // nolint: errcheck
+
+	probe.Reachable = true
+	probe.LatencyMS = uint64(time.Since(probe.CheckedAt) / time.Millisecond)
+
+	return probe
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestProbeAllDCs(t *testing.T) {
+	conf := &config.Config{DCProbeInterval: time.Minute, TestDCs: true}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+
+	srv.probeAllDCs(func(ctx context.Context, network, address string) (net.Conn, error) {
+		if network == "tcp6" {
+			return nil, errors.New("network is unreachable")
+		}
+		client, _ := net.Pipe()
+		return client, nil
+	})
+
+	health := srv.stats.DCHealth
+	assert.Len(t, health.probes, len(TelegramTestAddresses))
+	assert.True(t, health.probes[1]["ipv4"].Reachable)
+	assert.False(t, health.probes[1]["ipv6"].Reachable)
+	assert.Equal(t, "network is unreachable", health.probes[1]["ipv6"].Error)
+
+	encoded, err := json.Marshal(srv.stats)
+	assert.Nil(t, err)
+	assert.Contains(t, string(encoded), `"dc_health"`)
+}
+
+func TestProbeDCsCustomDialer(t *testing.T) {
+	conf := &config.Config{DCProbeInterval: time.Minute}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+	srv.SetDialer(&fakeDialer{})
+
+	done := make(chan struct{})
+	go func() {
+		srv.probeDCs(make(chan struct{}))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Probing is not disabled for custom dialer")
+	}
+}
@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Bounds of per-DC histograms: dial latency is in milliseconds,
+// throughput is in KiB per second.
+var (
+	dialLatencyBounds = []uint64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+	throughputBounds  = []uint64{16, 64, 256, 1024, 4096, 16384}
+)
+
+// minThroughputTraffic is an amount of traffic session has to transfer
+// to be counted in throughput histogram. Throughput of smaller sessions
+// depends on client activity rather than on the route to DC.
+const minThroughputTraffic = 256 * 1024
+
+// histogram counts observations by buckets. Bucket includes values
+// which are less or equal to its bound, the last one is unbounded.
+type histogram struct {
+	bounds []uint64
+	counts []uint64
+	sum    uint64
+}
+
+func (h *histogram) observe(value uint64) {
+	idx := sort.Search(len(h.bounds), func(i int) bool { return value <= h.bounds[i] })
+	atomic.AddUint64(&h.counts[idx], 1)
+	atomic.AddUint64(&h.sum, value)
+}
+
+func (h *histogram) MarshalJSON() ([]byte, error) {
+	type bucket struct {
+		LE    string `json:"le"`
+		Count uint64 `json:"count"`
+	}
+	data := struct {
+		Buckets []bucket `json:"buckets"`
+		Count   uint64   `json:"count"`
+		Sum     uint64   `json:"sum"`
+	}{
+		Buckets: make([]bucket, len(h.counts)),
+		Sum:     atomic.LoadUint64(&h.sum),
+	}
+
+	for idx := range h.counts {
+		data.Buckets[idx].LE = "+Inf"
+		if idx < len(h.bounds) {
+			data.Buckets[idx].LE = strconv.FormatUint(h.bounds[idx], 10)
+		}
+		data.Buckets[idx].Count = atomic.LoadUint64(&h.counts[idx])
+		data.Count += data.Buckets[idx].Count
+	}
+
+	return json.Marshal(data)
+}
+
+func newHistogram(bounds []uint64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// statsDC is a statistics of connections to one Telegram datacenter.
+// Upload is traffic from clients to datacenter, download is traffic
+// from datacenter to clients. They are counted when session is finished.
+type statsDC struct {
+	Dials        uint64     `json:"dials"`
+	DialFailures uint64     `json:"dial_failures"`
+	Upload       uint64     `json:"upload"`
+	Download     uint64     `json:"download"`
+	DialLatency  *histogram `json:"dial_latency_ms"`
+	Throughput   *histogram `json:"throughput_kib_per_second"`
+}
+
+// statsDCs is a statistics by datacenter number clients have asked for.
+type statsDCs struct {
+	mutex sync.RWMutex
+	dcs   map[int16]*statsDC
+}
+
+func (s *statsDCs) get(dc int16) *statsDC {
+	s.mutex.RLock()
+	stat, ok := s.dcs[dc]
+	s.mutex.RUnlock()
+	if ok {
+		return stat
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if stat, ok = s.dcs[dc]; !ok {
+		stat = &statsDC{
+			DialLatency: newHistogram(dialLatencyBounds),
+			Throughput:  newHistogram(throughputBounds),
+		}
+		s.dcs[dc] = stat
+	}
+
+	return stat
+}
+
+func (s *statsDCs) addDial(dc int16, latency time.Duration, err error) {
+	stat := s.get(dc)
+	atomic.AddUint64(&stat.Dials, 1)
+	if err != nil {
+		atomic.AddUint64(&stat.DialFailures, 1)
+		return
+	}
+	stat.DialLatency.observe(uint64(latency / time.Millisecond))
+}
+
+// addSession records traffic and average throughput of finished
+// session.
+func (s *statsDCs) addSession(dc int16, upload, download uint64, duration time.Duration) {
+	stat := s.get(dc)
+	atomic.AddUint64(&stat.Upload, upload)
+	atomic.AddUint64(&stat.Download, download)
+
+	traffic := upload + download
+	if traffic < minThroughputTraffic || duration <= 0 {
+		return
+	}
+	stat.Throughput.observe(uint64(float64(traffic) / 1024 / duration.Seconds()))
+}
+
+func (s *statsDCs) MarshalJSON() ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	dcs := make(map[string]*statsDC, len(s.dcs))
+	for dc, stat := range s.dcs {
+		dcs[strconv.Itoa(int(dc))] = &statsDC{
+			Dials:        atomic.LoadUint64(&stat.Dials),
+			DialFailures: atomic.LoadUint64(&stat.DialFailures),
+			Upload:       atomic.LoadUint64(&stat.Upload),
+			Download:     atomic.LoadUint64(&stat.Download),
+			DialLatency:  stat.DialLatency,
+			Throughput:   stat.Throughput,
+		}
+	}
+
+	return json.Marshal(dcs)
+}
+
+func newStatsDCs() *statsDCs {
+	return &statsDCs{dcs: map[int16]*statsDC{}}
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	hist := newHistogram([]uint64{10, 100})
+	hist.observe(5)
+	hist.observe(10)
+	hist.observe(50)
+	hist.observe(1000)
+
+	encoded, err := json.Marshal(hist)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"buckets": [
+			{"le": "10", "count": 2},
+			{"le": "100", "count": 1},
+			{"le": "+Inf", "count": 1}
+		],
+		"count": 4,
+		"sum": 1065
+	}`, string(encoded))
+}
+
+func TestStatsDCs(t *testing.T) {
+	stat := newStatsDCs()
+	stat.addDial(2, 30*time.Millisecond, nil)
+	stat.addDial(2, time.Second, errors.New("timeout"))
+	stat.addDial(-1, 3*time.Millisecond, nil)
+	stat.addSession(2, 256*1024, 768*1024, time.Second)
+	stat.addSession(2, 1000, 24, time.Second)
+
+	assert.Equal(t, uint64(2), stat.get(2).Dials)
+	assert.Equal(t, uint64(1), stat.get(2).DialFailures)
+	assert.Equal(t, uint64(256*1024+1000), stat.get(2).Upload)
+	assert.Equal(t, uint64(768*1024+24), stat.get(2).Download)
+	assert.Equal(t, uint64(30), stat.get(2).DialLatency.sum)
+	assert.Equal(t, uint64(1024), stat.get(2).Throughput.sum)
+	assert.Equal(t, uint64(1), stat.get(-1).DialLatency.counts[0])
+
+	encoded, err := json.Marshal(stat)
+	assert.Nil(t, err)
+	data := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(encoded, &data))
+	assert.Contains(t, data, "2")
+	assert.Contains(t, data, "-1")
+}
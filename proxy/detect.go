@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+)
+
+// Kinds of traffic which is definitely not MTPROTO.
+const (
+	trafficHTTP    = "http"
+	trafficTLS     = "tls"
+	trafficSSH     = "ssh"
+	trafficUnknown = "unknown"
+	trafficGarbage = "garbage"
+)
+
+const (
+	tlsRecordHandshake = 0x16
+	tlsMajorVersion    = 0x03
+
+	abridgedQuickAck  = 0x80
+	abridgedLongLen   = 0x7f
+	maxAbridgedPacket = 16 * 1024 * 1024
+)
+
+var httpVerbs = [][]byte{
+	[]byte("GET "),
+	[]byte("HEAD"),
+	[]byte("POST"),
+	[]byte("PUT "),
+	[]byte("DELE"),
+	[]byte("OPTI"),
+	[]byte("CONN"),
+	[]byte("PATC"),
+	[]byte("TRAC"),
+	[]byte("PRI "),
+}
+
+// detectHandshakeTraffic guesses what is the traffic client sent instead
+// of valid handshake frame. Scanners and misconfigured clients usually
+// speak HTTP, TLS or SSH.
+func detectHandshakeTraffic(data []byte) string {
+	switch {
+	case len(data) >= 3 && data[0] == tlsRecordHandshake && data[1] == tlsMajorVersion:
+		return trafficTLS
+	case bytes.HasPrefix(data, []byte("SSH-")):
+		return trafficSSH
+	}
+
+	for _, verb := range httpVerbs {
+		if bytes.HasPrefix(data, verb) {
+			return trafficHTTP
+		}
+	}
+
+	return trafficUnknown
+}
+
+// FramingCheckReadWriteCloser checks that the first packet client sends
+// after handshake looks like abridged MTPROTO packet.
+type FramingCheckReadWriteCloser struct {
+	conn      io.ReadWriteCloser
+	checked   bool
+	onInvalid func()
+}
+
+// Read reads from connection
+func (f *FramingCheckReadWriteCloser) Read(p []byte) (int, error) {
+	n, err := f.conn.Read(p)
+	if !f.checked && n > 0 {
+		f.checked = true
+		if !isValidAbridgedStart(p[:n]) {
+			f.onInvalid()
+		}
+	}
+
+	return n, err
+}
+
+// Write writes into connection.
+func (f *FramingCheckReadWriteCloser) Write(p []byte) (int, error) {
+	return f.conn.Write(p)
+}
+
+// CloseWrite closes writing side of underlying connection.
+func (f *FramingCheckReadWriteCloser) CloseWrite() error {
+	return closeWrite(f.conn)
+}
+
+// Close closes underlying connection.
+func (f *FramingCheckReadWriteCloser) Close() error {
+	return f.conn.Close()
+}
+
+func isValidAbridgedStart(data []byte) bool {
+	length := int(data[0] &^ abridgedQuickAck)
+	if length == abridgedLongLen && len(data) >= 4 {
+		length = int(data[1]) | int(data[2])<<8 | int(data[3])<<16
+	}
+
+	return length > 0 && length*4 <= maxAbridgedPacket
+}
+
+func newFramingCheckReadWriteCloser(conn io.ReadWriteCloser, onInvalid func()) io.ReadWriteCloser {
+	return &FramingCheckReadWriteCloser{
+		conn:      conn,
+		onInvalid: onInvalid,
+	}
+}
@@ -0,0 +1,23 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectHandshakeTraffic(t *testing.T) {
+	assert.Equal(t, trafficHTTP, detectHandshakeTraffic([]byte("GET / HTTP/1.1\r\n")))
+	assert.Equal(t, trafficHTTP, detectHandshakeTraffic([]byte("POST /api")))
+	assert.Equal(t, trafficTLS, detectHandshakeTraffic([]byte{0x16, 0x03, 0x01, 0x02, 0x00}))
+	assert.Equal(t, trafficSSH, detectHandshakeTraffic([]byte("SSH-2.0-OpenSSH_7.6\r\n")))
+	assert.Equal(t, trafficUnknown, detectHandshakeTraffic([]byte{1, 2, 3}))
+}
+
+func TestIsValidAbridgedStart(t *testing.T) {
+	assert.True(t, isValidAbridgedStart([]byte{10}))
+	assert.True(t, isValidAbridgedStart([]byte{0x80 | 10}))
+	assert.True(t, isValidAbridgedStart([]byte{0x7f, 0x00, 0x01, 0x00}))
+	assert.False(t, isValidAbridgedStart([]byte{0}))
+	assert.False(t, isValidAbridgedStart([]byte{0x7f, 0xff, 0xff, 0xff}))
+}
@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+)
+
+// Dialer establishes connections to Telegram datacenters. It can be
+// replaced to use custom network paths. Dial has to be aborted if
+// context is cancelled.
+type Dialer interface {
+	Dial(ctx context.Context, addr *TelegramAddress) (net.Conn, error)
+}
+
+type dialTimeoutKey struct{}
+
+// DialTimeout returns timeout of connection to Telegram if it is
+// overridden for datacenter being dialed, 0 otherwise. It can be used by
+// custom Dialer.
+func DialTimeout(ctx context.Context) time.Duration {
+	timeout, _ := ctx.Value(dialTimeoutKey{}).(time.Duration)
+	return timeout
+}
+
+func withDialTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, dialTimeoutKey{}, timeout)
+}
+
+// socketControl is applied to raw socket before it is connected.
+type socketControl func(fd uintptr) error
+
+type tcpDialer struct {
+	dialer      net.Dialer
+	controls    []socketControl
+	sources     *sourceIPs
+	ipPolicy    ipPolicy
+	quarantine  *addrQuarantine
+	keepAlive   keepAlive
+	readBuffer  int
+	writeBuffer int
+}
+
+func (d *tcpDialer) Dial(ctx context.Context, addr *TelegramAddress) (net.Conn, error) {
+	policy := d.quarantine.adjust(d.ipPolicy, addr)
+	conn, err := dialToTelegram(ctx, d.quarantine.wrap(d.dial), policy, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setKeepAlive(conn, d.keepAlive); err != nil {
+		conn.Close() // nolint: errcheck
+		return nil, err
+	}
+	if err := setSocketBuffers(conn, d.readBuffer, d.writeBuffer); err != nil {
+		conn.Close() // nolint: errcheck
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (d *tcpDialer) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := d.dialer
+	if timeout := DialTimeout(ctx); timeout > 0 {
+		dialer.Timeout = timeout
+	}
+	if ip := d.sources.next(network, ClientAddr(ctx)); ip != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	return dialer.DialContext(ctx, network, address)
+}
+
+// addControl adds a function which is applied to each socket before
+// connect. It has to be called before first Dial.
+func (d *tcpDialer) addControl(control socketControl) error {
+	controls := append(d.controls, control)
+	if err := setDialerControl(&d.dialer, controls); err != nil {
+		return err
+	}
+	d.controls = controls
+
+	return nil
+}
+
+func newTCPDialer(conf *config.Config) *tcpDialer {
+	return &tcpDialer{
+		dialer:   net.Dialer{Timeout: conf.TelegramDialTimeout},
+		sources:  newSourceIPs(conf.EgressIPs, conf.EgressStrategy),
+		ipPolicy: makeIPPolicy(conf),
+		keepAlive: keepAlive{
+			idle:     conf.TelegramKeepAlive,
+			interval: conf.KeepAliveInterval,
+			probes:   conf.KeepAliveProbes,
+		},
+		readBuffer:  conf.TelegramReadBuffer,
+		writeBuffer: conf.TelegramWriteBuffer,
+	}
+}
+
+func makeIPPolicy(conf *config.Config) ipPolicy {
+	switch {
+	case conf.IPv6Only:
+		return ipOnlyV6
+	case conf.PreferIPv6:
+		return ipPreferV6
+	}
+	return ipPreferV4
+}
+
+func (s *Server) makeDialer() *tcpDialer {
+	dialer := newTCPDialer(s.conf)
+
+	if s.conf.IPv6Only {
+		if err := checkIPv6Route(&telegramAddresses(s.conf.TestDCs)[0]); err != nil {
+			s.logger.Errorw("IPv6 only mode is enabled but IPv6 is not available", "error", err)
+		}
+	}
+
+	if s.conf.DCQuarantine > 0 {
+		dialer.quarantine = newAddrQuarantine(s.conf.DCQuarantine, func(address string) {
+			s.logger.Warnw("Telegram address keeps failing, avoid it for a while",
+				"address", address,
+				"cooldown", s.conf.DCQuarantine.String(),
+			)
+			s.notify(EventAddrQuarantined, map[string]interface{}{
+				"address":  address,
+				"cooldown": s.conf.DCQuarantine.String(),
+			})
+		})
+	}
+
+	if s.conf.MultipathTCP {
+		if err := setDialerMultipath(&dialer.dialer); err != nil {
+			s.logger.Warnw("Cannot enable Multipath TCP for Telegram connections", "error", err)
+		}
+	}
+	if s.conf.FastOpen {
+		control, err := fastOpenConnect()
+		if err == nil {
+			err = dialer.addControl(control)
+		}
+		if err != nil {
+			s.logger.Warnw("Cannot enable TCP Fast Open for Telegram connections", "error", err)
+		}
+	}
+	if len(s.conf.EgressIPs) > 0 {
+		if err := dialer.addControl(bindAddressNoPort); err != nil {
+			s.logger.Warnw("Cannot postpone port allocation of Telegram connections", "error", err)
+		}
+	}
+	if s.conf.EgressPortTo > 0 {
+		control, err := localPortRange(s.conf.EgressPortFrom, s.conf.EgressPortTo)
+		if err == nil {
+			err = dialer.addControl(control)
+		}
+		if err != nil {
+			s.logger.Warnw("Cannot set local port range of Telegram connections", "error", err)
+		}
+	}
+
+	return dialer
+}
+
+// SetDialer replaces default TCP dialer. It has to be called before
+// Serve.
+func (s *Server) SetDialer(dialer Dialer) {
+	s.dialer = dialer
+}
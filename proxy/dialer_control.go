@@ -0,0 +1,29 @@
+//go:build go1.11
+// +build go1.11
+
+package proxy
+
+import (
+	"net"
+	"syscall"
+)
+
+func setDialerControl(dialer *net.Dialer, controls []socketControl) error {
+	dialer.Control = func(network, address string, conn syscall.RawConn) error {
+		var err error
+		controlErr := conn.Control(func(fd uintptr) {
+			for _, control := range controls {
+				if err = control(fd); err != nil {
+					return
+				}
+			}
+		})
+		if controlErr != nil {
+			return controlErr
+		}
+
+		return err
+	}
+
+	return nil
+}
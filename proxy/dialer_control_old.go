@@ -0,0 +1,14 @@
+//go:build !go1.11
+// +build !go1.11
+
+package proxy
+
+import (
+	"net"
+
+	"github.com/juju/errors"
+)
+
+func setDialerControl(dialer *net.Dialer, controls []socketControl) error {
+	return errors.New("Socket options of outgoing connections require Go 1.11 or newer")
+}
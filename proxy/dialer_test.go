@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/9seconds/mtg/retry"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakeDialer struct {
+	reachable map[string]bool
+	dialed    []string
+}
+
+func (f *fakeDialer) Dial(ctx context.Context, addr *TelegramAddress) (net.Conn, error) {
+	f.dialed = append(f.dialed, addr.IPv4())
+	if !f.reachable[addr.IPv4()] {
+		return nil, errors.New("unreachable")
+	}
+	client, server := net.Pipe()
+	server.Close() // nolint: errcheck
+
+	return client, nil
+}
+
+func TestServerUsesDialer(t *testing.T) {
+	conf := &config.Config{}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+
+	dialer := &fakeDialer{}
+	srv.SetDialer(dialer)
+	assert.False(t, srv.isTelegramReachable())
+	assert.Len(t, dialer.dialed, len(TelegramAddresses))
+
+	last := TelegramAddresses[len(TelegramAddresses)-1].IPv4()
+	dialer = &fakeDialer{reachable: map[string]bool{last: true}}
+	srv.SetDialer(dialer)
+	assert.True(t, srv.isTelegramReachable())
+	assert.Equal(t, last, dialer.dialed[len(dialer.dialed)-1])
+}
+
+func TestTCPDialerCancel(t *testing.T) {
+	dialer := newTCPDialer(&config.Config{TelegramDialTimeout: time.Minute})
+	assert.Equal(t, time.Minute, dialer.dialer.Timeout)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := dialer.Dial(ctx, &TelegramAddress{v4: "127.0.0.1"})
+	assert.NotNil(t, err)
+}
+
+type timeoutDialer struct {
+	timeouts []time.Duration
+}
+
+func (d *timeoutDialer) Dial(ctx context.Context, addr *TelegramAddress) (net.Conn, error) {
+	d.timeouts = append(d.timeouts, DialTimeout(ctx))
+	client, server := net.Pipe()
+	go io.Copy(ioutil.Discard, server) // nolint: errcheck
+
+	return client, nil
+}
+
+func TestDialTelegramDCTimeouts(t *testing.T) {
+	conf := &config.Config{
+		ReadTimeout:    time.Minute,
+		DefaultDC:      2,
+		DCDialTimeouts: map[int16]time.Duration{5: 20 * time.Second},
+		DCReadTimeouts: map[int16]time.Duration{5: 2 * time.Minute},
+	}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+	dialer := &timeoutDialer{}
+	srv.SetDialer(dialer)
+
+	for _, dc := range []int16{5, -5, 2, 100} {
+		addr, err := telegramAddress(dc, conf.DefaultDC, false)
+		assert.Nil(t, err)
+		conn, base, err := srv.dialTelegram(context.Background(), dc, addr, 1)
+		if !assert.Nil(t, err) {
+			continue
+		}
+		conn.Close() // nolint: errcheck
+
+		if dc == 5 || dc == -5 {
+			assert.Equal(t, 2*time.Minute, base.readTimeout)
+		} else {
+			assert.Equal(t, time.Minute, base.readTimeout)
+		}
+	}
+	assert.Equal(t, []time.Duration{20 * time.Second, 20 * time.Second, 0, 0}, dialer.timeouts)
+}
+
+type flakyDialer struct {
+	failures int
+}
+
+func (d *flakyDialer) Dial(ctx context.Context, addr *TelegramAddress) (net.Conn, error) {
+	if d.failures > 0 {
+		d.failures--
+		return nil, errors.New("unreachable")
+	}
+	client, server := net.Pipe()
+	go io.Copy(ioutil.Discard, server) // nolint: errcheck
+
+	return client, nil
+}
+
+func TestDialTelegramRetry(t *testing.T) {
+	conf := &config.Config{Retry: retry.Policy{Attempts: 2}}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+	addr := &TelegramAddresses[1]
+
+	srv.SetDialer(&flakyDialer{failures: 1})
+	conn, _, err := srv.dialTelegram(context.Background(), 2, addr, 1)
+	if assert.Nil(t, err) {
+		conn.Close() // nolint: errcheck
+	}
+
+	srv.SetDialer(&flakyDialer{failures: 2})
+	_, _, err = srv.dialTelegram(context.Background(), 2, addr, 1)
+	assert.NotNil(t, err)
+}
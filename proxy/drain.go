@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Drain stops accepting new connections and lets existing ones to
+// finish within given period. After that, remaining connections are
+// closed and Serve returns.
+func (s *Server) Drain(period time.Duration) {
+	s.drainOnce.Do(func() {
+		s.logger.Infow("Start draining",
+			"period", period.String(),
+			"active_connections", s.sessions.count(),
+		)
+
+		s.drainPeriod = period
+		s.stats.health.setDraining(true)
+		close(s.draining)
+		s.notifySystemd("STOPPING=1\n" + s.systemdStatus(true))
+	})
+}
+
+func (s *Server) waitDrained() {
+	if !s.sessions.waitTimeout(s.drainPeriod) {
+		s.logger.Infow("Drain period is over, close remaining connections",
+			"active_connections", s.sessions.count(),
+		)
+		s.sessions.closeAll()
+		s.sessions.wait.Wait()
+	}
+	s.logger.Infow("Draining is finished")
+}
+
+func (s *Server) drainHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if s.stats.refuseUnauthenticated(w) {
+		return
+	}
+
+	period := s.conf.DrainPeriod
+	if value := r.URL.Query().Get("period"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Incorrect period", http.StatusBadRequest)
+			return
+		}
+		period = parsed
+	}
+	s.Drain(period)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{ // nolint: errcheck, gas
+		"period":             s.drainPeriod.String(),
+		"active_connections": s.sessions.count(),
+	})
+}
@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestDrainHandler(t *testing.T) {
+	conf := &config.Config{Secret: []byte{1}}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+
+	recorder := httptest.NewRecorder()
+	srv.drainHandler(recorder, httptest.NewRequest(http.MethodPost, "/drain?period=0s", nil))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.False(t, srv.stats.health.isDraining())
+
+	conf.StatsToken = "token"
+	recorder = httptest.NewRecorder()
+	srv.drainHandler(recorder, httptest.NewRequest(http.MethodPost, "/drain?period=1m", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, srv.stats.health.isDraining())
+
+	recorder = httptest.NewRecorder()
+	srv.drainHandler(recorder, httptest.NewRequest(http.MethodGet, "/drain", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime/pprof"
+	"sort"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const dumpRedacted = "<redacted>"
+
+// WriteDump writes diagnostic snapshot of the server: configuration
+// without credentials, active sessions and stacks of all goroutines.
+func (s *Server) WriteDump(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "mtg diagnostic dump at %s\n\n== Config\n",
+		time.Now().Format(time.RFC3339)); err != nil {
+		return errors.Annotate(err, "Cannot write dump")
+	}
+
+	conf := *s.conf
+	conf.Secret = nil
+	for _, value := range []*string{&conf.StatsToken, &conf.StatsPassword, &conf.KnockToken} {
+		if *value != "" {
+			*value = dumpRedacted
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(conf); err != nil {
+		return errors.Annotate(err, "Cannot write config")
+	}
+
+	conns := s.sessions.list()
+	fmt.Fprintf(w, "\n== Sessions (%d)\n", len(conns)) // nolint: errcheck
+	for _, conn := range conns {
+		fmt.Fprintf(w, "%s %s\n", conn.socketID, conn.addr) // nolint: errcheck
+	}
+
+	fmt.Fprintf(w, "\n== Goroutines\n") // nolint: errcheck
+	if err := pprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		return errors.Annotate(err, "Cannot write goroutines")
+	}
+
+	return nil
+}
+
+type sessionInfo struct {
+	socketID SocketID
+	addr     string
+}
+
+func (s *sessions) list() []sessionInfo {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	infos := make([]sessionInfo, 0, len(s.conns))
+	for socketID, conn := range s.conns {
+		infos = append(infos, sessionInfo{socketID: socketID, addr: conn.RemoteAddr().String()})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].socketID < infos[j].socketID
+	})
+
+	return infos
+}
@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestWriteDump(t *testing.T) {
+	conf := &config.Config{Secret: []byte{1, 2, 3}, StatsToken: "token"}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+
+	client, server := net.Pipe()
+	defer server.Close() // nolint: errcheck
+	srv.sessions.add(42, client)
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, srv.WriteDump(buf))
+
+	dump := buf.String()
+	assert.Contains(t, dump, "== Sessions (1)\n42 pipe\n")
+	assert.Contains(t, dump, "\"StatsToken\": \""+dumpRedacted+"\"")
+	assert.NotContains(t, dump, "\"token\"")
+	assert.Contains(t, dump, "TestWriteDump")
+	assert.NotContains(t, dump, "AQID")
+	assert.Equal(t, "token", conf.StatsToken)
+}
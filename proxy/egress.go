@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"context"
+	"hash/fnv"
+	"net"
+	"sync/atomic"
+)
+
+// Strategies of choosing source address from the pool.
+const (
+	EgressRoundRobin = "round-robin"
+	EgressClientHash = "client-hash"
+)
+
+type clientAddrKey struct{}
+
+// ClientAddr returns address of the client for which Telegram
+// connection is dialed. It can be used by custom Dialer.
+func ClientAddr(ctx context.Context) net.Addr {
+	addr, _ := ctx.Value(clientAddrKey{}).(net.Addr)
+	return addr
+}
+
+func withClientAddr(ctx context.Context, addr net.Addr) context.Context {
+	return context.WithValue(ctx, clientAddrKey{}, addr)
+}
+
+// sourceIPs is a pool of local addresses for outgoing connections.
+// Addresses are used in round-robin order or chosen by hash of client
+// address, so the same client always goes out from the same address.
+type sourceIPs struct {
+	v4         []net.IP
+	v6         []net.IP
+	clientHash bool
+	counter    uint32
+}
+
+// next returns source address for given network (tcp4 or tcp6). If
+// there are no addresses of that family, nil is returned and kernel
+// chooses it.
+func (s *sourceIPs) next(network string, client net.Addr) net.IP {
+	if s == nil {
+		return nil
+	}
+
+	ips := s.v4
+	if network == "tcp6" {
+		ips = s.v6
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+
+	if s.clientHash {
+		if ip := addrIP(client); ip != nil {
+			hash := fnv.New32a()
+			hash.Write(ip) // nolint: errcheck
+			return ips[int(hash.Sum32()%uint32(len(ips)))]
+		}
+	}
+
+	return ips[int(atomic.AddUint32(&s.counter, 1)%uint32(len(ips)))]
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	}
+
+	return nil
+}
+
+func newSourceIPs(ips []net.IP, strategy string) *sourceIPs {
+	if len(ips) == 0 {
+		return nil
+	}
+
+	sources := &sourceIPs{clientHash: strategy == EgressClientHash}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			sources.v4 = append(sources.v4, ip)
+		} else {
+			sources.v6 = append(sources.v6, ip)
+		}
+	}
+
+	return sources
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"syscall"
+
+	"github.com/juju/errors"
+)
+
+const (
+	ipBindAddressNoPort = 24
+	ipLocalPortRange    = 51
+)
+
+// bindAddressNoPort postpones choice of local port until connect, so
+// the same port can be used for different destinations even if source
+// address is set explicitly.
+func bindAddressNoPort(fd uintptr) error {
+	err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, ipBindAddressNoPort, 1)
+	return errors.Annotate(err, "Cannot set IP_BIND_ADDRESS_NO_PORT")
+}
+
+// localPortRange returns control which restricts local ports of
+// outgoing connections. It requires Linux 6.3 or newer.
+func localPortRange(from, to uint16) (socketControl, error) {
+	value := int(uint32(to)<<16 | uint32(from))
+	control := func(fd uintptr) error {
+		err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, ipLocalPortRange, value)
+		return errors.Annotate(err, "Cannot set IP_LOCAL_PORT_RANGE")
+	}
+
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot create socket")
+	}
+	defer syscall.Close(fd) // nolint: errcheck
+
+	if err := control(uintptr(fd)); err != nil {
+		return nil, errors.Annotate(err, "Local port range is not supported by kernel")
+	}
+
+	return control, nil
+}
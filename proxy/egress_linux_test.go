@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalPortRange(t *testing.T) {
+	control, err := localPortRange(40000, 40010)
+	if err != nil {
+		t.Skip(err.Error())
+	}
+
+	lsock, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lsock.Close()
+
+	dialer := &tcpDialer{sources: newSourceIPs([]net.IP{net.ParseIP("127.0.0.1")}, EgressRoundRobin)}
+	assert.Nil(t, dialer.addControl(bindAddressNoPort))
+	assert.Nil(t, dialer.addControl(control))
+
+	conn, err := dialer.dial(context.Background(), "tcp4", lsock.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	port := conn.LocalAddr().(*net.TCPAddr).Port
+	assert.True(t, port >= 40000 && port <= 40010)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package proxy
+
+import "github.com/juju/errors"
+
+func bindAddressNoPort(fd uintptr) error {
+	return nil
+}
+
+func localPortRange(from, to uint16) (socketControl, error) {
+	return nil, errors.New("Local port range is supported only on Linux")
+}
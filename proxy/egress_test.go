@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceIPs(t *testing.T) {
+	first := net.ParseIP("10.0.0.1")
+	second := net.ParseIP("10.0.0.2")
+	v6 := net.ParseIP("2001:db8::1")
+	sources := newSourceIPs([]net.IP{first, v6, second}, EgressRoundRobin)
+
+	picked := []net.IP{sources.next("tcp4", nil), sources.next("tcp4", nil), sources.next("tcp4", nil)}
+	assert.Contains(t, picked, first)
+	assert.Contains(t, picked, second)
+	assert.Equal(t, v6, sources.next("tcp6", nil))
+}
+
+func TestSourceIPsClientHash(t *testing.T) {
+	ips := []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.3")}
+	sources := newSourceIPs(ips, EgressClientHash)
+
+	client := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1000}
+	samePort := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 2000}
+	picked := sources.next("tcp4", client)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, picked, sources.next("tcp4", client))
+		assert.Equal(t, picked, sources.next("tcp4", samePort))
+	}
+
+	used := map[string]bool{}
+	for i := 0; i < 256; i++ {
+		client := &net.TCPAddr{IP: net.IPv4(192, 0, 2, byte(i))}
+		used[sources.next("tcp4", client).String()] = true
+	}
+	assert.Len(t, used, len(ips))
+}
+
+func TestSourceIPsEmpty(t *testing.T) {
+	assert.Nil(t, newSourceIPs(nil, EgressRoundRobin).next("tcp4", nil))
+	assert.Nil(t, newSourceIPs([]net.IP{net.ParseIP("10.0.0.1")}, EgressRoundRobin).next("tcp6", nil))
+}
+
+func TestClientAddr(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1000}
+
+	assert.Nil(t, ClientAddr(context.Background()))
+	assert.Equal(t, addr, ClientAddr(withClientAddr(context.Background(), addr)))
+}
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/9seconds/mtg/ring"
+)
+
+// Names of session events which are kept in event ring only.
+const (
+	EventConnect         = "connect"
+	EventDisconnect      = "disconnect"
+	EventHandshakeFailed = "handshake_failed"
+	EventTelegramFailed  = "telegram_failed"
+	EventRejected        = "rejected"
+)
+
+// eventFilter selects events from the ring. Zero values match any
+// event.
+type eventFilter struct {
+	name     string
+	socketID string
+	ip       string
+	since    time.Time
+	limit    int
+}
+
+func (f *eventFilter) matches(event *Event) bool {
+	switch {
+	case f.name != "" && event.Name != f.name,
+		f.socketID != "" && event.SocketID != f.socketID,
+		event.Time.Before(f.since):
+		return false
+	case f.ip != "":
+		host, _, err := net.SplitHostPort(event.Addr)
+		return err == nil && host == f.ip
+	}
+
+	return true
+}
+
+// eventRing keeps last events, so operator can investigate incidents
+// without log shipping.
+type eventRing struct {
+	events *ring.Ring
+}
+
+func (r *eventRing) add(event Event) {
+	if r != nil {
+		r.events.Add(event)
+	}
+}
+
+// list returns matched events, newest first.
+func (r *eventRing) list(filter eventFilter) []Event {
+	events := []Event{}
+	items := r.events.Items()
+	for i := len(items) - 1; i >= 0 && (filter.limit <= 0 || len(events) < filter.limit); i-- {
+		if event := items[i].(Event); filter.matches(&event) {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+func newEventRing(size int) *eventRing {
+	if size <= 0 {
+		return nil
+	}
+
+	return &eventRing{events: ring.New(size)}
+}
+
+// recordSession adds event of client session to the ring. Extra event
+// data is given as key-value pairs like in Logger.
+func (s *Server) recordSession(name string, socketID SocketID, addr net.Addr, keysAndValues ...interface{}) {
+	if s.events == nil {
+		return
+	}
+
+	event := s.event(name, nil)
+	event.SocketID = socketID.String()
+	event.Addr = addr.String()
+	if len(keysAndValues) > 0 {
+		event.Data = make(map[string]interface{}, len(keysAndValues)/2)
+		for i := 0; i+1 < len(keysAndValues); i += 2 {
+			if key, ok := keysAndValues[i].(string); ok {
+				event.Data[key] = keysAndValues[i+1]
+			}
+		}
+	}
+	s.events.add(event)
+}
+
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := eventFilter{
+		name:     query.Get("event"),
+		socketID: query.Get("socketid"),
+		ip:       query.Get("ip"),
+	}
+
+	if value := query.Get("since"); value != "" {
+		if ago, err := time.ParseDuration(value); err == nil {
+			filter.since = time.Now().Add(-ago)
+		} else if filter.since, err = time.Parse(time.RFC3339, value); err != nil {
+			http.Error(w, "Incorrect since", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			http.Error(w, "Incorrect limit", http.StatusBadRequest)
+			return
+		}
+		filter.limit = limit
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(s.events.list(filter)) // nolint: errcheck, gas
+}
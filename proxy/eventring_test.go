@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestEventRingList(t *testing.T) {
+	ring := newEventRing(3)
+	now := time.Now()
+	for i, name := range []string{EventConnect, EventRejected, EventConnect, EventDisconnect} {
+		ring.add(Event{
+			Name:     name,
+			Time:     now.Add(time.Duration(i) * time.Second),
+			SocketID: SocketID(i).String(),
+			Addr:     net.JoinHostPort("10.0.0."+SocketID(i%2).String(), "1000"),
+		})
+	}
+
+	events := ring.list(eventFilter{})
+	assert.Len(t, events, 3)
+	assert.Equal(t, EventDisconnect, events[0].Name)
+	assert.Equal(t, EventRejected, events[2].Name)
+
+	assert.Equal(t, []string{"2"}, eventSocketIDs(ring.list(eventFilter{name: EventConnect})))
+	assert.Equal(t, []string{"3", "1"}, eventSocketIDs(ring.list(eventFilter{ip: "10.0.0.1"})))
+	assert.Equal(t, []string{"3"}, eventSocketIDs(ring.list(eventFilter{limit: 1})))
+	assert.Equal(t, []string{"3", "2"}, eventSocketIDs(ring.list(eventFilter{since: now.Add(2 * time.Second)})))
+
+	assert.Nil(t, newEventRing(0))
+}
+
+func eventSocketIDs(events []Event) []string {
+	ids := []string{}
+	for _, event := range events {
+		ids = append(ids, event.SocketID)
+	}
+
+	return ids
+}
+
+func TestEventsHandler(t *testing.T) {
+	conf := &config.Config{Secret: make([]byte, 16), EventBuffer: 10, MaxConnections: 1}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+
+	active, _ := net.Pipe()
+	srv.sessions.add(srv.makeSocketID(), active)
+	_, rejected := net.Pipe()
+	srv.accept(rejected)
+
+	recorder := httptest.NewRecorder()
+	srv.eventsHandler(recorder, httptest.NewRequest("GET", "/events?event=rejected&since=1m", nil))
+
+	events := []Event{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &events))
+	assert.Len(t, events, 1)
+	assert.Equal(t, "max_connections", events[0].Data["reason"])
+	assert.Equal(t, "2", events[0].SocketID)
+
+	recorder = httptest.NewRecorder()
+	srv.eventsHandler(recorder, httptest.NewRequest("GET", "/events?since=yesterday", nil))
+	assert.Equal(t, 400, recorder.Code)
+}
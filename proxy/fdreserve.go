@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	fdExhaustionMinPause = 5 * time.Millisecond
+	fdExhaustionMaxPause = time.Second
+)
+
+// fdReserve keeps one spare file descriptor. When process runs out of
+// descriptors, reserve is released so pending connection can be
+// accepted and closed instead of hanging in accept queue.
+type fdReserve struct {
+	file *os.File
+}
+
+func (r *fdReserve) release() {
+	if r.file != nil {
+		r.file.Close() // nolint: errcheck
+		r.file = nil
+	}
+}
+
+func (r *fdReserve) restore() {
+	if r.file == nil {
+		r.file, _ = os.Open(os.DevNull) // nolint: gas
+	}
+}
+
+func newFDReserve() *fdReserve {
+	reserve := &fdReserve{}
+	reserve.restore()
+
+	return reserve
+}
+
+// isFDExhaustion checks if error is caused by lack of file descriptors
+// in process (EMFILE) or in system (ENFILE).
+func isFDExhaustion(err error) bool {
+	err = unwrapSyscallError(err)
+	return err == syscall.EMFILE || err == syscall.ENFILE
+}
+
+// pauseOnFDExhaustion drops pending connection using reserved
+// descriptor and pauses accepting. Pause is doubled on each consecutive
+// exhaustion.
+func (s *Server) pauseOnFDExhaustion(lsock net.Listener, reserve *fdReserve, pause time.Duration, err error) time.Duration {
+	s.collector.AddFDExhaustion()
+	s.logger.Errorw("Cannot accept connection, file descriptors are exhausted",
+		"error", err,
+		"pause", pause,
+	)
+
+	reserve.release()
+	if conn, err := lsock.Accept(); err == nil {
+		setAbortiveClose(conn) // nolint: errcheck
+		conn.Close()           // nolint: errcheck
+	}
+	time.Sleep(pause)
+	reserve.restore()
+
+	if pause *= 2; pause > fdExhaustionMaxPause {
+		pause = fdExhaustionMaxPause
+	}
+
+	return pause
+}
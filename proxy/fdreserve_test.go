@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type pendingListener struct {
+	net.Listener
+	conns chan net.Conn
+}
+
+func (p *pendingListener) Accept() (net.Conn, error) {
+	return <-p.conns, nil
+}
+
+func TestIsFDExhaustion(t *testing.T) {
+	emfile := &net.OpError{Op: "accept", Err: os.NewSyscallError("accept4", syscall.EMFILE)}
+	enfile := &net.OpError{Op: "accept", Err: os.NewSyscallError("accept4", syscall.ENFILE)}
+	other := &net.OpError{Op: "accept", Err: os.NewSyscallError("accept4", syscall.ECONNABORTED)}
+
+	assert.True(t, isFDExhaustion(emfile))
+	assert.True(t, isFDExhaustion(enfile))
+	assert.False(t, isFDExhaustion(other))
+	assert.False(t, isFDExhaustion(errors.New("EMFILE")))
+}
+
+func TestPauseOnFDExhaustion(t *testing.T) {
+	conf := &config.Config{}
+	stat := NewStats(conf)
+	srv := NewServer(conf, zap.NewNop().Sugar(), stat)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	lsock := &pendingListener{conns: make(chan net.Conn, 1)}
+	lsock.conns <- server
+
+	reserve := newFDReserve()
+	defer reserve.release()
+
+	pause := srv.pauseOnFDExhaustion(lsock, reserve, fdExhaustionMaxPause/2+1, syscall.EMFILE)
+	assert.Equal(t, fdExhaustionMaxPause, pause)
+	assert.Equal(t, uint64(1), stat.FDExhaustions)
+	assert.NotNil(t, reserve.file)
+
+	_, err := client.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+}
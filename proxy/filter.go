@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"net"
+	"time"
+
+	"github.com/9seconds/mtg/geoip"
+)
+
+// asnFilter decides if clients from autonomous system are allowed.
+// Denied systems are rejected always. If allowed systems are set, all
+// other systems are rejected, including unknown ones.
+type asnFilter struct {
+	allow map[uint32]bool
+	deny  map[uint32]bool
+}
+
+func (f *asnFilter) allowed(asn uint32) bool {
+	if f.deny[asn] {
+		return false
+	}
+	if len(f.allow) > 0 {
+		return f.allow[asn]
+	}
+
+	return true
+}
+
+func newASNFilter(allow, deny []uint32) *asnFilter {
+	filter := &asnFilter{
+		allow: map[uint32]bool{},
+		deny:  map[uint32]bool{},
+	}
+	for _, asn := range allow {
+		filter.allow[asn] = true
+	}
+	for _, asn := range deny {
+		filter.deny[asn] = true
+	}
+
+	return filter
+}
+
+// isFiltered checks if client has to be rejected by filtering rules.
+func (s *Server) isFiltered(addr net.Addr, socketID SocketID) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	if s.knock != nil && !s.knock.isAllowed(tcpAddr.IP) {
+		s.collector.AddFilteredConnection()
+		s.logger.Debugw("Reject connection of client which has not knocked",
+			"socketid", socketID,
+			"addr", addr,
+		)
+		s.recordSession(EventRejected, socketID, addr, "reason", "knock")
+		return true
+	}
+	if s.asnDB == nil {
+		return false
+	}
+
+	asn, err := s.asnDB.ASN(tcpAddr.IP)
+	if err != nil {
+		s.logger.Debugw("Cannot find ASN of client", "socketid", socketID, "error", err)
+	}
+	if s.asnFilter.allowed(asn) {
+		return false
+	}
+
+	s.collector.AddFilteredConnection()
+	s.logger.Debugw("Reject connection by ASN filter",
+		"socketid", socketID,
+		"addr", addr,
+		"asn", asn,
+	)
+	s.recordSession(EventRejected, socketID, addr, "reason", "asn", "asn", asn)
+
+	return true
+}
+
+func (s *Server) openGeoIPDatabase(path string) *geoip.Database {
+	if path == "" {
+		return nil
+	}
+
+	db, err := geoip.OpenDatabase(path)
+	if err != nil {
+		s.logger.Warnw("Cannot open GeoIP database", "path", path, "error", err)
+		return nil
+	}
+
+	return db
+}
+
+// reloadGeoIPDatabases periodically rereads GeoIP databases to pick up
+// their updates.
+func (s *Server) reloadGeoIPDatabases(stopped <-chan struct{}) {
+	if s.conf.GeoIPReload <= 0 || (s.geoDB == nil && s.asnDB == nil) {
+		return
+	}
+
+	ticker := time.NewTicker(s.conf.GeoIPReload)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+		}
+
+		for _, db := range []*geoip.Database{s.geoDB, s.asnDB} {
+			if db == nil {
+				continue
+			}
+			if err := db.Reload(); err != nil {
+				s.logger.Warnw("Cannot reload GeoIP database", "path", db.Path(), "error", err)
+			} else {
+				s.logger.Debugw("GeoIP database is reloaded", "path", db.Path())
+			}
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestASNFilterDeny(t *testing.T) {
+	filter := newASNFilter(nil, []uint32{64500})
+
+	assert.False(t, filter.allowed(64500))
+	assert.True(t, filter.allowed(64501))
+	assert.True(t, filter.allowed(0))
+}
+
+func TestASNFilterAllow(t *testing.T) {
+	filter := newASNFilter([]uint32{64500, 64501}, []uint32{64501})
+
+	assert.True(t, filter.allowed(64500))
+	assert.False(t, filter.allowed(64501))
+	assert.False(t, filter.allowed(64502))
+	assert.False(t, filter.allowed(0))
+}
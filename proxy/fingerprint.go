@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/juju/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const fingerprintHeadSize = 16
+
+// handshakeProbe records what client has sent before its handshake has
+// failed and how fast it was.
+type handshakeProbe struct {
+	startedAt   time.Time
+	firstByteAt time.Time
+	frame       []byte
+}
+
+// wrap returns reader which records time of the first received byte.
+func (h *handshakeProbe) wrap(r io.Reader) io.Reader {
+	return &probeReader{reader: r, probe: h}
+}
+
+type probeReader struct {
+	reader io.Reader
+	probe  *handshakeProbe
+}
+
+func (p *probeReader) Read(buf []byte) (int, error) {
+	n, err := p.reader.Read(buf)
+	if n > 0 && p.probe.firstByteAt.IsZero() {
+		p.probe.firstByteAt = time.Now()
+	}
+
+	return n, err
+}
+
+func newHandshakeProbe() *handshakeProbe {
+	return &handshakeProbe{startedAt: time.Now()}
+}
+
+// logFingerprint writes fingerprint of a client which has failed
+// handshake into separate log. It helps to characterize active probing.
+func (s *Server) logFingerprint(conn net.Conn, socketID SocketID, country string, probe *handshakeProbe, err error) {
+	if s.fingerprints == nil {
+		return
+	}
+
+	kind := "none"
+	if len(probe.frame) > 0 {
+		kind = detectHandshakeTraffic(probe.frame)
+	}
+	head := probe.frame
+	if len(head) > fingerprintHeadSize {
+		head = head[:fingerprintHeadSize]
+	}
+	hash := sha256.Sum256(probe.frame)
+
+	fields := []zap.Field{
+		zap.Stringer("socketid", socketID),
+		zap.Stringer("addr", conn.RemoteAddr()),
+		zap.String("kind", kind),
+		zap.Int("bytes", len(probe.frame)),
+		zap.String("sha256", hex.EncodeToString(hash[:])),
+		zap.String("head", hex.EncodeToString(head)),
+		zap.Duration("duration", time.Since(probe.startedAt)),
+		zap.Error(err),
+	}
+	if country != "" {
+		fields = append(fields, zap.String("country", country))
+	}
+	if !probe.firstByteAt.IsZero() {
+		fields = append(fields, zap.Duration("first_byte", probe.firstByteAt.Sub(probe.startedAt)))
+	}
+	fields = append(fields, tcpFingerprint(conn)...)
+
+	s.fingerprints.Info("Handshake has failed", fields...)
+}
+
+// openFingerprintLog creates logger which appends JSON lines to the
+// file.
+func openFingerprintLog(path string) (*zap.Logger, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640) // nolint: gas
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot open fingerprint log")
+	}
+
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoderConfig.EncodeDuration = zapcore.StringDurationEncoder
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), zapcore.Lock(file), zapcore.InfoLevel)
+
+	return zap.New(core), nil
+}
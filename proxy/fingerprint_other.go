@@ -0,0 +1,14 @@
+//go:build !linux || !(amd64 || arm64)
+// +build !linux !amd64,!arm64
+
+package proxy
+
+import (
+	"net"
+
+	"go.uber.org/zap"
+)
+
+func tcpFingerprint(conn net.Conn) []zap.Field {
+	return nil
+}
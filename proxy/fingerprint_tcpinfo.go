@@ -0,0 +1,65 @@
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+package proxy
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+
+	"go.uber.org/zap"
+)
+
+// Flags of tcpi_options.
+const (
+	tcpiOptTimestamps = 1
+	tcpiOptSACK       = 2
+	tcpiOptWscale     = 4
+	tcpiOptECN        = 8
+)
+
+// tcpFingerprint returns TCP parameters client has negotiated. They
+// depend on client OS and network stack.
+func tcpFingerprint(conn net.Conn) []zap.Field {
+	sconn, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	raw, err := sconn.SyscallConn()
+	if err != nil {
+		return nil
+	}
+
+	var info syscall.TCPInfo
+	var errno syscall.Errno
+	size := uint32(unsafe.Sizeof(info))
+	err = raw.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd,
+			syscall.IPPROTO_TCP, syscall.TCP_INFO,
+			uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&size)), 0)
+	})
+	if err != nil || errno != 0 {
+		return nil
+	}
+
+	return []zap.Field{
+		zap.Bool("tcp_timestamps", info.Options&tcpiOptTimestamps != 0),
+		zap.Bool("tcp_sack", info.Options&tcpiOptSACK != 0),
+		zap.Bool("tcp_ecn", info.Options&tcpiOptECN != 0),
+		zap.Int("tcp_wscale", tcpWscale(info)),
+		zap.Uint32("tcp_mss", info.Snd_mss),
+		zap.Uint32("tcp_rtt_us", info.Rtt),
+	}
+}
+
+// tcpWscale returns window scale client has sent or -1 if window
+// scaling is off. It is stored in lower 4 bits after options.
+func tcpWscale(info syscall.TCPInfo) int {
+	if info.Options&tcpiOptWscale == 0 {
+		return -1
+	}
+
+	return int(info.Pad_cgo_0[0] & 0x0f)
+}
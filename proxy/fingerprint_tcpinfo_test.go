@@ -0,0 +1,31 @@
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+package proxy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTCPFingerprint(t *testing.T) {
+	lsock, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lsock.Close()
+
+	client, err := net.Dial("tcp", lsock.Addr().String())
+	assert.Nil(t, err)
+	defer client.Close()
+	server, err := lsock.Accept()
+	assert.Nil(t, err)
+	defer server.Close()
+
+	fields := tcpFingerprint(server)
+	assert.Len(t, fields, 6)
+	assert.Equal(t, "tcp_sack", fields[1].Key)
+	assert.Equal(t, int64(1), fields[1].Integer)
+	assert.Nil(t, tcpFingerprint(&net.UnixConn{}))
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestFingerprintLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fingerprint")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := &config.Config{
+		Secret:         make([]byte, 16),
+		ReadTimeout:    time.Second,
+		WriteTimeout:   time.Second,
+		FingerprintLog: filepath.Join(dir, "fingerprints.log"),
+	}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")) // nolint: errcheck
+		client.Close()
+	}()
+	srv.accept(server)
+
+	data, err := ioutil.ReadFile(conf.FingerprintLog)
+	assert.Nil(t, err)
+
+	var entry map[string]interface{}
+	assert.Nil(t, json.Unmarshal(data, &entry))
+	assert.Equal(t, trafficHTTP, entry["kind"])
+	assert.Equal(t, float64(37), entry["bytes"])
+	assert.Equal(t, "474554202f20485454502f312e310d0a", entry["head"])
+	assert.Contains(t, entry, "first_byte")
+	assert.Contains(t, entry, "sha256")
+}
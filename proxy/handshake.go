@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"net"
+
+	"github.com/9seconds/mtg/obfuscated2"
+	"github.com/juju/errors"
+)
+
+// Reasons of failed client handshakes.
+const (
+	handshakeBadSecret    = "bad_secret"
+	handshakeBadTransport = "bad_transport"
+	handshakeTimeout      = "timeout"
+	handshakeClosed       = "closed"
+)
+
+// handshakeFailureReason tells why client handshake has failed. Wrong
+// secret cannot be distinguished from random garbage, both are reported
+// as bad secret.
+func handshakeFailureReason(err error) string {
+	cause := errors.Cause(err)
+	switch cause {
+	case obfuscated2.ErrUnknownProtocol:
+		return handshakeBadSecret
+	case obfuscated2.ErrUnsupportedTransport:
+		return handshakeBadTransport
+	}
+
+	if netErr, ok := cause.(net.Error); ok && netErr.Timeout() {
+		return handshakeTimeout
+	}
+
+	return handshakeClosed
+}
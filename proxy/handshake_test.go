@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/9seconds/mtg/obfuscated2"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestHandshakeFailureReason(t *testing.T) {
+	assert.Equal(t, handshakeBadSecret,
+		handshakeFailureReason(errors.Annotate(obfuscated2.ErrUnknownProtocol, "Cannot create client stream")))
+	assert.Equal(t, handshakeBadTransport,
+		handshakeFailureReason(errors.Annotate(obfuscated2.ErrUnsupportedTransport, "Cannot create client stream")))
+	assert.Equal(t, handshakeTimeout,
+		handshakeFailureReason(errors.Annotate(timeoutError{}, "Cannot extract obfuscated header")))
+	assert.Equal(t, handshakeClosed,
+		handshakeFailureReason(errors.Annotate(io.EOF, "Cannot extract obfuscated header")))
+}
+
+func TestAcceptReportsNonMTProto(t *testing.T) {
+	conf := &config.Config{
+		Secret:       make([]byte, 16),
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+	}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+
+	handshake := func(data []byte) {
+		client, server := net.Pipe()
+		done := make(chan struct{})
+		go func() {
+			srv.accept(server)
+			close(done)
+		}()
+		client.Write(data) // nolint: errcheck
+		client.Close()     // nolint: errcheck
+		<-done
+	}
+
+	handshake(bytes.Repeat([]byte{0xa5}, obfuscated2.FrameLen))
+	handshake([]byte{0xa5, 0xa5})
+	assert.Equal(t, uint64(0), srv.stats.NonMTProto.Unknown)
+	assert.Equal(t, uint64(1), srv.stats.HandshakeFailures.BadSecret)
+	assert.Equal(t, uint64(1), srv.stats.HandshakeFailures.Closed)
+
+	handshake(append([]byte("GET / HTTP/1.1\r\n"), make([]byte, obfuscated2.FrameLen)...))
+	assert.Equal(t, uint64(1), srv.stats.NonMTProto.HTTP)
+}
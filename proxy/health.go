@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const healthCheckInterval = 10 * time.Second
+
+// health keeps liveness and readiness state of the proxy. Proxy is alive
+// while its accept loop is running. Proxy is ready when at least one
+// Telegram datacenter was reachable and it is not draining.
+type health struct {
+	alive    uint32
+	ready    uint32
+	draining uint32
+}
+
+func (h *health) setAlive(alive bool) {
+	atomic.StoreUint32(&h.alive, boolToUint32(alive))
+}
+
+func (h *health) setReady(ready bool) {
+	atomic.StoreUint32(&h.ready, boolToUint32(ready))
+}
+
+func (h *health) setDraining(draining bool) {
+	atomic.StoreUint32(&h.draining, boolToUint32(draining))
+}
+
+func (h *health) isAlive() bool {
+	return atomic.LoadUint32(&h.alive) == 1
+}
+
+func (h *health) isDraining() bool {
+	return atomic.LoadUint32(&h.draining) == 1
+}
+
+func (h *health) isReady() bool {
+	return h.isAlive() && atomic.LoadUint32(&h.ready) == 1 && !h.isDraining()
+}
+
+func (h *health) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeProbeResponse(w, h.isAlive())
+}
+
+func (h *health) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	writeProbeResponse(w, h.isReady())
+}
+
+func writeProbeResponse(w http.ResponseWriter, ok bool) {
+	w.Header().Set("Content-Type", "text/plain")
+
+	if ok {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok\n")) // nolint: errcheck, gas
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("fail\n")) // nolint: errcheck, gas
+	}
+}
+
+func boolToUint32(value bool) uint32 {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthHandlers(t *testing.T) {
+	tests := []struct {
+		name      string
+		alive     bool
+		ready     bool
+		draining  bool
+		liveness  int
+		readiness int
+	}{
+		{"not started", false, true, false, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+		{"not ready", true, false, false, http.StatusOK, http.StatusServiceUnavailable},
+		{"ready", true, true, false, http.StatusOK, http.StatusOK},
+		{"draining", true, true, true, http.StatusOK, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		stat := NewStats(&config.Config{})
+		stat.health.setAlive(tt.alive)
+		stat.health.setReady(tt.ready)
+		stat.health.setDraining(tt.draining)
+
+		for path, code := range map[string]int{"/healthz": tt.liveness, "/readyz": tt.readiness} {
+			recorder := httptest.NewRecorder()
+			stat.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+			assert.Equal(t, code, recorder.Code, tt.name+" "+path)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// SessionInfo is a metadata of client session passed to hooks.
+// BytesIn is an amount of bytes received from client, BytesOut is an
+// amount of bytes sent to client. BytesIn, BytesOut and Duration are
+// filled for disconnect hooks only. Country is filled if GeoIP
+// database is configured. Secret is a copy, hooks may keep it.
+type SessionInfo struct {
+	SocketID  SocketID
+	Addr      net.Addr
+	Country   string
+	Secret    []byte
+	DC        int16
+	BytesIn   uint64
+	BytesOut  uint64
+	StartedAt time.Time
+	Duration  time.Duration
+}
+
+// Hook is a callback which is executed on session start or end. Hooks
+// are called synchronously, so they have to be fast.
+type Hook func(SessionInfo)
+
+// OnConnect registers hook which is called when client has finished
+// handshake and Telegram connection is established. It has to be
+// called before Serve.
+func (s *Server) OnConnect(hook Hook) {
+	s.connectHooks = append(s.connectHooks, hook)
+}
+
+// OnDisconnect registers hook which is called when session, reported to
+// OnConnect hooks, is finished. It has to be called before Serve.
+func (s *Server) OnDisconnect(hook Hook) {
+	s.disconnectHooks = append(s.disconnectHooks, hook)
+}
+
+func (s *Server) runHooks(hooks []Hook, info SessionInfo) {
+	for _, hook := range hooks {
+		hook(info)
+	}
+}
+
+// sessionTraffic counts client traffic of a single session.
+type sessionTraffic struct {
+	in  uint64
+	out uint64
+}
+
+func (t *sessionTraffic) addIn(n int) {
+	atomic.AddUint64(&t.in, uint64(n))
+}
+
+func (t *sessionTraffic) addOut(n int) {
+	atomic.AddUint64(&t.out, uint64(n))
+}
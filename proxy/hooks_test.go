@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/9seconds/mtg/obfuscated2"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// echoDialer skips handshake frame and echoes everything else back.
+type echoDialer struct{}
+
+func (echoDialer) Dial(ctx context.Context, addr *TelegramAddress) (net.Conn, error) {
+	client, server := net.Pipe()
+	go func() {
+		io.CopyN(ioutil.Discard, server, obfuscated2.FrameLen) // nolint: errcheck
+		io.Copy(server, server)                                // nolint: errcheck
+	}()
+
+	return client, nil
+}
+
+func TestAcceptHooks(t *testing.T) {
+	secret := make([]byte, 16)
+	conf := &config.Config{
+		Secret:          secret,
+		ReadTimeout:     time.Minute,
+		WriteTimeout:    time.Minute,
+		RelayBufferSize: 1024,
+	}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+	srv.SetDialer(echoDialer{})
+
+	connected := make(chan SessionInfo, 1)
+	disconnected := make(chan SessionInfo, 1)
+	srv.OnConnect(func(info SessionInfo) { connected <- info })
+	srv.OnDisconnect(func(info SessionInfo) { disconnected <- info })
+
+	client, server := net.Pipe()
+	go srv.accept(server)
+
+	obfs, frame := obfuscated2.MakeClientObfuscated2Frame(secret, -3)
+	_, err := client.Write(frame)
+	assert.Nil(t, err)
+	_, err = client.Write(obfs.Encrypt([]byte("ping")))
+	assert.Nil(t, err)
+	_, err = io.ReadFull(client, make([]byte, 4))
+	assert.Nil(t, err)
+
+	info := <-connected
+	assert.Equal(t, int16(-3), info.DC)
+	assert.Equal(t, secret, info.Secret)
+	info.Secret[0] = 0xff
+	assert.Equal(t, byte(0), conf.Secret[0])
+	assert.Zero(t, info.BytesIn)
+	assert.Zero(t, info.BytesOut)
+	assert.Zero(t, info.Duration)
+
+	time.Sleep(10 * time.Millisecond)
+	client.Close() // nolint: errcheck
+	select {
+	case info = <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Disconnect hook is not called")
+	}
+	assert.Equal(t, int16(-3), info.DC)
+	assert.Equal(t, uint64(obfuscated2.FrameLen+4), info.BytesIn)
+	assert.Equal(t, uint64(4), info.BytesOut)
+	assert.True(t, info.Duration >= 10*time.Millisecond)
+}
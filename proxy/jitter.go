@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// jitterBufferSize is an amount of data after which buffered writes are
+// flushed without waiting for the delay.
+const jitterBufferSize = 16 * 1024
+
+// JitterReadWriteCloser delays writes for a random time up to maxDelay
+// and coalesces writes done within this time into a single one. It
+// blurs timing and sizes of MTPROTO packets sent to client. Write errors
+// are returned by the next operation.
+type JitterReadWriteCloser struct {
+	conn     io.ReadWriteCloser
+	maxDelay time.Duration
+
+	mutex sync.Mutex
+	buf   []byte
+	timer *time.Timer
+	err   error
+}
+
+// Read reads from connection
+func (j *JitterReadWriteCloser) Read(p []byte) (int, error) {
+	return j.conn.Read(p)
+}
+
+// Write writes into connection.
+func (j *JitterReadWriteCloser) Write(p []byte) (int, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.err != nil {
+		return 0, j.err
+	}
+
+	j.buf = append(j.buf, p...)
+	if len(j.buf) >= jitterBufferSize {
+		j.flush()
+		if j.err != nil {
+			return 0, j.err
+		}
+	} else if j.timer == nil {
+		delay := time.Duration(rand.Int63n(int64(j.maxDelay)) + 1)
+		j.timer = time.AfterFunc(delay, j.flushLocked)
+	}
+
+	return len(p), nil
+}
+
+// CloseWrite flushes buffered data and closes writing side of
+// underlying connection.
+func (j *JitterReadWriteCloser) CloseWrite() error {
+	j.mutex.Lock()
+	j.flush()
+	err := j.err
+	j.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return closeWrite(j.conn)
+}
+
+// Close flushes buffered data and closes underlying connection.
+func (j *JitterReadWriteCloser) Close() error {
+	j.mutex.Lock()
+	j.flush()
+	j.mutex.Unlock()
+
+	return j.conn.Close()
+}
+
+func (j *JitterReadWriteCloser) flushLocked() {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.flush()
+}
+
+// flush writes buffered data. It has to be called with locked mutex,
+// so data is written in order.
+func (j *JitterReadWriteCloser) flush() {
+	if j.timer != nil {
+		j.timer.Stop()
+		j.timer = nil
+	}
+	if len(j.buf) == 0 || j.err != nil {
+		return
+	}
+
+	_, j.err = j.conn.Write(j.buf)
+	j.buf = j.buf[:0]
+}
+
+func newJitterReadWriteCloser(conn io.ReadWriteCloser, maxDelay time.Duration) io.ReadWriteCloser {
+	return &JitterReadWriteCloser{
+		conn:     conn,
+		maxDelay: maxDelay,
+	}
+}
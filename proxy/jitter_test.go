@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingReadWriteCloser struct {
+	mutex  sync.Mutex
+	writes [][]byte
+	closed bool
+}
+
+func (r *recordingReadWriteCloser) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (r *recordingReadWriteCloser) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.writes = append(r.writes, append([]byte{}, p...))
+	return len(p), nil
+}
+
+func (r *recordingReadWriteCloser) Close() error {
+	r.closed = true
+	return nil
+}
+
+func (r *recordingReadWriteCloser) written() [][]byte {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.writes
+}
+
+func TestJitterCoalescesWrites(t *testing.T) {
+	conn := &recordingReadWriteCloser{}
+	jitter := newJitterReadWriteCloser(conn, 50*time.Millisecond)
+
+	jitter.Write([]byte{1, 2}) // nolint: errcheck
+	jitter.Write([]byte{3})    // nolint: errcheck
+	assert.Len(t, conn.written(), 0)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, [][]byte{{1, 2, 3}}, conn.written())
+}
+
+func TestJitterFlushesFullBuffer(t *testing.T) {
+	conn := &recordingReadWriteCloser{}
+	jitter := newJitterReadWriteCloser(conn, time.Hour)
+
+	jitter.Write(make([]byte, jitterBufferSize)) // nolint: errcheck
+	assert.Len(t, conn.written(), 1)
+
+	jitter.Write([]byte{1}) // nolint: errcheck
+	assert.Nil(t, jitter.Close())
+	assert.Equal(t, []byte{1}, conn.written()[1])
+	assert.True(t, conn.closed)
+}
+
+type discardReadWriteCloser struct {
+	io.Writer
+}
+
+func (discardReadWriteCloser) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (discardReadWriteCloser) Close() error {
+	return nil
+}
+
+// benchmarkBulk writes 1 MiB in 1 KiB chunks, like download of a file.
+func benchmarkBulk(b *testing.B, wrap func(io.ReadWriteCloser) io.ReadWriteCloser) {
+	data := bytes.Repeat([]byte{1}, 1024*1024)
+	b.SetBytes(int64(len(data)))
+
+	for i := 0; i < b.N; i++ {
+		conn := wrap(discardReadWriteCloser{ioutil.Discard})
+		for offset := 0; offset < len(data); offset += 1024 {
+			conn.Write(data[offset : offset+1024]) // nolint: errcheck
+		}
+		conn.Close() // nolint: errcheck
+	}
+}
+
+type notifyingWriter chan struct{}
+
+func (n notifyingWriter) Write(p []byte) (int, error) {
+	n <- struct{}{}
+	return len(p), nil
+}
+
+// benchmarkRoundTrip writes single small packet and waits until it is
+// delivered, like a response to interactive request.
+func benchmarkRoundTrip(b *testing.B, wrap func(io.ReadWriteCloser) io.ReadWriteCloser) {
+	delivered := make(notifyingWriter, 1)
+	conn := wrap(discardReadWriteCloser{delivered})
+	packet := make([]byte, 256)
+
+	for i := 0; i < b.N; i++ {
+		conn.Write(packet) // nolint: errcheck
+		<-delivered
+	}
+}
+
+func noJitter(conn io.ReadWriteCloser) io.ReadWriteCloser {
+	return conn
+}
+
+func withJitter(conn io.ReadWriteCloser) io.ReadWriteCloser {
+	return newJitterReadWriteCloser(conn, 5*time.Millisecond)
+}
+
+func BenchmarkBulkNoJitter(b *testing.B) {
+	benchmarkBulk(b, noJitter)
+}
+
+func BenchmarkBulkJitter(b *testing.B) {
+	benchmarkBulk(b, withJitter)
+}
+
+func BenchmarkRoundTripNoJitter(b *testing.B) {
+	benchmarkRoundTrip(b, noJitter)
+}
+
+func BenchmarkRoundTripJitter(b *testing.B) {
+	benchmarkRoundTrip(b, withJitter)
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// keepAlive is a configuration of TCP keepalive. After idle period of
+// silence kernel sends probes every interval, and if probes of them are
+// not answered, connection is broken. Zero idle disables keepalive, zero
+// interval and probes keep system defaults.
+type keepAlive struct {
+	idle     time.Duration
+	interval time.Duration
+	probes   int
+}
+
+type keepAliveSetter interface {
+	SetKeepAlive(bool) error
+	SetKeepAlivePeriod(time.Duration) error
+}
+
+// setKeepAlive applies keepalive configuration to TCP connection. Other
+// connections are left as is.
+func setKeepAlive(conn net.Conn, config keepAlive) error {
+	setter, ok := conn.(keepAliveSetter)
+	if !ok {
+		return nil
+	}
+
+	if config.idle <= 0 {
+		return errors.Annotate(setter.SetKeepAlive(false), "Cannot disable keepalive")
+	}
+	if err := setter.SetKeepAlive(true); err != nil {
+		return errors.Annotate(err, "Cannot establish keepalive connection")
+	}
+	if err := setter.SetKeepAlivePeriod(config.idle); err != nil {
+		return errors.Annotate(err, "Cannot set keepalive timeout")
+	}
+
+	return setKeepAliveProbes(conn, config.interval, config.probes)
+}
+
+// DeadPeerReadWriteCloser reports connection which is broken because
+// peer has not answered keepalive probes. It usually means that NAT
+// mapping of the mobile client has expired.
+type DeadPeerReadWriteCloser struct {
+	conn     io.ReadWriteCloser
+	reported bool
+	onDead   func()
+}
+
+// Read reads from connection
+func (d *DeadPeerReadWriteCloser) Read(p []byte) (int, error) {
+	n, err := d.conn.Read(p)
+	d.check(err)
+
+	return n, err
+}
+
+// Write writes into connection.
+func (d *DeadPeerReadWriteCloser) Write(p []byte) (int, error) {
+	n, err := d.conn.Write(p)
+	d.check(err)
+
+	return n, err
+}
+
+// CloseWrite closes writing side of underlying connection.
+func (d *DeadPeerReadWriteCloser) CloseWrite() error {
+	return closeWrite(d.conn)
+}
+
+// Close closes underlying connection.
+func (d *DeadPeerReadWriteCloser) Close() error {
+	return d.conn.Close()
+}
+
+// check reports dead peer once. Both directions fail with the same
+// error, so only the first one is reported.
+func (d *DeadPeerReadWriteCloser) check(err error) {
+	if err == nil || d.reported || !isDeadPeer(err) {
+		return
+	}
+	d.reported = true
+	d.onDead()
+}
+
+// isDeadPeer tells if connection was broken by keepalive. Deadlines set
+// by proxy fail with different error.
+func isDeadPeer(err error) bool {
+	return unwrapSyscallError(errors.Cause(err)) == syscall.ETIMEDOUT
+}
+
+func newDeadPeerReadWriteCloser(conn io.ReadWriteCloser, onDead func()) io.ReadWriteCloser {
+	return &DeadPeerReadWriteCloser{
+		conn:   conn,
+		onDead: onDead,
+	}
+}
@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// setKeepAliveProbes sets interval between keepalive probes and their
+// number.
+func setKeepAliveProbes(conn net.Conn, interval time.Duration, probes int) error {
+	sconn, ok := conn.(syscall.Conn)
+	if !ok || (interval <= 0 && probes <= 0) {
+		return nil
+	}
+	raw, err := sconn.SyscallConn()
+	if err != nil {
+		return errors.Annotate(err, "Cannot get raw socket")
+	}
+
+	var controlErr error
+	err = raw.Control(func(fd uintptr) {
+		if interval > 0 {
+			seconds := int((interval + time.Second - 1) / time.Second)
+			controlErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, seconds)
+		}
+		if controlErr == nil && probes > 0 {
+			controlErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, probes)
+		}
+	})
+	if err == nil {
+		err = controlErr
+	}
+
+	return errors.Annotate(err, "Cannot set keepalive probes")
+}
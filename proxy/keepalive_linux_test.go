@@ -0,0 +1,29 @@
+package proxy
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetKeepAlive(t *testing.T) {
+	lsock, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lsock.Close()
+
+	conn, err := net.Dial("tcp", lsock.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	assert.Nil(t, setKeepAlive(conn, keepAlive{idle: 20 * time.Second, interval: 5 * time.Second, probes: 4}))
+	assert.Equal(t, 1, getSocketOption(t, conn, syscall.SO_KEEPALIVE))
+	assert.Equal(t, 20, getTCPOption(t, conn.(syscall.Conn), syscall.TCP_KEEPIDLE))
+	assert.Equal(t, 5, getTCPOption(t, conn.(syscall.Conn), syscall.TCP_KEEPINTVL))
+	assert.Equal(t, 4, getTCPOption(t, conn.(syscall.Conn), syscall.TCP_KEEPCNT))
+
+	assert.Nil(t, setKeepAlive(conn, keepAlive{}))
+	assert.Equal(t, 0, getSocketOption(t, conn, syscall.SO_KEEPALIVE))
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package proxy
+
+import (
+	"net"
+	"time"
+)
+
+// setKeepAliveProbes does nothing, interval and number of keepalive
+// probes are tuned only on Linux. Go uses keepalive period as interval.
+func setKeepAliveProbes(conn net.Conn, interval time.Duration, probes int) error {
+	return nil
+}
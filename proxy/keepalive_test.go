@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingReadWriteCloser struct {
+	err error
+}
+
+func (f failingReadWriteCloser) Read(p []byte) (int, error) {
+	return 0, f.err
+}
+
+func (f failingReadWriteCloser) Write(p []byte) (int, error) {
+	return 0, f.err
+}
+
+func (f failingReadWriteCloser) Close() error {
+	return nil
+}
+
+func TestDeadPeerReadWriteCloser(t *testing.T) {
+	reported := 0
+	err := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ETIMEDOUT)}
+	conn := newDeadPeerReadWriteCloser(failingReadWriteCloser{err: err}, func() {
+		reported++
+	})
+
+	_, readErr := conn.Read(make([]byte, 1))
+	assert.Equal(t, err, readErr)
+	conn.Write([]byte{1}) // nolint: errcheck
+	assert.Equal(t, 1, reported)
+}
+
+func TestDeadPeerOtherErrors(t *testing.T) {
+	conn := newDeadPeerReadWriteCloser(failingReadWriteCloser{err: errors.New("i/o timeout")}, func() {
+		t.Fatal("Dead peer is reported")
+	})
+
+	conn.Read(make([]byte, 1)) // nolint: errcheck
+}
+
+func TestSetKeepAliveNotTCP(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	assert.Nil(t, setKeepAlive(client, keepAlive{idle: 1}))
+}
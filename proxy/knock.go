@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const knockPacketSize = 512
+
+// knockGate keeps addresses of clients which have knocked with correct
+// token. Only they may connect to the proxy within knock period.
+type knockGate struct {
+	mutex   sync.Mutex
+	token   []byte
+	period  time.Duration
+	allowed map[string]time.Time
+}
+
+func (k *knockGate) knock(ip net.IP, token []byte) bool {
+	if subtle.ConstantTimeCompare(k.token, token) != 1 {
+		return false
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	now := time.Now()
+	for key, deadline := range k.allowed {
+		if now.After(deadline) {
+			delete(k.allowed, key)
+		}
+	}
+	k.allowed[string(ip.To16())] = now.Add(k.period)
+
+	return true
+}
+
+func (k *knockGate) isAllowed(ip net.IP) bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	deadline, ok := k.allowed[string(ip.To16())]
+	return ok && time.Now().Before(deadline)
+}
+
+func newKnockGate(token string, period time.Duration) *knockGate {
+	return &knockGate{
+		token:   []byte(token),
+		period:  period,
+		allowed: map[string]time.Time{},
+	}
+}
+
+// serveKnockUDP accepts knock packets which contain token only. Nothing
+// is sent back, so closed port and wrong token look the same.
+func (s *Server) serveKnockUDP(stopped <-chan struct{}) {
+	conn, err := net.ListenPacket("udp", s.conf.KnockAddr())
+	if err != nil {
+		s.logger.Errorw("Cannot listen for knock packets", "error", err)
+		return
+	}
+	go func() {
+		<-stopped
+		conn.Close() // nolint: errcheck
+	}()
+
+	buf := make([]byte, knockPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-stopped:
+				return
+			default:
+				s.logger.Debugw("Cannot read knock packet", "error", err)
+				continue
+			}
+		}
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		if s.knock.knock(udpAddr.IP, []byte(strings.TrimSpace(string(buf[:n])))) {
+			s.logger.Debugw("Client has knocked", "addr", addr)
+		}
+	}
+}
+
+// knockHandler allows address of HTTP client if it has passed correct
+// token in token query parameter. Wrong token gets the same response as
+// unknown URL.
+func (s *Server) knockHandler(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	ip := net.ParseIP(host)
+	if err != nil || ip == nil || !s.knock.knock(ip, []byte(r.URL.Query().Get("token"))) {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.logger.Debugw("Client has knocked", "addr", r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestKnockGate(t *testing.T) {
+	gate := newKnockGate("token", 50*time.Millisecond)
+	ip := net.ParseIP("192.0.2.1")
+
+	assert.False(t, gate.knock(ip, []byte("wrong")))
+	assert.False(t, gate.isAllowed(ip))
+
+	assert.True(t, gate.knock(ip, []byte("token")))
+	assert.True(t, gate.isAllowed(ip))
+	assert.True(t, gate.isAllowed(net.ParseIP("::ffff:192.0.2.1")))
+	assert.False(t, gate.isAllowed(net.ParseIP("192.0.2.2")))
+
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, gate.isAllowed(ip))
+}
+
+func TestKnockUDP(t *testing.T) {
+	probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	port := probe.LocalAddr().(*net.UDPAddr).Port
+	probe.Close()
+
+	conf := &config.Config{
+		BindIP:      net.ParseIP("127.0.0.1"),
+		KnockToken:  "token",
+		KnockPort:   uint16(port),
+		KnockPeriod: time.Minute,
+	}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go srv.serveKnockUDP(stopped)
+
+	client := &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}
+	assert.True(t, srv.isFiltered(client, 1))
+
+	conn, err := net.Dial("udp", conf.KnockAddr())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	for i := 0; i < 50 && srv.isFiltered(client, 1); i++ {
+		conn.Write([]byte("token\n")) // nolint: errcheck
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.False(t, srv.isFiltered(client, 1))
+}
+
+func TestKnockHTTP(t *testing.T) {
+	conf := &config.Config{KnockToken: "token", KnockPeriod: time.Minute}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+
+	req := httptest.NewRequest("GET", "/knock?token=wrong", nil)
+	req.RemoteAddr = "192.0.2.1:1000"
+	resp := httptest.NewRecorder()
+	srv.stats.mux.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.False(t, srv.knock.isAllowed(net.ParseIP("192.0.2.1")))
+
+	req = httptest.NewRequest("GET", "/knock?token=token", nil)
+	req.RemoteAddr = "192.0.2.1:1000"
+	resp = httptest.NewRecorder()
+	srv.stats.mux.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.True(t, srv.knock.isAllowed(net.ParseIP("192.0.2.1")))
+}
@@ -0,0 +1,235 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// listener is a listen socket with address which is announced to
+// clients in links.
+type listener struct {
+	net.Listener
+
+	announce string
+}
+
+type listenerInfo struct {
+	Addr     string    `json:"addr"`
+	Announce string    `json:"announce"`
+	URLs     ProxyURLs `json:"urls"`
+}
+
+// listeners keeps track of listen sockets server accepts connections
+// from. Sockets are identified by their local addresses.
+type listeners struct {
+	mutex  sync.Mutex
+	socks  map[string]*listener
+	closed bool
+}
+
+func (l *listeners) add(lsock net.Listener, announce string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	addr := lsock.Addr().String()
+	if l.closed {
+		lsock.Close() // nolint: errcheck
+		return errors.New("Server is draining")
+	}
+	if _, ok := l.socks[addr]; ok {
+		lsock.Close() // nolint: errcheck
+		return errors.Errorf("Already listening on %s", addr)
+	}
+	l.socks[addr] = &listener{Listener: lsock, announce: announce}
+
+	return nil
+}
+
+// remove closes listen socket. Last socket cannot be removed, server
+// has to be drained instead.
+func (l *listeners) remove(addr string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	lsock, ok := l.socks[addr]
+	if !ok {
+		return errors.Errorf("Not listening on %s", addr)
+	}
+	if len(l.socks) == 1 {
+		return errors.New("Cannot remove last listener")
+	}
+	delete(l.socks, addr)
+
+	return lsock.Close()
+}
+
+func (l *listeners) has(lsock net.Listener) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	known, ok := l.socks[lsock.Addr().String()]
+
+	return ok && known.Listener == lsock
+}
+
+func (l *listeners) addrs() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	addrs := make([]string, 0, len(l.socks))
+	for addr := range l.socks {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	return addrs
+}
+
+func (l *listeners) list(secret string) []listenerInfo {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	infos := make([]listenerInfo, 0, len(l.socks))
+	for addr, lsock := range l.socks {
+		info := listenerInfo{Addr: addr, Announce: lsock.announce}
+		if host, port, err := net.SplitHostPort(lsock.announce); err == nil {
+			portNum, _ := strconv.ParseUint(port, 10, 16) // nolint: gas
+			info.URLs = makeProxyURLs(host, uint16(portNum), secret)
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Addr < infos[j].Addr
+	})
+
+	return infos
+}
+
+func (l *listeners) closeAll() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for addr, lsock := range l.socks {
+		lsock.Close() // nolint: errcheck
+		delete(l.socks, addr)
+	}
+	l.closed = true
+}
+
+func newListeners() *listeners {
+	return &listeners{socks: map[string]*listener{}}
+}
+
+// AddListener starts to accept connections on given address in
+// addition to existing listeners. Links for it point to announce
+// address; if it is empty, server name with port of the listener is
+// used.
+func (s *Server) AddListener(addr, announce string) error {
+	if announce != "" {
+		if _, port, err := net.SplitHostPort(announce); err != nil {
+			return errors.Annotate(err, "Incorrect announce address")
+		} else if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return errors.Annotate(err, "Incorrect announce port")
+		}
+	}
+
+	lsock, err := s.listen(addr)
+	if err != nil {
+		return err
+	}
+	if announce == "" {
+		_, port, _ := net.SplitHostPort(lsock.Addr().String()) // nolint: gas
+		announce = net.JoinHostPort(s.conf.ServerName, port)
+	}
+	if err := s.listeners.add(lsock, announce); err != nil {
+		return err
+	}
+	go s.acceptLoop(lsock, s.watchdog)
+
+	s.logger.Infow("Listener is added", "addr", lsock.Addr().String(), "announce", announce)
+
+	return nil
+}
+
+// RemoveListener closes listener with given local address. Sessions
+// accepted from it are kept.
+func (s *Server) RemoveListener(addr string) error {
+	if err := s.listeners.remove(addr); err != nil {
+		return err
+	}
+
+	s.logger.Infow("Listener is removed", "addr", addr)
+
+	return nil
+}
+
+func (s *Server) listenersHandler(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if s.stats.refuseUnauthenticated(w) {
+			return
+		}
+		err = s.AddListener(r.URL.Query().Get("addr"), r.URL.Query().Get("announce"))
+	case http.MethodDelete:
+		if s.stats.refuseUnauthenticated(w) {
+			return
+		}
+		err = s.RemoveListener(r.URL.Query().Get("addr"))
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost+", "+http.MethodDelete)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{ // nolint: errcheck, gas
+		"listeners": s.listeners.list(s.conf.HexSecret()),
+	})
+}
+
+// acceptLoop accepts connections from listen socket until it is closed
+// either by draining or by removal.
+func (s *Server) acceptLoop(lsock net.Listener, watchdog time.Duration) {
+	if _, ok := lsock.(deadlineListener); !ok {
+		watchdog = 0
+	}
+
+	reserve := newFDReserve()
+	defer reserve.release()
+	pause := fdExhaustionMinPause
+
+	for {
+		s.beatAcceptLoop(lsock, watchdog)
+		conn, err := lsock.Accept()
+		if err == nil {
+			pause = fdExhaustionMinPause
+			go s.accept(conn)
+			continue
+		}
+
+		if !s.listeners.has(lsock) {
+			return
+		}
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() && watchdog > 0 {
+			continue
+		}
+		if isFDExhaustion(err) {
+			pause = s.pauseOnFDExhaustion(lsock, reserve, pause, err)
+		} else {
+			s.logger.Warnw("Cannot allocate incoming connection", "error", err)
+		}
+	}
+}
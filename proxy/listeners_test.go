@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestServerListeners(t *testing.T) {
+	conf := &config.Config{ServerName: "example.com", PublicPort: 443, Secret: []byte{1}}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+	srv.SetDialer(&fakeDialer{})
+
+	lsock, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	result := make(chan error)
+	go func() {
+		result <- srv.ServeListener(lsock)
+	}()
+	for len(srv.listeners.addrs()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.NotNil(t, srv.AddListener("127.0.0.1:0", "cdn.example.com"))
+	assert.Nil(t, srv.AddListener("127.0.0.1:0", "cdn.example.com:8443"))
+	addrs := srv.listeners.addrs()
+	assert.Len(t, addrs, 2)
+
+	announces := map[string]string{}
+	for _, info := range srv.listeners.list(conf.HexSecret()) {
+		announces[info.Announce] = info.URLs.TG
+	}
+	assert.Equal(t, map[string]string{
+		"example.com:443":      "tg://proxy?port=443&secret=01&server=example.com",
+		"cdn.example.com:8443": "tg://proxy?port=8443&secret=01&server=cdn.example.com",
+	}, announces)
+
+	assert.Nil(t, srv.RemoveListener(lsock.Addr().String()))
+	assert.NotNil(t, srv.RemoveListener(lsock.Addr().String()))
+	_, err = net.Dial("tcp", lsock.Addr().String())
+	assert.Error(t, err)
+
+	addrs = srv.listeners.addrs()
+	assert.Len(t, addrs, 1)
+	conn, err := net.Dial("tcp", addrs[0])
+	assert.Nil(t, err)
+	conn.Close() // nolint: errcheck
+	assert.NotNil(t, srv.RemoveListener(addrs[0]))
+
+	srv.Drain(time.Second)
+	select {
+	case err := <-result:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server is not stopped")
+	}
+	assert.Empty(t, srv.listeners.addrs())
+	assert.NotNil(t, srv.AddListener("127.0.0.1:0", ""))
+}
+
+func TestListenersHandlerUnauthenticated(t *testing.T) {
+	conf := &config.Config{Secret: []byte{1}}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+
+	for _, method := range []string{http.MethodPost, http.MethodDelete} {
+		recorder := httptest.NewRecorder()
+		srv.listenersHandler(recorder, httptest.NewRequest(method, "/listeners?addr=127.0.0.1:0", nil))
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+	}
+	assert.Len(t, srv.listeners.addrs(), 0)
+
+	recorder := httptest.NewRecorder()
+	srv.listenersHandler(recorder, httptest.NewRequest(http.MethodGet, "/listeners", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestListenersHandlerAuthenticated(t *testing.T) {
+	conf := &config.Config{Secret: []byte{1}, StatsToken: "token"}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+	defer srv.listeners.closeAll()
+
+	recorder := httptest.NewRecorder()
+	srv.listenersHandler(recorder, httptest.NewRequest(http.MethodPost, "/listeners?addr=127.0.0.1:0", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Len(t, srv.listeners.addrs(), 1)
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"sort"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Logger is a structured logger used by the proxy. Context is passed
+// as alternating keys and values. *zap.SugaredLogger implements it.
+type Logger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// DebugLogger is Logger which tells if debug entries are written.
+// Debug entries are skipped for loggers which do not implement it,
+// because proxy logs each read and write in debug mode.
+type DebugLogger interface {
+	Logger
+	DebugEnabled() bool
+}
+
+// NewZapLogger adapts zap logger to Logger.
+func NewZapLogger(logger *zap.Logger) Logger {
+	return logger.Sugar()
+}
+
+// zapLogger returns non-sugared logger for hot paths. If Logger is not
+// backed by zap, entries are passed to it with loggerCore.
+func zapLogger(logger Logger) *zap.Logger {
+	if sugared, ok := logger.(*zap.SugaredLogger); ok {
+		return sugared.Desugar()
+	}
+
+	return zap.New(&loggerCore{logger: logger})
+}
+
+// loggerCore is zapcore.Core which writes entries into Logger. Debug
+// entries are written only if DebugLogger asks for them.
+type loggerCore struct {
+	logger Logger
+	fields []zapcore.Field
+}
+
+func (c *loggerCore) Enabled(level zapcore.Level) bool {
+	if level >= zapcore.InfoLevel {
+		return true
+	}
+	debug, ok := c.logger.(DebugLogger)
+
+	return ok && debug.DebugEnabled()
+}
+
+func (c *loggerCore) With(fields []zapcore.Field) zapcore.Core {
+	return &loggerCore{
+		logger: c.logger,
+		fields: append(c.fields[:len(c.fields):len(c.fields)], fields...),
+	}
+}
+
+func (c *loggerCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+
+	return checked
+}
+
+func (c *loggerCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	encoder := zapcore.NewMapObjectEncoder()
+	for _, field := range c.fields {
+		field.AddTo(encoder)
+	}
+	for _, field := range fields {
+		field.AddTo(encoder)
+	}
+
+	keys := make([]string, 0, len(encoder.Fields))
+	for key := range encoder.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	keysAndValues := make([]interface{}, 0, 2*len(keys))
+	for _, key := range keys {
+		keysAndValues = append(keysAndValues, key, encoder.Fields[key])
+	}
+
+	switch entry.Level {
+	case zapcore.DebugLevel:
+		c.logger.Debugw(entry.Message, keysAndValues...)
+	case zapcore.InfoLevel:
+		c.logger.Infow(entry.Message, keysAndValues...)
+	case zapcore.WarnLevel:
+		c.logger.Warnw(entry.Message, keysAndValues...)
+	default:
+		c.logger.Errorw(entry.Message, keysAndValues...)
+	}
+
+	return nil
+}
+
+func (c *loggerCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type recordLogger struct {
+	entries []string
+}
+
+func (r *recordLogger) record(level, msg string, keysAndValues ...interface{}) {
+	r.entries = append(r.entries, fmt.Sprint(level, " ", msg, " ", keysAndValues))
+}
+
+func (r *recordLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	r.record("debug", msg, keysAndValues...)
+}
+
+func (r *recordLogger) Infow(msg string, keysAndValues ...interface{}) {
+	r.record("info", msg, keysAndValues...)
+}
+
+func (r *recordLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	r.record("warn", msg, keysAndValues...)
+}
+
+func (r *recordLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	r.record("error", msg, keysAndValues...)
+}
+
+type debugLogger struct {
+	recordLogger
+}
+
+func (d *debugLogger) DebugEnabled() bool {
+	return true
+}
+
+func TestZapLoggerSugared(t *testing.T) {
+	logger := zap.NewNop()
+	assert.Equal(t, logger, zapLogger(logger.Sugar()))
+}
+
+func TestZapLoggerCustom(t *testing.T) {
+	logger := &debugLogger{}
+	zlog := zapLogger(logger).With(zap.Stringer("socketid", SocketID(1)))
+
+	zlog.Debug("Finish reading", zap.Int("nbytes", 10))
+	zlog.Warn("Cannot dial", zap.Error(errors.New("timeout")))
+
+	assert.Equal(t, []string{
+		"debug Finish reading [nbytes 10 socketid 1]",
+		"warn Cannot dial [error timeout socketid 1]",
+	}, logger.entries)
+}
+
+func TestZapLoggerCustomLevel(t *testing.T) {
+	logger := &recordLogger{}
+	zlog := zapLogger(logger)
+
+	assert.False(t, zlog.Core().Enabled(zapcore.DebugLevel))
+	zlog.Debug("Finish reading", zap.Int("nbytes", 10))
+	zlog.Info("Telegram connection is restored")
+
+	assert.Equal(t, []string{"info Telegram connection is restored []"}, logger.entries)
+
+	conf := &config.Config{Secret: []byte{1}}
+	srv := NewServer(conf, logger, NewStats(conf))
+	conn, _ := net.Pipe()
+	assert.Equal(t, conn, srv.wrapLogReadWriteCloser(conn, 1, StreamClient))
+}
@@ -4,43 +4,53 @@ import (
 	"io"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 // LogReadWriteCloser adds additional logging for reading/writing. All
 // logging is performed for debug mode only.
 type LogReadWriteCloser struct {
 	conn   io.ReadWriteCloser
-	logger *zap.SugaredLogger
-	sockid string
-	name   string
+	logger *zap.Logger
 }
 
 // Read reads from connection
 func (l *LogReadWriteCloser) Read(p []byte) (n int, err error) {
 	n, err = l.conn.Read(p)
-	l.logger.Debugw("Finish reading", "name", l.name, "socketid", l.sockid, "nbytes", n, "error", err)
+	l.log("Finish reading", n, err)
 	return
 }
 
 // Write writes into connection.
 func (l *LogReadWriteCloser) Write(p []byte) (n int, err error) {
 	n, err = l.conn.Write(p)
-	l.logger.Debugw("Finish writing", "name", l.name, "socketid", l.sockid, "nbytes", n, "error", err)
+	l.log("Finish writing", n, err)
 	return
 }
 
+// CloseWrite closes writing side of underlying connection.
+func (l *LogReadWriteCloser) CloseWrite() error {
+	err := closeWrite(l.conn)
+	l.log("Finish closing socket for writing", 0, err)
+	return err
+}
+
 // Close closes underlying connection.
 func (l *LogReadWriteCloser) Close() error {
 	err := l.conn.Close()
-	l.logger.Debugw("Finish closing socket", "name", l.name, "socketid", l.sockid, "error", err)
+	l.log("Finish closing socket", 0, err)
 	return err
 }
 
-func newLogReadWriteCloser(conn io.ReadWriteCloser, logger *zap.SugaredLogger, sockid string, name string) io.ReadWriteCloser {
+func (l *LogReadWriteCloser) log(msg string, n int, err error) {
+	if ce := l.logger.Check(zapcore.DebugLevel, msg); ce != nil {
+		ce.Write(zap.Int("nbytes", n), zap.Error(err))
+	}
+}
+
+func newLogReadWriteCloser(conn io.ReadWriteCloser, logger *zap.Logger, sockid SocketID, name string) io.ReadWriteCloser {
 	return &LogReadWriteCloser{
 		conn:   conn,
-		logger: logger,
-		sockid: sockid,
-		name:   name,
+		logger: logger.With(zap.String("name", name), zap.Stringer("socketid", sockid)),
 	}
 }
@@ -0,0 +1,54 @@
+package proxy
+
+import "sync/atomic"
+
+// Metric is a named value of proxy statistics. Names are in
+// snake_case, like connections_active. Gauge metrics may go down,
+// others are counters.
+type Metric struct {
+	Name  string
+	Value uint64
+	Gauge bool
+}
+
+func counterMetric(name string, value uint64) Metric {
+	return Metric{Name: name, Value: value}
+}
+
+func gaugeMetric(name string, value uint64) Metric {
+	return Metric{Name: name, Value: value, Gauge: true}
+}
+
+// Metrics returns current values of proxy counters. It is used to push
+// statistics to external monitoring systems.
+func (s *Stats) Metrics() []Metric {
+	metrics := []Metric{
+		counterMetric("connections_all", atomic.LoadUint64(&s.AllConnections)),
+		gaugeMetric("connections_active", uint64(atomic.LoadUint32(&s.ActiveConnections))),
+		counterMetric("traffic_incoming", atomic.LoadUint64(&s.Traffic.Incoming)),
+		counterMetric("traffic_outgoing", atomic.LoadUint64(&s.Traffic.Outgoing)),
+		counterMetric("traffic_upload", atomic.LoadUint64(&s.secret.Upload)),
+		counterMetric("traffic_download", atomic.LoadUint64(&s.secret.Download)),
+		counterMetric("non_mtproto_http", atomic.LoadUint64(&s.NonMTProto.HTTP)),
+		counterMetric("non_mtproto_tls", atomic.LoadUint64(&s.NonMTProto.TLS)),
+		counterMetric("non_mtproto_ssh", atomic.LoadUint64(&s.NonMTProto.SSH)),
+		counterMetric("non_mtproto_unknown", atomic.LoadUint64(&s.NonMTProto.Unknown)),
+		counterMetric("non_mtproto_garbage", atomic.LoadUint64(&s.NonMTProto.Garbage)),
+		counterMetric("handshake_failures_bad_secret", atomic.LoadUint64(&s.HandshakeFailures.BadSecret)),
+		counterMetric("handshake_failures_bad_transport", atomic.LoadUint64(&s.HandshakeFailures.BadTransport)),
+		counterMetric("handshake_failures_timeout", atomic.LoadUint64(&s.HandshakeFailures.Timeout)),
+		counterMetric("handshake_failures_closed", atomic.LoadUint64(&s.HandshakeFailures.Closed)),
+		counterMetric("dead_peers_client", atomic.LoadUint64(&s.DeadPeers.Client)),
+		counterMetric("dead_peers_telegram", atomic.LoadUint64(&s.DeadPeers.Telegram)),
+		counterMetric("suppressed_logs", atomic.LoadUint64(&s.SuppressedLogs)),
+		counterMetric("backpressure_events", atomic.LoadUint64(&s.BackpressureEvents)),
+		counterMetric("slow_clients_evicted", atomic.LoadUint64(&s.SlowClientsEvicted)),
+		counterMetric("listen_overflows", atomic.LoadUint64(&s.ListenOverflows)),
+		counterMetric("fd_exhaustions", atomic.LoadUint64(&s.FDExhaustions)),
+		counterMetric("filtered_connections", atomic.LoadUint64(&s.FilteredConnections)),
+		counterMetric("tarpitted_connections", atomic.LoadUint64(&s.TarpittedConnections)),
+		counterMetric("telegram_reconnects", atomic.LoadUint64(&s.TelegramReconnects)),
+	}
+
+	return append(metrics, s.Bandwidth.metrics()...)
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsMetrics(t *testing.T) {
+	stat := NewStats(&config.Config{})
+	stat.NewConnection()
+	stat.AddOutgoingTraffic(10)
+	stat.AddHandshakeFailure(handshakeBadSecret)
+
+	values := map[string]uint64{}
+	for _, metric := range stat.Metrics() {
+		values[metric.Name] = metric.Value
+	}
+	assert.Equal(t, uint64(1), values["connections_all"])
+	assert.Equal(t, uint64(1), values["connections_active"])
+	assert.Equal(t, uint64(10), values["traffic_outgoing"])
+	assert.Equal(t, uint64(1), values["handshake_failures_bad_secret"])
+	assert.Equal(t, uint64(0), values["tarpitted_connections"])
+}
+
+func TestStatsBandwidth(t *testing.T) {
+	stat := NewStats(&config.Config{})
+	now := time.Now()
+
+	stat.Bandwidth.update(1000, 0, now)
+	stat.Bandwidth.update(1000+60*1000, 60*500, now.Add(time.Minute))
+
+	incoming, outgoing := stat.Bandwidth.rates()
+	assert.InDelta(t, 1000*(1-math.Exp(-1)), incoming[0], 0.01)
+	assert.InDelta(t, 1000*(1-math.Exp(-0.2)), incoming[1], 0.01)
+	assert.InDelta(t, 500*(1-math.Exp(-1)), outgoing[0], 0.01)
+
+	values := map[string]uint64{}
+	for _, metric := range stat.Metrics() {
+		values[metric.Name] = metric.Value
+	}
+	assert.Equal(t, uint64(632), values["bandwidth_incoming_1m"])
+	assert.Equal(t, uint64(32), values["bandwidth_outgoing_15m"])
+
+	data, err := json.Marshal(stat.Bandwidth)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"incoming": {"1m": 632, "5m": 181, "15m": 64}, "outgoing": {"1m": 316, "5m": 90, "15m": 32}}`, string(data))
+}
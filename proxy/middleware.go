@@ -0,0 +1,48 @@
+package proxy
+
+import "io"
+
+// Names of the streams passed to middlewares.
+const (
+	StreamClient   = "client"
+	StreamTelegram = "telegram"
+)
+
+// StreamInfo describes a stream which is going to be wrapped by
+// middleware.
+type StreamInfo struct {
+	SocketID SocketID
+	Name     string
+	DC       int16
+}
+
+// Middleware wraps client or Telegram stream with custom
+// ReadWriteCloser. Wrapped stream is already decrypted, so middleware
+// sees MTPROTO traffic. If wrapper wants to keep half-close working, it
+// has to implement CloseWrite() error and pass it to underlying stream.
+type Middleware interface {
+	Wrap(conn io.ReadWriteCloser, info StreamInfo) io.ReadWriteCloser
+}
+
+// MiddlewareFunc is an adapter to use ordinary functions as middlewares.
+type MiddlewareFunc func(io.ReadWriteCloser, StreamInfo) io.ReadWriteCloser
+
+// Wrap calls f(conn, info).
+func (f MiddlewareFunc) Wrap(conn io.ReadWriteCloser, info StreamInfo) io.ReadWriteCloser {
+	return f(conn, info)
+}
+
+// Use adds middlewares to the stream chain. They are applied in order
+// of addition, so the last one is the outermost. Use has to be called
+// before Serve.
+func (s *Server) Use(middlewares ...Middleware) {
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+func (s *Server) applyMiddlewares(conn io.ReadWriteCloser, info StreamInfo) io.ReadWriteCloser {
+	for _, middleware := range s.middlewares {
+		conn = middleware.Wrap(conn, info)
+	}
+
+	return conn
+}
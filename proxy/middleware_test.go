@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type namedReadWriteCloser struct {
+	io.ReadWriteCloser
+	name string
+}
+
+func TestApplyMiddlewaresOrder(t *testing.T) {
+	srv := &Server{}
+	var infos []StreamInfo
+	wrap := func(name string) Middleware {
+		return MiddlewareFunc(func(conn io.ReadWriteCloser, info StreamInfo) io.ReadWriteCloser {
+			infos = append(infos, info)
+			return &namedReadWriteCloser{ReadWriteCloser: conn, name: name}
+		})
+	}
+	srv.Use(wrap("inner"), wrap("outer"))
+
+	info := StreamInfo{SocketID: 1, Name: StreamClient, DC: 2}
+	conn := srv.applyMiddlewares(nil, info)
+
+	outer := conn.(*namedReadWriteCloser)
+	assert.Equal(t, "outer", outer.name)
+	assert.Equal(t, "inner", outer.ReadWriteCloser.(*namedReadWriteCloser).name)
+	assert.Equal(t, []StreamInfo{info, info}, infos)
+}
@@ -0,0 +1,24 @@
+//go:build go1.21
+// +build go1.21
+
+package proxy
+
+import (
+	"context"
+	"net"
+)
+
+// listenMultipath creates MPTCP listener. If kernel does not support
+// MPTCP, plain TCP is used.
+func listenMultipath(network, address string) (net.Listener, error) {
+	lc := net.ListenConfig{}
+	lc.SetMultipathTCP(true)
+
+	return lc.Listen(context.Background(), network, address)
+}
+
+func setDialerMultipath(dialer *net.Dialer) error {
+	dialer.SetMultipathTCP(true)
+
+	return nil
+}
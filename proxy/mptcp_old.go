@@ -0,0 +1,20 @@
+//go:build !go1.21
+// +build !go1.21
+
+package proxy
+
+import (
+	"net"
+
+	"github.com/juju/errors"
+)
+
+var errMultipathUnsupported = errors.New("Multipath TCP requires Go 1.21 or newer")
+
+func listenMultipath(network, address string) (net.Listener, error) {
+	return nil, errMultipathUnsupported
+}
+
+func setDialerMultipath(dialer *net.Dialer) error {
+	return errMultipathUnsupported
+}
@@ -0,0 +1,35 @@
+//go:build go1.21
+// +build go1.21
+
+package proxy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenMultipath(t *testing.T) {
+	lsock, err := listenMultipath("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lsock.Close()
+
+	dialer := net.Dialer{}
+	assert.Nil(t, setDialerMultipath(&dialer))
+
+	conn, err := dialer.Dial("tcp", lsock.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	server, err := lsock.Accept()
+	assert.Nil(t, err)
+	defer server.Close()
+
+	_, err = conn.Write([]byte{1})
+	assert.Nil(t, err)
+	buf := make([]byte, 1)
+	_, err = server.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(1), buf[0])
+}
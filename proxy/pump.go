@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// pump copies data from src to dst through a buffer of limited size.
+// Buffer bounds an amount of in-flight data: nothing is read from src
+// until previous chunk is completely written into dst, so slow consumer
+// stalls fast producer instead of making proxy to buffer its data. If
+// write takes longer than threshold, onBackpressure is called.
+type pump struct {
+	pool           sync.Pool
+	threshold      time.Duration
+	onBackpressure func()
+}
+
+func (p *pump) copy(dst io.Writer, src io.Reader) error {
+	buf := p.pool.Get().([]byte)
+	defer p.pool.Put(buf)
+
+	for {
+		if err := p.transfer(dst, src, buf); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// step does a single read from src and writes its result into dst. It
+// returns io.EOF if src is finished.
+func (p *pump) step(dst io.Writer, src io.Reader) error {
+	buf := p.pool.Get().([]byte)
+	defer p.pool.Put(buf)
+
+	return p.transfer(dst, src, buf)
+}
+
+func (p *pump) transfer(dst io.Writer, src io.Reader, buf []byte) error {
+	n, err := src.Read(buf)
+	if n > 0 {
+		started := time.Now()
+		if _, writeErr := dst.Write(buf[:n]); writeErr != nil {
+			return writeErr
+		}
+		if p.threshold > 0 && time.Since(started) >= p.threshold {
+			p.onBackpressure()
+		}
+	}
+
+	return err
+}
+
+func newPump(bufferSize int, threshold time.Duration, onBackpressure func()) *pump {
+	return &pump{
+		pool: sync.Pool{
+			New: func() interface{} {
+				return make([]byte, bufferSize)
+			},
+		},
+		threshold:      threshold,
+		onBackpressure: onBackpressure,
+	}
+}
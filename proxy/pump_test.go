@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type slowWriter struct {
+	bytes.Buffer
+	delay time.Duration
+}
+
+func (s *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	return s.Buffer.Write(p)
+}
+
+func TestPumpCopiesEverything(t *testing.T) {
+	data := bytes.Repeat([]byte{1, 2, 3}, 100)
+	dst := &bytes.Buffer{}
+	p := newPump(7, 0, func() {})
+
+	assert.Nil(t, p.copy(dst, bytes.NewReader(data)))
+	assert.Equal(t, data, dst.Bytes())
+}
+
+func TestPumpBackpressure(t *testing.T) {
+	events := 0
+	dst := &slowWriter{delay: 10 * time.Millisecond}
+	p := newPump(4, 5*time.Millisecond, func() { events++ })
+
+	assert.Nil(t, p.copy(dst, bytes.NewReader(make([]byte, 10))))
+	assert.Equal(t, 3, events)
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// quarantineFailures is how many dials in a row have to fail before
+// address is quarantined.
+const quarantineFailures = 3
+
+type quarantineState struct {
+	failures int
+	until    time.Time
+}
+
+// addrQuarantine tracks Telegram addresses which fail while other
+// addresses work. Such addresses are avoided for cooldown period if
+// datacenter has an alternative address. If all addresses fail, it is
+// likely a problem of proxy network, so nothing is quarantined.
+type addrQuarantine struct {
+	cooldown     time.Duration
+	onQuarantine func(address string)
+
+	mutex       sync.Mutex
+	addrs       map[string]*quarantineState
+	lastSuccess time.Time
+}
+
+func (q *addrQuarantine) isQuarantined(address string) bool {
+	if q == nil {
+		return false
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	state, ok := q.addrs[address]
+	return ok && time.Now().Before(state.until)
+}
+
+func (q *addrQuarantine) record(address string, err error) {
+	if q == nil {
+		return
+	}
+
+	q.mutex.Lock()
+	now := time.Now()
+	if err == nil {
+		delete(q.addrs, address)
+		q.lastSuccess = now
+		q.mutex.Unlock()
+		return
+	}
+
+	state, ok := q.addrs[address]
+	if !ok {
+		state = &quarantineState{}
+		q.addrs[address] = state
+	}
+	state.failures++
+	quarantined := state.failures >= quarantineFailures && now.Sub(q.lastSuccess) < q.cooldown
+	if quarantined {
+		state.failures = 0
+		state.until = now.Add(q.cooldown)
+	}
+	q.mutex.Unlock()
+
+	if quarantined {
+		q.onQuarantine(address)
+	}
+}
+
+// adjust changes IP policy so quarantined address of the datacenter is
+// tried last. IPv6 only policy has no alternatives and is kept.
+func (q *addrQuarantine) adjust(policy ipPolicy, addr *TelegramAddress) ipPolicy {
+	switch {
+	case policy == ipPreferV4 && addr.v6 != "" &&
+		q.isQuarantined(addr.IPv4()) && !q.isQuarantined(addr.IPv6()):
+		return ipPreferV6
+	case policy == ipPreferV6 && q.isQuarantined(addr.IPv6()):
+		return ipPreferV4
+	}
+
+	return policy
+}
+
+// wrap records results of dials. Dials aborted by context are not
+// counted, client has just gone.
+func (q *addrQuarantine) wrap(dial dialFunc) dialFunc {
+	if q == nil {
+		return dial
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if ctx.Err() == nil {
+			q.record(address, err)
+		}
+		return conn, err
+	}
+}
+
+func newAddrQuarantine(cooldown time.Duration, onQuarantine func(address string)) *addrQuarantine {
+	return &addrQuarantine{
+		cooldown:     cooldown,
+		onQuarantine: onQuarantine,
+		addrs:        map[string]*quarantineState{},
+	}
+}
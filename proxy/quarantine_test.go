@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuarantineFailingAddress(t *testing.T) {
+	quarantined := []string{}
+	q := newAddrQuarantine(time.Minute, func(address string) {
+		quarantined = append(quarantined, address)
+	})
+	addr := &TelegramAddresses[2]
+	failure := errors.New("connection refused")
+
+	q.record(TelegramAddresses[1].IPv4(), nil)
+	for i := 0; i < quarantineFailures; i++ {
+		assert.False(t, q.isQuarantined(addr.IPv4()))
+		q.record(addr.IPv4(), failure)
+	}
+
+	assert.True(t, q.isQuarantined(addr.IPv4()))
+	assert.Equal(t, []string{addr.IPv4()}, quarantined)
+	assert.Equal(t, ipPreferV6, q.adjust(ipPreferV4, addr))
+	assert.Equal(t, ipOnlyV6, q.adjust(ipOnlyV6, addr))
+
+	q.record(addr.IPv4(), nil)
+	assert.False(t, q.isQuarantined(addr.IPv4()))
+	assert.Equal(t, ipPreferV4, q.adjust(ipPreferV4, addr))
+}
+
+func TestQuarantineAllAddressesFail(t *testing.T) {
+	q := newAddrQuarantine(time.Minute, func(string) {
+		t.Fatal("Address is quarantined")
+	})
+	addr := &TelegramAddresses[2]
+
+	for i := 0; i < 2*quarantineFailures; i++ {
+		q.record(addr.IPv4(), errors.New("network is unreachable"))
+	}
+	assert.False(t, q.isQuarantined(addr.IPv4()))
+}
+
+func TestQuarantineDisabled(t *testing.T) {
+	var q *addrQuarantine
+
+	assert.False(t, q.isQuarantined(TelegramAddresses[2].IPv4()))
+	assert.Equal(t, ipPreferV4, q.adjust(ipPreferV4, &TelegramAddresses[2]))
+}
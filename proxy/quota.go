@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Actions which are taken when traffic quota of the secret is exceeded.
+// Throttle limits rate of each session, refuse rejects new sessions and
+// disconnect closes active ones.
+const (
+	QuotaActionThrottle   = "throttle"
+	QuotaActionRefuse     = "refuse"
+	QuotaActionDisconnect = "disconnect"
+)
+
+const (
+	quotaCheckInterval  = 5 * time.Second
+	quotaWebhookTimeout = 10 * time.Second
+)
+
+// quotaNotification is a body of webhook request.
+type quotaNotification struct {
+	SecretID string `json:"secret_id"`
+	Usage    uint64 `json:"usage"`
+	Quota    uint64 `json:"quota"`
+}
+
+// enforceQuota periodically compares client traffic of the secret with
+// its quota. Actions are taken once quota is exceeded.
+func (s *Server) enforceQuota(stopped <-chan struct{}) {
+	if s.conf.TrafficQuota == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(quotaCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.checkQuota()
+
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) checkQuota() {
+	usage := atomic.LoadUint64(&s.stats.secret.Upload) + atomic.LoadUint64(&s.stats.secret.Download)
+	if usage < s.conf.TrafficQuota || !atomic.CompareAndSwapInt32(&s.quotaExceeded, 0, 1) {
+		return
+	}
+
+	s.logger.Warnw("Traffic quota is exceeded",
+		"usage", usage,
+		"quota", s.conf.TrafficQuota,
+		"actions", s.conf.QuotaActions,
+	)
+	if s.hasQuotaAction(QuotaActionDisconnect) {
+		s.sessions.closeAll()
+	}
+	if s.conf.QuotaWebhook != "" {
+		go s.notifyQuota(usage)
+	}
+	s.notify(EventQuotaExceeded, map[string]interface{}{
+		"usage": usage,
+		"quota": s.conf.TrafficQuota,
+	})
+}
+
+func (s *Server) isQuotaExceeded() bool {
+	return atomic.LoadInt32(&s.quotaExceeded) == 1
+}
+
+func (s *Server) hasQuotaAction(action string) bool {
+	for _, value := range s.conf.QuotaActions {
+		if value == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) notifyQuota(usage uint64) {
+	body, _ := json.Marshal(quotaNotification{ // nolint: gas
+		SecretID: s.conf.SecretID(),
+		Usage:    usage,
+		Quota:    s.conf.TrafficQuota,
+	})
+
+	client := &http.Client{Timeout: quotaWebhookTimeout}
+	resp, err := client.Post(s.conf.QuotaWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		s.logger.Warnw("Cannot send quota webhook", "error", err)
+		return
+	}
+	resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		s.logger.Warnw("Quota webhook has failed", "status", resp.Status)
+	}
+}
+
+// ThrottleReadWriteCloser limits rate of the session to rate bytes per
+// second in each direction while throttled returns true.
+type ThrottleReadWriteCloser struct {
+	conn      io.ReadWriteCloser
+	rate      float64
+	throttled func() bool
+}
+
+// Read reads from connection
+func (t *ThrottleReadWriteCloser) Read(p []byte) (int, error) {
+	n, err := t.conn.Read(p)
+	t.wait(n)
+
+	return n, err
+}
+
+// Write writes into connection.
+func (t *ThrottleReadWriteCloser) Write(p []byte) (int, error) {
+	t.wait(len(p))
+
+	return t.conn.Write(p)
+}
+
+// CloseWrite closes writing side of underlying connection.
+func (t *ThrottleReadWriteCloser) CloseWrite() error {
+	return closeWrite(t.conn)
+}
+
+// Close closes underlying connection.
+func (t *ThrottleReadWriteCloser) Close() error {
+	return t.conn.Close()
+}
+
+func (t *ThrottleReadWriteCloser) wait(n int) {
+	if n > 0 && t.throttled() {
+		time.Sleep(time.Duration(float64(n) / t.rate * float64(time.Second)))
+	}
+}
+
+func newThrottleReadWriteCloser(conn io.ReadWriteCloser, rate int, throttled func() bool) io.ReadWriteCloser {
+	return &ThrottleReadWriteCloser{
+		conn:      conn,
+		rate:      float64(rate),
+		throttled: throttled,
+	}
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestCheckQuota(t *testing.T) {
+	notifications := make(chan quotaNotification, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notification := quotaNotification{}
+		json.NewDecoder(r.Body).Decode(&notification) // nolint: errcheck
+		notifications <- notification
+	}))
+	defer server.Close()
+
+	conf := &config.Config{
+		Secret:       make([]byte, 16),
+		TrafficQuota: 100,
+		QuotaActions: []string{QuotaActionRefuse, QuotaActionDisconnect},
+		QuotaWebhook: server.URL,
+	}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+
+	active, _ := net.Pipe()
+	srv.sessions.add(srv.makeSocketID(), active)
+
+	srv.stats.secret.addUpload(40)
+	srv.checkQuota()
+	assert.False(t, srv.isQuotaExceeded())
+
+	srv.stats.secret.addDownload(60)
+	srv.checkQuota()
+	assert.True(t, srv.isQuotaExceeded())
+	_, err := active.Write([]byte{1})
+	assert.NotNil(t, err)
+
+	select {
+	case notification := <-notifications:
+		assert.Equal(t, quotaNotification{SecretID: conf.SecretID(), Usage: 100, Quota: 100}, notification)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Webhook is not called")
+	}
+
+	client, rejected := net.Pipe()
+	defer client.Close()
+	srv.accept(rejected)
+	_, err = client.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+}
+
+func TestThrottleReadWriteCloser(t *testing.T) {
+	throttled := false
+	conn := newThrottleReadWriteCloser(&recordingReadWriteCloser{}, 1000, func() bool {
+		return throttled
+	})
+
+	started := time.Now()
+	conn.Write(make([]byte, 100)) // nolint: errcheck
+	assert.True(t, time.Since(started) < 50*time.Millisecond)
+
+	throttled = true
+	started = time.Now()
+	conn.Write(make([]byte, 100)) // nolint: errcheck
+	assert.True(t, time.Since(started) >= 100*time.Millisecond)
+}
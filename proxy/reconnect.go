@@ -0,0 +1,318 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// telegramReplayLimit is a maximal size of incomplete client packet which
+// is kept to be resent after reconnect. Sessions which are in the middle
+// of larger upload are not reconnected.
+const telegramReplayLimit = 64 * 1024
+
+// abridgedTracker follows packet boundaries of abridged MTPROTO stream.
+// Proxy does not parse packets, but it can switch Telegram connection
+// only between them. Telegram sends quick acks as 4 bytes with the
+// highest bit set, so quickAcks is set for Telegram to client direction.
+type abridgedTracker struct {
+	header    [4]byte
+	headerLen int
+	left      int
+	quickAcks bool
+}
+
+func (t *abridgedTracker) atBoundary() bool {
+	return t.left == 0 && t.headerLen == 0
+}
+
+// feed consumes data of the stream. It returns offset in data right
+// after the last packet boundary or -1 if there is no boundary.
+func (t *abridgedTracker) feed(data []byte) int {
+	last := -1
+	if t.atBoundary() {
+		last = 0
+	}
+
+	for i := 0; i < len(data); {
+		if t.left > 0 {
+			chunk := len(data) - i
+			if chunk > t.left {
+				chunk = t.left
+			}
+			t.left -= chunk
+			i += chunk
+			if t.left == 0 {
+				last = i
+			}
+			continue
+		}
+
+		t.header[t.headerLen] = data[i]
+		t.headerLen++
+		i++
+		if length, ok := t.packetLength(); ok {
+			t.headerLen = 0
+			t.left = length
+			if length == 0 {
+				last = i
+			}
+		}
+	}
+
+	return last
+}
+
+func (t *abridgedTracker) packetLength() (int, bool) {
+	if t.quickAcks && t.header[0]&abridgedQuickAck != 0 {
+		return 3, true
+	}
+
+	length := int(t.header[0] &^ abridgedQuickAck)
+	if length != abridgedLongLen {
+		return length * 4, true
+	}
+	if t.headerLen < 4 {
+		return 0, false
+	}
+
+	return (int(t.header[1]) | int(t.header[2])<<8 | int(t.header[3])<<16) * 4, true
+}
+
+// telegramDialFunc establishes new Telegram stream for the session.
+type telegramDialFunc func() (io.ReadWriteCloser, *TimeoutReadWriteCloser, error)
+
+// reconnectReadWriteCloser is Telegram stream which survives transient
+// network errors. If connection is broken while both directions are
+// between packets, new connection to the same DC is established and
+// incomplete client packet is resent. MTPROTO sessions are not bound to
+// connections, so client continues as if nothing has happened. Number
+// of reconnects is bounded.
+type reconnectReadWriteCloser struct {
+	dial        telegramDialFunc
+	onReconnect func(error)
+
+	// reconnecting serializes reconnects, mutex is not held while
+	// dialing.
+	reconnecting sync.Mutex
+
+	mutex      sync.Mutex
+	conn       io.ReadWriteCloser
+	base       *TimeoutReadWriteCloser
+	generation int
+	attempts   uint
+	closed     bool
+	linger     time.Time
+
+	read     abridgedTracker
+	write    abridgedTracker
+	pending  []byte
+	overflow bool
+}
+
+// Read reads from connection
+func (r *reconnectReadWriteCloser) Read(p []byte) (int, error) {
+	for {
+		conn, generation := r.current()
+		n, err := conn.Read(p)
+
+		r.mutex.Lock()
+		if generation != r.generation {
+			// Connection was replaced while reading. Complete packets
+			// are delivered, everything after the last packet boundary
+			// is dropped with old connection.
+			tracker := r.read
+			if boundary := tracker.feed(p[:n]); boundary > 0 {
+				r.read.feed(p[:boundary])
+				r.mutex.Unlock()
+				return boundary, nil
+			}
+			r.mutex.Unlock()
+			continue
+		}
+		if n > 0 {
+			r.read.feed(p[:n])
+			r.mutex.Unlock()
+			return n, nil
+		}
+		r.mutex.Unlock()
+
+		if err == nil {
+			return 0, nil
+		}
+		if !r.reconnect(generation, err) {
+			return 0, err
+		}
+	}
+}
+
+// Write writes into connection.
+func (r *reconnectReadWriteCloser) Write(p []byte) (int, error) {
+	for {
+		conn, generation := r.current()
+		_, err := conn.Write(p)
+
+		r.mutex.Lock()
+		if generation != r.generation {
+			// Connection was replaced while writing, so p has to be
+			// written into the new one.
+			r.mutex.Unlock()
+			continue
+		}
+		if err == nil {
+			r.track(p)
+			r.mutex.Unlock()
+			return len(p), nil
+		}
+		r.mutex.Unlock()
+
+		if !r.reconnect(generation, err) {
+			return 0, err
+		}
+	}
+}
+
+// CloseWrite closes writing side of underlying connection.
+func (r *reconnectReadWriteCloser) CloseWrite() error {
+	conn, _ := r.current()
+	return closeWrite(conn)
+}
+
+// Close closes underlying connection.
+func (r *reconnectReadWriteCloser) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.closed = true
+	return r.conn.Close()
+}
+
+// setLinger sets linger deadline of current and all future
+// connections.
+func (r *reconnectReadWriteCloser) setLinger(deadline time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.linger.IsZero() || deadline.Before(r.linger) {
+		r.linger = deadline
+	}
+	r.base.setLinger(deadline)
+}
+
+func (r *reconnectReadWriteCloser) current() (io.ReadWriteCloser, int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.conn, r.generation
+}
+
+// track remembers client data written after the last packet boundary.
+func (r *reconnectReadWriteCloser) track(p []byte) {
+	boundary := r.write.feed(p)
+	if boundary >= 0 {
+		r.pending = append(r.pending[:0], p[boundary:]...)
+		r.overflow = false
+	} else if !r.overflow {
+		r.pending = append(r.pending, p...)
+	}
+
+	if len(r.pending) > telegramReplayLimit {
+		r.pending = nil
+		r.overflow = true
+	}
+}
+
+// reconnect replaces broken connection of given generation. Dial is
+// done without mutex, so Close and setLinger are not blocked by it.
+// It returns true if connection was replaced, maybe by concurrent
+// call.
+func (r *reconnectReadWriteCloser) reconnect(generation int, cause error) bool {
+	r.reconnecting.Lock()
+	defer r.reconnecting.Unlock()
+
+	r.mutex.Lock()
+	if generation != r.generation {
+		r.mutex.Unlock()
+		return true
+	}
+	if r.closed || !isTransientError(cause) || !r.read.atBoundary() || r.overflow {
+		r.mutex.Unlock()
+		return false
+	}
+	r.conn.Close() // nolint: errcheck
+	pending := append([]byte(nil), r.pending...)
+	r.mutex.Unlock()
+
+	for r.takeAttempt() {
+		conn, base, err := r.dial()
+		if err != nil {
+			continue
+		}
+		if len(pending) > 0 {
+			if _, err := conn.Write(pending); err != nil {
+				conn.Close() // nolint: errcheck
+				continue
+			}
+		}
+
+		r.mutex.Lock()
+		if r.closed {
+			r.mutex.Unlock()
+			conn.Close() // nolint: errcheck
+			return false
+		}
+		if !r.linger.IsZero() {
+			base.setLinger(r.linger)
+		}
+		r.conn = conn
+		r.base = base
+		r.generation++
+		r.mutex.Unlock()
+
+		r.onReconnect(cause)
+		return true
+	}
+
+	return false
+}
+
+func (r *reconnectReadWriteCloser) takeAttempt() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed || r.attempts == 0 {
+		return false
+	}
+	r.attempts--
+
+	return true
+}
+
+// isTransientError tells if connection is broken by network error.
+// Graceful close by Telegram and timeouts are final.
+func isTransientError(err error) bool {
+	cause := errors.Cause(err)
+	if cause == io.EOF {
+		return false
+	}
+	if netErr, ok := cause.(net.Error); ok && netErr.Timeout() {
+		return false
+	}
+
+	return true
+}
+
+func newReconnectReadWriteCloser(conn io.ReadWriteCloser, base *TimeoutReadWriteCloser, attempts uint,
+	dial telegramDialFunc, onReconnect func(error)) *reconnectReadWriteCloser {
+	return &reconnectReadWriteCloser{
+		dial:        dial,
+		onReconnect: onReconnect,
+		conn:        conn,
+		base:        base,
+		attempts:    attempts,
+		read:        abridgedTracker{quickAcks: true},
+	}
+}
@@ -0,0 +1,218 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAbridgedTracker(t *testing.T) {
+	tracker := &abridgedTracker{}
+
+	assert.Equal(t, 0, tracker.feed([]byte{0x01, 1, 2}))
+	assert.False(t, tracker.atBoundary())
+	assert.Equal(t, 2, tracker.feed([]byte{3, 4, 0x7f, 2}))
+	assert.Equal(t, -1, tracker.feed([]byte{0, 0, 1, 2, 3, 4, 5, 6, 7}))
+	assert.Equal(t, 1, tracker.feed([]byte{8}))
+	assert.True(t, tracker.atBoundary())
+
+	tracker = &abridgedTracker{}
+	assert.Equal(t, 0, tracker.feed([]byte{abridgedQuickAck | 0x01, 1}))
+	assert.False(t, tracker.atBoundary())
+
+	tracker = &abridgedTracker{quickAcks: true}
+	assert.Equal(t, 4, tracker.feed([]byte{abridgedQuickAck | 0x01, 1, 2, 3}))
+	assert.True(t, tracker.atBoundary())
+}
+
+type fakeTelegramConn struct {
+	reads    [][]byte
+	readErr  error
+	writeErr error
+	written  bytes.Buffer
+	closed   bool
+}
+
+func (f *fakeTelegramConn) Read(p []byte) (int, error) {
+	if len(f.reads) == 0 {
+		return 0, f.readErr
+	}
+	n := copy(p, f.reads[0])
+	f.reads = f.reads[1:]
+
+	return n, nil
+}
+
+func (f *fakeTelegramConn) Write(p []byte) (int, error) {
+	if f.writeErr != nil {
+		return 0, f.writeErr
+	}
+	return f.written.Write(p)
+}
+
+func (f *fakeTelegramConn) Close() error {
+	f.closed = true
+	return nil
+}
+
+func makeReconnectStream(attempts uint, conns ...*fakeTelegramConn) (*reconnectReadWriteCloser, *int) {
+	pipe, _ := net.Pipe()
+	base := newTimeoutReadWriteCloser(pipe, time.Minute, time.Minute)
+	reconnects := 0
+
+	stream := newReconnectReadWriteCloser(conns[0], base, attempts,
+		func() (io.ReadWriteCloser, *TimeoutReadWriteCloser, error) {
+			conns = conns[1:]
+			if len(conns) == 0 {
+				return nil, nil, syscall.ECONNREFUSED
+			}
+			return conns[0], base, nil
+		},
+		func(error) {
+			reconnects++
+		})
+
+	return stream, &reconnects
+}
+
+func TestReconnectRead(t *testing.T) {
+	first := &fakeTelegramConn{
+		reads:   [][]byte{{0x01, 1, 2, 3, 4}},
+		readErr: syscall.ECONNRESET,
+	}
+	second := &fakeTelegramConn{
+		reads:   [][]byte{{0x01, 5, 6, 7, 8}},
+		readErr: io.EOF,
+	}
+	stream, reconnects := makeReconnectStream(2, first, second)
+	buf := make([]byte, 16)
+
+	n, err := stream.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+
+	n, err = stream.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x01, 5, 6, 7, 8}, buf[:n])
+	assert.True(t, first.closed)
+	assert.Equal(t, 1, *reconnects)
+
+	_, err = stream.Read(buf)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 1, *reconnects)
+}
+
+func TestReconnectReadInsidePacket(t *testing.T) {
+	first := &fakeTelegramConn{
+		reads:   [][]byte{{0x02, 1, 2, 3, 4}},
+		readErr: syscall.ECONNRESET,
+	}
+	stream, reconnects := makeReconnectStream(2, first, &fakeTelegramConn{})
+	buf := make([]byte, 16)
+
+	_, err := stream.Read(buf)
+	assert.Nil(t, err)
+	_, err = stream.Read(buf)
+	assert.Equal(t, syscall.ECONNRESET, err)
+	assert.Equal(t, 0, *reconnects)
+}
+
+func TestReconnectWriteReplaysPacket(t *testing.T) {
+	first := &fakeTelegramConn{}
+	second := &fakeTelegramConn{}
+	stream, reconnects := makeReconnectStream(2, first, second)
+
+	_, err := stream.Write([]byte{0x01, 1, 2, 3, 4, 0x02, 1, 2})
+	assert.Nil(t, err)
+
+	first.writeErr = syscall.EPIPE
+	_, err = stream.Write([]byte{3, 4, 5, 6, 7, 8})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x02, 1, 2, 3, 4, 5, 6, 7, 8}, second.written.Bytes())
+	assert.Equal(t, 1, *reconnects)
+}
+
+func TestReconnectAttemptsExhausted(t *testing.T) {
+	first := &fakeTelegramConn{writeErr: syscall.EPIPE}
+	stream, reconnects := makeReconnectStream(1, first, &fakeTelegramConn{writeErr: syscall.EPIPE})
+
+	_, err := stream.Write([]byte{0x01, 1, 2, 3, 4})
+	assert.Equal(t, syscall.EPIPE, err)
+	assert.Equal(t, 1, *reconnects)
+}
+
+// replacedTelegramConn returns data as if connection was replaced by
+// concurrent reconnect while reading.
+type replacedTelegramConn struct {
+	fakeTelegramConn
+
+	stream *reconnectReadWriteCloser
+}
+
+func (r *replacedTelegramConn) Read(p []byte) (int, error) {
+	r.stream.mutex.Lock()
+	r.stream.conn = &r.fakeTelegramConn
+	r.stream.generation++
+	r.stream.mutex.Unlock()
+
+	return copy(p, []byte{0x01, 1, 2, 3, 4, 0x02, 1, 2}), nil
+}
+
+func TestReconnectReadReplacedConnection(t *testing.T) {
+	stream, _ := makeReconnectStream(2, &fakeTelegramConn{})
+	old := &replacedTelegramConn{stream: stream}
+	old.reads = [][]byte{{0x01, 5, 6, 7, 8}}
+	stream.conn = old
+	buf := make([]byte, 16)
+
+	n, err := stream.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x01, 1, 2, 3, 4}, buf[:n])
+	assert.True(t, stream.read.atBoundary())
+
+	n, err = stream.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x01, 5, 6, 7, 8}, buf[:n])
+}
+
+func TestReconnectCloseWhileDialing(t *testing.T) {
+	pipe, _ := net.Pipe()
+	base := newTimeoutReadWriteCloser(pipe, time.Minute, time.Minute)
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+	second := &fakeTelegramConn{}
+	stream := newReconnectReadWriteCloser(&fakeTelegramConn{writeErr: syscall.EPIPE}, base, 2,
+		func() (io.ReadWriteCloser, *TimeoutReadWriteCloser, error) {
+			close(dialing)
+			<-release
+			return second, base, nil
+		},
+		func(error) {})
+
+	written := make(chan error)
+	go func() {
+		_, err := stream.Write([]byte{0x01, 1, 2, 3, 4})
+		written <- err
+	}()
+
+	<-dialing
+	closed := make(chan struct{})
+	go func() {
+		stream.Close() // nolint: errcheck
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close is blocked by dial")
+	}
+
+	close(release)
+	assert.Equal(t, syscall.EPIPE, <-written)
+	assert.True(t, second.closed)
+}
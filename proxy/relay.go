@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Names of relay engines.
+const (
+	RelayEngineGoroutines = "goroutines"
+	RelayEngineEpoll      = "epoll"
+	RelayEngineIOURing    = "io_uring"
+)
+
+// relayPeer is one side of relayed session: the whole stream and its
+// underlying network connection.
+// reconnect is set if Telegram connection may be replaced during the
+// session.
+type relayPeer struct {
+	conn      io.ReadWriteCloser
+	base      *TimeoutReadWriteCloser
+	reconnect *reconnectReadWriteCloser
+}
+
+func (p relayPeer) setLinger(deadline time.Time) {
+	if p.reconnect != nil {
+		p.reconnect.setLinger(deadline)
+		return
+	}
+	p.base.setLinger(deadline)
+}
+
+// relayEngine moves data between client and Telegram. It returns when
+// both directions are finished.
+type relayEngine interface {
+	relay(client, telegram relayPeer)
+}
+
+// socketWrapper replaces the way data is read from and written into
+// sockets.
+type socketWrapper interface {
+	wrap(net.Conn) net.Conn
+}
+
+// goroutineRelay serves each direction with its own goroutine.
+type goroutineRelay struct {
+	pump   *pump
+	linger time.Duration
+}
+
+func (g *goroutineRelay) relay(client, telegram relayPeer) {
+	wait := &sync.WaitGroup{}
+	wait.Add(2)
+	go func() {
+		defer wait.Done()
+		lingerPeers(client, telegram, g.linger, relayDirection(g.pump, client.conn, telegram.conn))
+	}()
+	go func() {
+		defer wait.Done()
+		lingerPeers(client, telegram, g.linger, relayDirection(g.pump, telegram.conn, client.conn))
+	}()
+	wait.Wait()
+}
+
+// relayDirection pumps data from src to dst. If src is gracefully
+// closed by peer, it is propagated to dst so another direction can be
+// relayed until its own EOF.
+func relayDirection(p *pump, dst, src io.ReadWriteCloser) error {
+	err := p.copy(dst, src)
+	if err == nil {
+		closeWrite(dst) // nolint: errcheck
+	}
+
+	return err
+}
+
+// lingerPeers is called when one direction is finished. Another one
+// gets some time to finish gracefully. If direction has failed,
+// everything is unblocked immediately. It returns linger deadline.
+func lingerPeers(client, telegram relayPeer, linger time.Duration, err error) time.Time {
+	deadline := time.Now()
+	if err == nil {
+		deadline = deadline.Add(linger)
+	}
+	client.setLinger(deadline)
+	telegram.setLinger(deadline)
+
+	return deadline
+}
+
+func (s *Server) makeRelayEngine() relayEngine {
+	fallback := &goroutineRelay{
+		pump:   s.pump,
+		linger: s.conf.RelayLinger,
+	}
+
+	switch s.conf.RelayEngine {
+	case RelayEngineEpoll:
+		engine, err := newEpollRelay(fallback, s.conf.ReadTimeout, s.logger)
+		if err != nil {
+			s.logger.Warnw("Cannot start epoll relay engine, use goroutines", "error", err)
+			return fallback
+		}
+		return engine
+	case RelayEngineIOURing:
+		sockets, err := newURing()
+		if err != nil {
+			s.logger.Warnw("Cannot start io_uring relay engine, use goroutines", "error", err)
+			return fallback
+		}
+		s.sockets = sockets
+	}
+
+	return fallback
+}
+
+// wrapSocket makes socket to use io_uring if it is enabled.
+func (s *Server) wrapSocket(conn net.Conn) net.Conn {
+	if s.sockets == nil {
+		return conn
+	}
+
+	return s.sockets.wrap(conn)
+}
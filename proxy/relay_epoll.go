@@ -0,0 +1,390 @@
+//go:build linux
+// +build linux
+
+package proxy
+
+import (
+	"io"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const (
+	epollEvents        = syscall.EPOLLIN | syscall.EPOLLRDHUP | syscall.EPOLLONESHOT
+	epollSweepInterval = time.Second
+)
+
+var (
+	errRelayIdle   = errors.New("Relay direction is idle for too long")
+	errEpollClosed = errors.New("Epoll event loop is closed")
+)
+
+// epollRelay waits for readability of idle connections with a small
+// pool of epoll event loops instead of parked goroutines. Data is moved
+// by short-lived goroutines on readiness, so idle session holds neither
+// goroutines nor relay buffers. It requires that wrappers do not buffer
+// incoming data. If event loop fails, its directions are relayed by
+// goroutines.
+type epollRelay struct {
+	loops    []*epollLoop
+	next     uint32
+	fallback *goroutineRelay
+	idle     time.Duration
+	logger   Logger
+}
+
+// epollDirection is a single direction of relayed session.
+type epollDirection struct {
+	id       uint64
+	fd       int
+	loop     *epollLoop
+	src      relayPeer
+	dst      relayPeer
+	other    *epollDirection
+	client   relayPeer
+	telegram relayPeer
+	wait     *sync.WaitGroup
+	finished int32
+	busy     int32
+
+	mutex     sync.Mutex
+	deadline  time.Time
+	lingering bool
+}
+
+// touch prolongs idle deadline unless direction is lingering.
+func (d *epollDirection) touch(idle time.Duration) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if !d.lingering {
+		d.deadline = time.Now().Add(idle)
+	}
+}
+
+func (d *epollDirection) setLinger(deadline time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.lingering = true
+	if deadline.Before(d.deadline) {
+		d.deadline = deadline
+	}
+}
+
+func (d *epollDirection) isExpired(now time.Time) bool {
+	if atomic.LoadInt32(&d.busy) == 1 {
+		return false
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return now.After(d.deadline)
+}
+
+type epollLoop struct {
+	fd         int
+	mutex      sync.Mutex
+	lastID     uint64
+	directions map[uint64]*epollDirection
+	closed     bool
+}
+
+func (l *epollLoop) add(dir *epollDirection) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return errEpollClosed
+	}
+	l.lastID++
+	dir.id = l.lastID
+	dir.loop = l
+	l.directions[dir.id] = dir
+
+	event := makeEpollEvent(dir.id)
+	if err := syscall.EpollCtl(l.fd, syscall.EPOLL_CTL_ADD, dir.fd, &event); err != nil {
+		delete(l.directions, dir.id)
+		return errors.Annotate(err, "Cannot add socket to epoll")
+	}
+
+	return nil
+}
+
+// rearm makes direction to be reported again. Finished directions are
+// skipped, because their file descriptors may be closed and reused. If
+// loop is closed, direction stays busy and caller has to relay it.
+func (l *epollLoop) rearm(dir *epollDirection) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return errEpollClosed
+	}
+	atomic.StoreInt32(&dir.busy, 0)
+	if atomic.LoadInt32(&dir.finished) == 1 {
+		return nil
+	}
+	event := makeEpollEvent(dir.id)
+	if err := syscall.EpollCtl(l.fd, syscall.EPOLL_CTL_MOD, dir.fd, &event); err != nil {
+		return errors.Annotate(err, "Cannot rearm socket in epoll")
+	}
+
+	return nil
+}
+
+func (l *epollLoop) remove(dir *epollDirection) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, ok := l.directions[dir.id]; ok {
+		delete(l.directions, dir.id)
+		syscall.EpollCtl(l.fd, syscall.EPOLL_CTL_DEL, dir.fd, nil) // nolint: errcheck, gas
+	}
+}
+
+// close stops the loop and returns directions which are not busy.
+// Busy directions are returned by rearm. Epoll descriptor is closed by
+// run, so it is not reused while run may still wait on it.
+func (l *epollLoop) close() []*epollDirection {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return nil
+	}
+	var dirs []*epollDirection
+	for _, dir := range l.directions {
+		if atomic.LoadInt32(&dir.busy) == 0 && atomic.LoadInt32(&dir.finished) == 0 {
+			dirs = append(dirs, dir)
+		}
+	}
+	l.closed = true
+	l.directions = map[uint64]*epollDirection{}
+
+	return dirs
+}
+
+func (l *epollLoop) isClosed() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.closed
+}
+
+func (l *epollLoop) get(id uint64) *epollDirection {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.directions[id]
+}
+
+func (l *epollLoop) expired(now time.Time) []*epollDirection {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var dirs []*epollDirection
+	for _, dir := range l.directions {
+		if dir.isExpired(now) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs
+}
+
+func (e *epollRelay) relay(client, telegram relayPeer) {
+	clientFD, clientOK := socketFD(client.base.conn)
+	telegramFD, telegramOK := socketFD(telegram.base.conn)
+	if !clientOK || !telegramOK {
+		e.fallback.relay(client, telegram)
+		return
+	}
+
+	loop := e.loops[int(atomic.AddUint32(&e.next, 1))%len(e.loops)]
+	if loop.isClosed() {
+		e.fallback.relay(client, telegram)
+		return
+	}
+	wait := &sync.WaitGroup{}
+	wait.Add(2)
+
+	up := &epollDirection{fd: clientFD, src: client, dst: telegram}
+	down := &epollDirection{fd: telegramFD, src: telegram, dst: client}
+	up.other, down.other = down, up
+	for _, dir := range []*epollDirection{up, down} {
+		dir.client = client
+		dir.telegram = telegram
+		dir.wait = wait
+		dir.touch(e.idle)
+	}
+	for _, dir := range []*epollDirection{up, down} {
+		if atomic.LoadInt32(&dir.finished) == 1 {
+			continue
+		}
+		switch err := loop.add(dir); {
+		case err == errEpollClosed:
+			go e.drive(dir)
+		case err != nil:
+			e.finish(dir, err)
+		}
+	}
+
+	wait.Wait()
+}
+
+// handle moves a chunk of data of direction which is marked as busy by
+// event loop.
+func (e *epollRelay) handle(dir *epollDirection) {
+	err := e.fallback.pump.step(dir.dst.conn, dir.src.conn)
+	dir.touch(e.idle)
+
+	switch {
+	case err == io.EOF:
+		closeWrite(dir.dst.conn) // nolint: errcheck
+		e.finish(dir, nil)
+	case err != nil:
+		e.finish(dir, err)
+	default:
+		switch err = dir.loop.rearm(dir); {
+		case err == errEpollClosed:
+			e.drive(dir)
+		case err != nil:
+			e.finish(dir, err)
+		}
+	}
+}
+
+// drive relays direction until its end like goroutine relay does.
+func (e *epollRelay) drive(dir *epollDirection) {
+	e.finish(dir, relayDirection(e.fallback.pump, dir.dst.conn, dir.src.conn))
+}
+
+func (e *epollRelay) finish(dir *epollDirection, err error) {
+	if !atomic.CompareAndSwapInt32(&dir.finished, 0, 1) {
+		return
+	}
+	if dir.loop != nil {
+		dir.loop.remove(dir)
+	}
+
+	deadline := lingerPeers(dir.client, dir.telegram, e.fallback.linger, err)
+	if err != nil {
+		e.finish(dir.other, err)
+	} else {
+		dir.other.setLinger(deadline)
+	}
+	dir.wait.Done()
+}
+
+func (e *epollRelay) run(loop *epollLoop) {
+	events := make([]syscall.EpollEvent, 128)
+	defer syscall.Close(loop.fd) // nolint: errcheck, gas
+
+	for !loop.isClosed() {
+		n, err := syscall.EpollWait(loop.fd, events, -1)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			e.logger.Errorw("Cannot wait for epoll events, relay sessions with goroutines", "error", err)
+			e.closeLoop(loop)
+			return
+		}
+
+		for i := 0; i < n; i++ {
+			if dir := loop.get(epollEventID(&events[i])); dir != nil {
+				atomic.StoreInt32(&dir.busy, 1)
+				go e.handle(dir)
+			}
+		}
+	}
+}
+
+// closeLoop hands directions of failed loop over to goroutines. New
+// sessions of this loop are relayed by goroutines too.
+func (e *epollRelay) closeLoop(loop *epollLoop) {
+	for _, dir := range loop.close() {
+		go e.drive(dir)
+	}
+}
+
+func (e *epollRelay) sweep() {
+	ticker := time.NewTicker(epollSweepInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for _, loop := range e.loops {
+			for _, dir := range loop.expired(now) {
+				e.finish(dir, errRelayIdle)
+			}
+		}
+	}
+}
+
+func makeEpollEvent(id uint64) syscall.EpollEvent {
+	return syscall.EpollEvent{
+		Events: epollEvents,
+		Fd:     int32(uint32(id)),
+		Pad:    int32(uint32(id >> 32)),
+	}
+}
+
+func epollEventID(event *syscall.EpollEvent) uint64 {
+	return uint64(uint32(event.Fd)) | uint64(uint32(event.Pad))<<32
+}
+
+func socketFD(conn net.Conn) (int, bool) {
+	sconn, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, false
+	}
+	raw, err := sconn.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+
+	fd := -1
+	if err = raw.Control(func(value uintptr) { fd = int(value) }); err != nil || fd < 0 {
+		return 0, false
+	}
+
+	return fd, true
+}
+
+func newEpollRelay(fallback *goroutineRelay, idle time.Duration, logger Logger) (relayEngine, error) {
+	engine := &epollRelay{
+		loops:    make([]*epollLoop, runtime.GOMAXPROCS(0)),
+		fallback: fallback,
+		idle:     idle,
+		logger:   logger,
+	}
+
+	for idx := range engine.loops {
+		fd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+		if err != nil {
+			for _, loop := range engine.loops[:idx] {
+				syscall.Close(loop.fd) // nolint: errcheck, gas
+			}
+			return nil, errors.Annotate(err, "Cannot create epoll")
+		}
+		engine.loops[idx] = &epollLoop{
+			fd:         fd,
+			directions: map[uint64]*epollDirection{},
+		}
+	}
+
+	for _, loop := range engine.loops {
+		go engine.run(loop)
+	}
+	go engine.sweep()
+
+	return engine, nil
+}
@@ -0,0 +1,142 @@
+//go:build linux
+// +build linux
+
+package proxy
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func makeTCPPair(t *testing.T) (net.Conn, net.Conn) {
+	lsock, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lsock.Close()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		conn, _ := lsock.Accept()
+		accepted <- conn
+	}()
+
+	conn, err := net.Dial("tcp", lsock.Addr().String())
+	assert.Nil(t, err)
+
+	return conn, <-accepted
+}
+
+func makeRelayPeer(conn net.Conn, timeout time.Duration) relayPeer {
+	base := newTimeoutReadWriteCloser(conn, timeout, timeout)
+	return relayPeer{conn: newTrafficReadWriteCloser(base, func(int) {}, func(int) {}), base: base}
+}
+
+func makeEpollRelay(t *testing.T, idle time.Duration) *epollRelay {
+	engine, err := newEpollRelay(&goroutineRelay{
+		pump:   newPump(16, 0, func() {}),
+		linger: time.Second,
+	}, idle, zap.NewNop().Sugar())
+	assert.Nil(t, err)
+
+	return engine.(*epollRelay)
+}
+
+func TestEpollRelay(t *testing.T) {
+	client, clientSide := makeTCPPair(t)
+	defer client.Close()
+	telegramSide, telegram := makeTCPPair(t)
+	defer telegram.Close()
+
+	engine := makeEpollRelay(t, time.Minute)
+	done := make(chan struct{})
+	go func() {
+		engine.relay(makeRelayPeer(clientSide, time.Minute), makeRelayPeer(telegramSide, time.Minute))
+		close(done)
+	}()
+
+	message := []byte("message which is longer than relay buffer")
+	client.Write(message)
+	response := make([]byte, len(message))
+	_, err := io.ReadFull(telegram, response)
+	assert.Nil(t, err)
+	assert.Equal(t, message, response)
+
+	telegram.Write([]byte("pong"))
+	telegram.(*net.TCPConn).CloseWrite()
+	data, err := ioutil.ReadAll(client)
+	assert.Nil(t, err)
+	assert.Equal(t, "pong", string(data))
+
+	client.(*net.TCPConn).CloseWrite()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Relay is not finished")
+	}
+}
+
+func TestEpollRelayIdle(t *testing.T) {
+	client, clientSide := makeTCPPair(t)
+	defer client.Close()
+	telegramSide, telegram := makeTCPPair(t)
+	defer telegram.Close()
+
+	engine := makeEpollRelay(t, 100*time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		engine.relay(makeRelayPeer(clientSide, time.Minute), makeRelayPeer(telegramSide, time.Minute))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(3 * epollSweepInterval):
+		t.Fatal("Idle relay is not finished")
+	}
+}
+
+func TestEpollRelayClosedLoop(t *testing.T) {
+	client, clientSide := makeTCPPair(t)
+	defer client.Close()
+	telegramSide, telegram := makeTCPPair(t)
+	defer telegram.Close()
+
+	engine := makeEpollRelay(t, time.Minute)
+	done := make(chan struct{})
+	go func() {
+		engine.relay(makeRelayPeer(clientSide, time.Minute), makeRelayPeer(telegramSide, time.Minute))
+		close(done)
+	}()
+
+	client.Write([]byte("ping"))
+	response := make([]byte, 4)
+	_, err := io.ReadFull(telegram, response)
+	assert.Nil(t, err)
+
+	for _, loop := range engine.loops {
+		engine.closeLoop(loop)
+	}
+
+	client.Write([]byte("ping"))
+	_, err = io.ReadFull(telegram, response)
+	assert.Nil(t, err)
+	assert.Equal(t, "ping", string(response))
+
+	telegram.Write([]byte("pong"))
+	telegram.(*net.TCPConn).CloseWrite()
+	data, err := ioutil.ReadAll(client)
+	assert.Nil(t, err)
+	assert.Equal(t, "pong", string(data))
+
+	client.(*net.TCPConn).CloseWrite()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Relay is not finished")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package proxy
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+)
+
+func newEpollRelay(fallback *goroutineRelay, idle time.Duration, logger Logger) (relayEngine, error) {
+	return nil, errors.New("Epoll relay engine is supported only on Linux")
+}
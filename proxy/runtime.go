@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"encoding/json"
+	"runtime"
+	"sort"
+
+	"github.com/9seconds/mtg/limits"
+)
+
+type statsGCPauses struct {
+	P50 uint64 `json:"p50"`
+	P99 uint64 `json:"p99"`
+	Max uint64 `json:"max"`
+}
+
+// statsRuntime reports state of Go runtime at the moment stats are
+// requested. GC pauses are in microseconds and are calculated over last
+// 256 collections.
+type statsRuntime struct{}
+
+func (s statsRuntime) MarshalJSON() ([]byte, error) {
+	memStats := &runtime.MemStats{}
+	runtime.ReadMemStats(memStats)
+
+	data := struct {
+		Goroutines int           `json:"goroutines"`
+		HeapAlloc  uint64        `json:"heap_alloc"`
+		HeapSys    uint64        `json:"heap_sys"`
+		GCCount    uint32        `json:"gc_count"`
+		GCPauses   statsGCPauses `json:"gc_pauses"`
+		OpenFiles  *int          `json:"open_files,omitempty"`
+	}{
+		Goroutines: runtime.NumGoroutine(),
+		HeapAlloc:  memStats.HeapAlloc,
+		HeapSys:    memStats.HeapSys,
+		GCCount:    memStats.NumGC,
+		GCPauses:   gcPauses(memStats),
+	}
+	if openFiles, err := limits.CountOpenFiles(); err == nil {
+		data.OpenFiles = &openFiles
+	}
+
+	return json.Marshal(data)
+}
+
+func gcPauses(memStats *runtime.MemStats) statsGCPauses {
+	count := int(memStats.NumGC)
+	if count > len(memStats.PauseNs) {
+		count = len(memStats.PauseNs)
+	}
+	if count == 0 {
+		return statsGCPauses{}
+	}
+
+	pauses := make([]uint64, count)
+	copy(pauses, memStats.PauseNs[:count])
+	sort.Slice(pauses, func(i, j int) bool { return pauses[i] < pauses[j] })
+
+	return statsGCPauses{
+		P50: pauses[count/2] / 1000,
+		P99: pauses[count*99/100] / 1000,
+		Max: pauses[count-1] / 1000,
+	}
+}
@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsRuntime(t *testing.T) {
+	encoded, err := json.Marshal(statsRuntime{})
+	assert.Nil(t, err)
+
+	data := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(encoded, &data))
+	assert.True(t, data["goroutines"].(float64) > 0)
+	assert.True(t, data["heap_sys"].(float64) > 0)
+	assert.Contains(t, data, "gc_pauses")
+}
+
+func TestGCPauses(t *testing.T) {
+	memStats := &runtime.MemStats{}
+	assert.Equal(t, statsGCPauses{}, gcPauses(memStats))
+
+	memStats.NumGC = 3
+	memStats.PauseNs[0] = 3000
+	memStats.PauseNs[1] = 1000
+	memStats.PauseNs[2] = 2000
+	assert.Equal(t, statsGCPauses{P50: 2, P99: 3, Max: 3}, gcPauses(memStats))
+}
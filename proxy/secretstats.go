@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"encoding/json"
+	"sync/atomic"
+)
+
+// statsSecret is a client traffic of the secret. Upload is traffic from
+// clients, download is traffic to clients. Unlike global traffic
+// counters, it does not include Telegram side of connections.
+type statsSecret struct {
+	Upload   uint64 `json:"upload"`
+	Download uint64 `json:"download"`
+}
+
+func (s *statsSecret) addUpload(n int) {
+	atomic.AddUint64(&s.Upload, uint64(n))
+}
+
+func (s *statsSecret) addDownload(n int) {
+	atomic.AddUint64(&s.Download, uint64(n))
+}
+
+func (s *statsSecret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Upload   uint64 `json:"upload"`
+		Download uint64 `json:"download"`
+	}{
+		Upload:   atomic.LoadUint64(&s.Upload),
+		Download: atomic.LoadUint64(&s.Download),
+	})
+}
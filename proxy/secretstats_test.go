@@ -0,0 +1,20 @@
+package proxy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsSecret(t *testing.T) {
+	conf := &config.Config{Secret: make([]byte, 16)}
+	stat := NewStats(conf)
+	stat.secret.addUpload(10)
+	stat.secret.addDownload(100)
+
+	encoded, err := json.Marshal(stat.Secrets)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"`+conf.SecretID()+`": {"upload": 10, "download": 100}}`, string(encoded))
+}
@@ -6,162 +6,572 @@ import (
 	"net"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/9seconds/mtg/config"
+	"github.com/9seconds/mtg/geoip"
 	"github.com/9seconds/mtg/obfuscated2"
+	"github.com/9seconds/mtg/systemd"
 	"github.com/juju/errors"
-	uuid "github.com/satori/go.uuid"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 // Server is an insgtance of MTPROTO proxy.
 type Server struct {
-	ip           net.IP
-	port         int
-	secret       []byte
-	logger       *zap.SugaredLogger
-	ctx          context.Context
-	readTimeout  time.Duration
-	writeTimeout time.Duration
-	stats        *Stats
-	ipv6         bool
-}
-
-// Serve does MTPROTO proxying.
+	// accessed atomically, have to be 64-bit aligned
+	lastSocketID  uint64
+	acceptBeat    int64
+	quotaExceeded int32
+
+	conf      *config.Config
+	logger    Logger
+	zlog      *zap.Logger
+	stats     *Stats
+	collector multiStatsCollector
+	pump      *pump
+	engine    relayEngine
+	sockets   socketWrapper
+	dialer    Dialer
+	geoDB     *geoip.Database
+	asnDB     *geoip.Database
+	asnFilter *asnFilter
+	knock     *knockGate
+
+	tarpitSlots  chan struct{}
+	fingerprints *zap.Logger
+	webhooks     *webhooks
+	events       *eventRing
+
+	middlewares     []Middleware
+	connectHooks    []Hook
+	disconnectHooks []Hook
+	sessions        *sessions
+	listeners       *listeners
+	watchdog        time.Duration
+	draining        chan struct{}
+	drainOnce       sync.Once
+	drainPeriod     time.Duration
+}
+
+// Serve does MTPROTO proxying. It is the same as ServeContext with
+// background context.
 func (s *Server) Serve() error {
-	addr := net.JoinHostPort(s.ip.String(), strconv.Itoa(s.port))
-	lsock, err := net.Listen("tcp", addr)
+	return s.ServeContext(context.Background())
+}
+
+// ServeContext does MTPROTO proxying. If context is cancelled, server is
+// drained for configured drain period. It returns nil after server is
+// drained.
+func (s *Server) ServeContext(ctx context.Context) error {
+	lsock, err := s.listen(s.conf.BindAddr())
 	if err != nil {
-		return errors.Annotate(err, "Cannot create listen socket")
+		return err
 	}
 
-	for {
-		if conn, err := lsock.Accept(); err != nil {
-			s.logger.Warn("Cannot allocate incoming connection", "error", err)
-		} else {
-			go s.accept(conn)
+	return s.serve(ctx, lsock)
+}
+
+func (s *Server) listen(addr string) (net.Listener, error) {
+	var lsock net.Listener
+	var err error
+	if s.conf.MultipathTCP {
+		if lsock, err = listenMultipath(s.conf.ListenNetwork(), addr); err != nil {
+			s.logger.Warnw("Cannot create Multipath TCP listener", "error", err)
+		}
+	}
+	if lsock == nil {
+		lsock, err = net.Listen(s.conf.ListenNetwork(), addr)
+	}
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot create listen socket")
+	}
+
+	if s.conf.ListenBacklog > 0 {
+		if err := controlListener(lsock, listenBacklog(s.conf.ListenBacklog)); err != nil {
+			s.logger.Warnw("Cannot set listen backlog", "error", err)
 		}
 	}
+	if s.conf.FastOpen {
+		if err := setListenerFastOpen(lsock); err != nil {
+			s.logger.Warnw("Cannot enable TCP Fast Open on listener", "error", err)
+		}
+	}
+
+	return lsock, nil
+}
+
+// ServeListener does MTPROTO proxying on connections accepted from given
+// listener. Listener is closed when server is drained.
+func (s *Server) ServeListener(lsock net.Listener) error {
+	return s.serve(context.Background(), lsock)
+}
+
+func (s *Server) serve(ctx context.Context, lsock net.Listener) error {
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Drain(s.conf.DrainPeriod)
+		case <-s.draining:
+		case <-stopped:
+			return
+		}
+		s.listeners.closeAll()
+	}()
+
+	s.stats.health.setAlive(true)
+	defer s.stats.health.setAlive(false)
+	go s.checkReadiness(stopped)
+	go s.monitorListenOverflows(stopped)
+	go s.reloadGeoIPDatabases(stopped)
+	go s.checkpointState(stopped)
+	go s.probeDCs(stopped)
+	go s.enforceQuota(stopped)
+	go s.measureBandwidth(stopped)
+	defer s.saveState()
+	if s.knock != nil && s.conf.KnockPort != 0 {
+		go s.serveKnockUDP(stopped)
+	}
+
+	if _, ok := lsock.(deadlineListener); ok && s.watchdog > 0 {
+		go s.runWatchdog(s.watchdog, stopped)
+	}
+	s.notify(EventStart, map[string]interface{}{
+		"addr":    lsock.Addr().String(),
+		"version": s.conf.Build.Version,
+	})
+
+	announce := net.JoinHostPort(s.conf.ServerName, strconv.Itoa(int(s.conf.PublicPort)))
+	if s.listeners.add(lsock, announce) == nil {
+		s.acceptLoop(lsock, s.watchdog)
+	}
+	<-s.draining
+	s.waitDrained()
+	s.webhooks.send(s.event(EventStop, nil))
+
+	return nil
 }
 
 func (s *Server) accept(conn net.Conn) {
+	socketID := s.makeSocketID()
 	defer func() {
-		s.stats.closeConnection()
+		s.collector.CloseConnection()
 		conn.Close() // nolint: errcheck
 
 		if r := recover(); r != nil {
-			s.logger.Errorw("Crash of accept handler", "error", r)
+			s.logger.Errorw("Crash of accept handler", "socketid", socketID, "error", r)
 		}
 	}()
 
-	s.stats.newConnection()
-	ctx, cancel := context.WithCancel(context.Background())
-	socketID := s.makeSocketID()
-
-	s.logger.Debugw("Client connected",
-		"secret", s.secret,
-		"addr", conn.RemoteAddr().String(),
-		"socketid", socketID,
-	)
+	s.collector.NewConnection()
 
-	clientConn, dc, err := s.getClientStream(ctx, cancel, conn, socketID)
-	if err != nil {
-		s.logger.Warnw("Cannot initialize client connection",
-			"secret", s.secret,
-			"addr", conn.RemoteAddr().String(),
+	if s.isFiltered(conn.RemoteAddr(), socketID) {
+		if s.tarpitSlots == nil || !s.tarpit(conn) {
+			setAbortiveClose(conn) // nolint: errcheck
+		}
+		return
+	}
+	if s.conf.MaxConnections > 0 && s.sessions.count() >= s.conf.MaxConnections {
+		s.logger.Debugw("Reject connection, too many clients",
 			"socketid", socketID,
-			"error", err,
+			"addr", conn.RemoteAddr(),
 		)
+		s.recordSession(EventRejected, socketID, conn.RemoteAddr(), "reason", "max_connections")
+		setAbortiveClose(conn) // nolint: errcheck
+		return
+	}
+	if s.isQuotaExceeded() && s.hasQuotaAction(QuotaActionRefuse) {
+		s.logger.Debugw("Reject connection, traffic quota is exceeded",
+			"socketid", socketID,
+			"addr", conn.RemoteAddr(),
+		)
+		s.recordSession(EventRejected, socketID, conn.RemoteAddr(), "reason", "quota")
+		setAbortiveClose(conn) // nolint: errcheck
+		return
+	}
+	s.sessions.add(socketID, conn)
+	defer s.sessions.remove(socketID)
+	ctx, cancel := context.WithCancel(withClientAddr(context.Background(), conn.RemoteAddr()))
+
+	if err := setSocketBuffers(conn, s.conf.ClientReadBuffer, s.conf.ClientWriteBuffer); err != nil {
+		s.logger.Warnw("Cannot set socket buffers", "socketid", socketID, "error", err)
+	}
+	if err := setKeepAlive(conn, s.clientKeepAlive()); err != nil {
+		s.logger.Warnw("Cannot set keepalive", "socketid", socketID, "error", err)
+	}
+	if s.conf.AbortiveClose == AbortiveCloseAlways {
+		setAbortiveClose(conn) // nolint: errcheck
+	}
+
+	fields := []zap.Field{
+		zap.Stringer("addr", conn.RemoteAddr()),
+		zap.Stringer("socketid", socketID),
+	}
+	country := s.clientCountry(conn.RemoteAddr())
+	if country != "" {
+		fields = append(fields, zap.String("country", country))
+	}
+	if ce := s.zlog.Check(zapcore.DebugLevel, "Client connected"); ce != nil {
+		ce.Write(append(fields, zap.Binary("secret", s.conf.Secret))...)
+	}
+
+	startedAt := time.Now()
+	traffic := &sessionTraffic{}
+	if country != "" {
+		s.collector.AddCountryConnection(country)
+		defer func() {
+			s.collector.AddCountryTraffic(country, atomic.LoadUint64(&traffic.in), atomic.LoadUint64(&traffic.out))
+		}()
+	}
+	clientBase := s.wrapTimeouts(conn)
+	probe := newHandshakeProbe()
+	clientConn, dc, err := s.getClientStream(ctx, cancel, clientBase, socketID, traffic, probe)
+	if err != nil {
+		reason := handshakeFailureReason(err)
+		s.collector.AddHandshakeFailure(reason)
+		s.logFingerprint(conn, socketID, country, probe, err)
+		s.zlog.Warn("Cannot initialize client connection",
+			append(fields, zap.Binary("secret", s.conf.Secret), zap.Error(err))...)
+		s.recordSession(EventHandshakeFailed, socketID, conn.RemoteAddr(),
+			"country", country, "reason", reason)
+		s.closeMisbehaving(conn)
+		if country != "" {
+			s.collector.AddCountryFailedHandshake(country)
+		}
 		return
 	}
 	defer clientConn.Close() // nolint: errcheck
 
-	tgConn, err := s.getTelegramStream(ctx, cancel, dc, socketID)
+	telegram, err := s.getTelegramStream(ctx, cancel, dc, socketID)
 	if err != nil {
-		s.logger.Warnw("Cannot initialize Telegram connection",
-			"socketid", socketID,
-			"error", err,
-		)
+		s.zlog.Warn("Cannot initialize Telegram connection", append(fields, zap.Error(err))...)
+		s.recordSession(EventTelegramFailed, socketID, conn.RemoteAddr(),
+			"country", country, "dc", dc, "error", err.Error())
 		return
 	}
-	defer tgConn.Close() // nolint: errcheck
+	defer telegram.conn.Close() // nolint: errcheck
 
-	wait := &sync.WaitGroup{}
-	wait.Add(2)
-	go func() {
-		defer wait.Done()
-		io.Copy(clientConn, tgConn) // nolint: errcheck
-	}()
-	go func() {
-		defer wait.Done()
-		io.Copy(tgConn, clientConn) // nolint: errcheck
+	info := SessionInfo{
+		SocketID:  socketID,
+		Addr:      conn.RemoteAddr(),
+		Country:   country,
+		Secret:    append([]byte(nil), s.conf.Secret...),
+		DC:        dc,
+		StartedAt: startedAt,
+	}
+	s.runHooks(s.connectHooks, info)
+	s.recordSession(EventConnect, socketID, info.Addr, "country", country, "dc", dc)
+	defer func() {
+		info.BytesIn = atomic.LoadUint64(&traffic.in)
+		info.BytesOut = atomic.LoadUint64(&traffic.out)
+		info.Duration = time.Since(startedAt)
+		s.runHooks(s.disconnectHooks, info)
+		s.recordSession(EventDisconnect, socketID, info.Addr,
+			"bytes_in", info.BytesIn, "bytes_out", info.BytesOut, "duration", info.Duration.String())
 	}()
-	<-ctx.Done()
-	wait.Wait()
 
-	s.logger.Debugw("Client disconnected",
-		"secret", s.secret,
-		"addr", conn.RemoteAddr().String(),
+	if s.conf.MaxSessionLifetime > 0 {
+		timer := time.AfterFunc(s.conf.MaxSessionLifetime, func() {
+			s.zlog.Info("Close session, maximal lifetime is reached", fields...)
+			conn.Close() // nolint: errcheck
+		})
+		defer timer.Stop()
+	}
+
+	s.engine.relay(relayPeer{conn: clientConn, base: clientBase}, telegram)
+	cancel()
+	s.collector.AddDCSession(dc, atomic.LoadUint64(&traffic.in), atomic.LoadUint64(&traffic.out), time.Since(startedAt))
+
+	s.zlog.Debug("Client disconnected", fields...)
+}
+
+// checkReadiness periodically verifies that Telegram is reachable and
+// updates readiness state accordingly. Systemd is notified that proxy is
+// ready after the first successful check.
+func (s *Server) checkReadiness(stopped <-chan struct{}) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	notified := false
+	for {
+		reachable := s.isTelegramReachable()
+		s.stats.health.setReady(reachable)
+
+		state := s.systemdStatus(reachable)
+		if reachable && !notified {
+			state = "READY=1\n" + state
+			notified = s.notifySystemd(state)
+		} else {
+			s.notifySystemd(state)
+		}
+
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) isTelegramReachable() bool {
+	addresses := telegramAddresses(s.conf.TestDCs)
+	for idx := range addresses {
+		conn, err := s.dialer.Dial(context.Background(), &addresses[idx])
+		if err == nil {
+			conn.Close() // nolint: errcheck
+			return true
+		}
+		s.logger.Debugw("Telegram DC is unreachable", "dc", idx+1, "error", err)
+	}
+
+	return false
+}
+
+// wrapTimeouts wraps socket into relay engine specific connection and
+// applies configured timeout policy.
+func (s *Server) wrapTimeouts(conn net.Conn) *TimeoutReadWriteCloser {
+	base := newTimeoutReadWriteCloser(s.wrapSocket(conn), s.conf.ReadTimeout, s.conf.WriteTimeout)
+	base.idle = s.conf.TimeoutPolicy == TimeoutPolicyIdle
+
+	return base
+}
+
+// closeMisbehaving makes connection of misbehaving client to be closed
+// with RST if it is configured.
+func (s *Server) closeMisbehaving(conn net.Conn) {
+	if s.conf.AbortiveClose == AbortiveCloseMisbehaving {
+		setAbortiveClose(conn) // nolint: errcheck
+	}
+}
+
+// wrapLogReadWriteCloser adds logging of each read and write. It is
+// done only in debug mode, otherwise stream is returned as is.
+func (s *Server) wrapLogReadWriteCloser(conn io.ReadWriteCloser, socketID SocketID, name string) io.ReadWriteCloser {
+	if !s.zlog.Core().Enabled(zapcore.DebugLevel) {
+		return conn
+	}
+
+	return newLogReadWriteCloser(conn, s.zlog, socketID, name)
+}
+
+// reportHandshakeTraffic reports failed handshake as non-MTPROTO only
+// if it is recognized as other protocol. Random bytes are what client
+// with wrong secret sends, such failures are counted by handshake
+// failure reasons.
+func (s *Server) reportHandshakeTraffic(socketID SocketID, frame []byte) {
+	if kind := detectHandshakeTraffic(frame); kind != trafficUnknown {
+		s.reportNonMTProto(socketID, kind)
+	}
+}
+
+func (s *Server) reportNonMTProto(socketID SocketID, kind string) {
+	s.collector.AddNonMTProto(kind)
+	s.logger.Infow("Connection does not look like MTPROTO",
 		"socketid", socketID,
+		"kind", kind,
 	)
 }
 
-func (s *Server) makeSocketID() string {
-	return uuid.NewV4().String()
+func (s *Server) reportDeadPeer(socketID SocketID, stream string) {
+	s.collector.AddDeadPeer(stream)
+	s.logger.Infow("Dead peer detected, close connection",
+		"socketid", socketID,
+		"stream", stream,
+	)
 }
 
-func (s *Server) getClientStream(ctx context.Context, cancel context.CancelFunc, conn net.Conn, socketID string) (io.ReadWriteCloser, int16, error) {
-	wConn := newTimeoutReadWriteCloser(conn, s.readTimeout, s.writeTimeout)
-	wConn = newTrafficReadWriteCloser(wConn, s.stats.addIncomingTraffic, s.stats.addOutgoingTraffic)
-	frame, err := obfuscated2.ExtractFrame(wConn)
+func (s *Server) clientKeepAlive() keepAlive {
+	return keepAlive{
+		idle:     s.conf.ClientKeepAlive,
+		interval: s.conf.KeepAliveInterval,
+		probes:   s.conf.KeepAliveProbes,
+	}
+}
+
+func (s *Server) makeSocketID() SocketID {
+	return SocketID(atomic.AddUint64(&s.lastSocketID, 1))
+}
+
+func (s *Server) getClientStream(ctx context.Context, cancel context.CancelFunc, base *TimeoutReadWriteCloser, socketID SocketID, traffic *sessionTraffic, probe *handshakeProbe) (io.ReadWriteCloser, int16, error) {
+	wConn := newDeadPeerReadWriteCloser(base, func() {
+		s.reportDeadPeer(socketID, StreamClient)
+	})
+	if s.hasQuotaAction(QuotaActionThrottle) {
+		wConn = newThrottleReadWriteCloser(wConn, s.conf.QuotaThrottleRate, s.isQuotaExceeded)
+	}
+	if s.conf.RelayJitter > 0 {
+		wConn = newJitterReadWriteCloser(wConn, s.conf.RelayJitter)
+	}
+	if s.conf.SlowClientRate > 0 {
+		wConn = newSlowClientReadWriteCloser(wConn, s.conf.SlowClientRate, s.conf.SlowClientTimeout, func() {
+			s.collector.AddSlowClientEviction()
+			s.closeMisbehaving(base.conn)
+			s.zlog.Info("Evict slow client", zap.Stringer("socketid", socketID))
+		})
+	}
+	wConn = newTrafficReadWriteCloser(wConn,
+		func(n int) {
+			s.collector.AddIncomingTraffic(n)
+			traffic.addIn(n)
+			s.collector.AddSecretUpload(n)
+		},
+		func(n int) {
+			s.collector.AddOutgoingTraffic(n)
+			traffic.addOut(n)
+			s.collector.AddSecretDownload(n)
+		})
+	frame, err := obfuscated2.ExtractFrame(probe.wrap(wConn))
+	probe.frame = frame
 	if err != nil {
+		s.reportHandshakeTraffic(socketID, frame)
 		return nil, 0, errors.Annotate(err, "Cannot create client stream")
 	}
 
-	obfs2, dc, err := obfuscated2.ParseObfuscated2ClientFrame(s.secret, frame)
+	obfs2, dc, err := obfuscated2.ParseObfuscated2ClientFrame(s.conf.Secret, frame)
 	if err != nil {
+		s.reportHandshakeTraffic(socketID, frame)
 		return nil, 0, errors.Annotate(err, "Cannot create client stream")
 	}
 
-	wConn = newLogReadWriteCloser(wConn, s.logger, socketID, "client")
+	wConn = s.wrapLogReadWriteCloser(wConn, socketID, StreamClient)
 	wConn = newCipherReadWriteCloser(wConn, obfs2)
+	wConn = newFramingCheckReadWriteCloser(wConn, func() {
+		s.reportNonMTProto(socketID, trafficGarbage)
+	})
+	wConn = s.applyMiddlewares(wConn, StreamInfo{
+		SocketID: socketID,
+		Name:     StreamClient,
+		DC:       dc,
+	})
 	wConn = newCtxReadWriteCloser(ctx, cancel, wConn)
 
 	return wConn, dc, nil
 }
 
-func (s *Server) getTelegramStream(ctx context.Context, cancel context.CancelFunc, dc int16, socketID string) (io.ReadWriteCloser, error) {
-	socket, err := dialToTelegram(s.ipv6, dc, s.readTimeout)
+func (s *Server) getTelegramStream(ctx context.Context, cancel context.CancelFunc, dc int16, socketID SocketID) (relayPeer, error) {
+	addr, err := telegramAddress(dc, s.conf.DefaultDC, s.conf.TestDCs)
+	if err != nil {
+		return relayPeer{}, errors.Annotate(err, "Cannot resolve DC")
+	}
+	if ce := s.zlog.Check(zapcore.DebugLevel, "Resolved Telegram DC"); ce != nil {
+		ce.Write(zap.Stringer("socketid", socketID), zap.Int16("dc", dc), zap.String("addr", addr.IPv4()))
+	}
+
+	conn, base, err := s.dialTelegram(ctx, dc, addr, socketID)
 	if err != nil {
-		return nil, errors.Annotate(err, "Cannot dial")
+		return relayPeer{}, err
+	}
+	peer := relayPeer{conn: conn, base: base}
+
+	// Other relay engines work with sockets directly, so connection
+	// cannot be replaced.
+	if _, ok := s.engine.(*goroutineRelay); ok && s.conf.TelegramReconnects > 0 {
+		peer.reconnect = newReconnectReadWriteCloser(conn, base, s.conf.TelegramReconnects,
+			func() (io.ReadWriteCloser, *TimeoutReadWriteCloser, error) {
+				return s.dialTelegram(ctx, dc, addr, socketID)
+			},
+			func(cause error) {
+				s.collector.AddTelegramReconnect()
+				s.zlog.Info("Telegram connection is restored",
+					zap.Stringer("socketid", socketID), zap.Int16("dc", dc), zap.Error(cause))
+			})
+		peer.conn = peer.reconnect
 	}
-	wConn := newTimeoutReadWriteCloser(socket, s.readTimeout, s.writeTimeout)
-	wConn = newTrafficReadWriteCloser(wConn, s.stats.addIncomingTraffic, s.stats.addOutgoingTraffic)
+	peer.conn = newCtxReadWriteCloser(ctx, cancel, peer.conn)
+
+	return peer, nil
+}
+
+func (s *Server) dialTelegram(ctx context.Context, dc int16, addr *TelegramAddress, socketID SocketID) (io.ReadWriteCloser, *TimeoutReadWriteCloser, error) {
+	idx, _ := telegramDCIndex(dc, s.conf.DefaultDC, s.conf.TestDCs) // nolint: gas
+	if timeout, ok := s.conf.DCDialTimeouts[idx+1]; ok {
+		ctx = withDialTimeout(ctx, timeout)
+	}
+
+	var socket net.Conn
+	err := s.conf.Retry.Do(ctx, func() (err error) {
+		dialStarted := time.Now()
+		socket, err = s.dialer.Dial(ctx, addr)
+		s.collector.AddDCDial(dc, time.Since(dialStarted), err)
+		return
+	})
+	if err != nil {
+		return nil, nil, errors.Annotate(err, "Cannot dial")
+	}
+	base := s.wrapTimeouts(socket)
+	if timeout, ok := s.conf.DCReadTimeouts[idx+1]; ok {
+		base.readTimeout = timeout
+	}
+	wConn := newDeadPeerReadWriteCloser(base, func() {
+		s.reportDeadPeer(socketID, StreamTelegram)
+	})
+	wConn = newTrafficReadWriteCloser(wConn, s.collector.AddIncomingTraffic, s.collector.AddOutgoingTraffic)
 
 	obfs2, frame := obfuscated2.MakeTelegramObfuscated2Frame()
 	if n, err := socket.Write(frame); err != nil || n != len(frame) {
-		return nil, errors.Annotate(err, "Cannot write hadnshake frame")
+		socket.Close() // nolint: errcheck
+		return nil, nil, errors.Annotate(err, "Cannot write hadnshake frame")
 	}
 
-	wConn = newLogReadWriteCloser(wConn, s.logger, socketID, "telegram")
+	wConn = s.wrapLogReadWriteCloser(wConn, socketID, StreamTelegram)
 	wConn = newCipherReadWriteCloser(wConn, obfs2)
-	wConn = newCtxReadWriteCloser(ctx, cancel, wConn)
+	wConn = s.applyMiddlewares(wConn, StreamInfo{
+		SocketID: socketID,
+		Name:     StreamTelegram,
+		DC:       dc,
+	})
 
-	return wConn, nil
+	return wConn, base, nil
 }
 
-// NewServer creates new instance of MTPROTO proxy.
-func NewServer(ip net.IP, port int, secret []byte, logger *zap.SugaredLogger,
-	readTimeout, writeTimeout time.Duration, ipv6 bool, stat *Stats) *Server {
-	return &Server{
-		ip:           ip,
-		port:         port,
-		secret:       secret,
-		ctx:          context.Background(),
-		logger:       logger,
-		readTimeout:  readTimeout,
-		writeTimeout: writeTimeout,
-		stats:        stat,
-		ipv6:         ipv6,
+// NewServer creates new instance of MTPROTO proxy. Collector is usually
+// *Stats; if it has no builtin statistics, they are added, because
+// health checks and stats endpoint need them.
+func NewServer(conf *config.Config, logger Logger, collector StatsCollector) *Server {
+	collectors, stat := makeServerCollector(conf, collector)
+	srv := &Server{
+		conf:      conf,
+		logger:    logger,
+		zlog:      zapLogger(logger),
+		stats:     stat,
+		collector: collectors,
+		sessions:  newSessions(),
+		listeners: newListeners(),
+		watchdog:  systemd.WatchdogInterval(),
+		draining:  make(chan struct{}),
+	}
+	srv.pump = newPump(conf.RelayBufferSize, conf.BackpressureThreshold, func() {
+		srv.collector.AddBackpressureEvent()
+	})
+	srv.geoDB = srv.openGeoIPDatabase(conf.GeoIPDB)
+	srv.asnDB = srv.openGeoIPDatabase(conf.ASNDB)
+	srv.asnFilter = newASNFilter(conf.AllowASNs, conf.DenyASNs)
+	srv.webhooks = newWebhooks(conf.Webhooks, conf.WebhookEvents, conf.WebhookTemplate, logger)
+	srv.events = newEventRing(conf.EventBuffer)
+	if conf.TarpitMax > 0 {
+		srv.tarpitSlots = make(chan struct{}, conf.TarpitMax)
+	}
+	if conf.FingerprintLog != "" {
+		fingerprints, err := openFingerprintLog(conf.FingerprintLog)
+		if err != nil {
+			logger.Warnw("Cannot open fingerprint log", "error", err)
+		}
+		srv.fingerprints = fingerprints
+	}
+	if conf.KnockToken != "" {
+		srv.knock = newKnockGate(conf.KnockToken, conf.KnockPeriod)
+		stat.mux.HandleFunc("/knock", srv.knockHandler)
 	}
+	srv.dialer = srv.makeDialer()
+	srv.engine = srv.makeRelayEngine()
+	stat.Handle("/drain", srv.drainHandler)
+	stat.Handle("/listeners", srv.listenersHandler)
+	if srv.events != nil {
+		stat.Handle("/events", srv.eventsHandler)
+	}
+
+	return srv
 }
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/9seconds/mtg/obfuscated2"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestServeContextCancel(t *testing.T) {
+	conf := &config.Config{
+		BindIP:      net.ParseIP("127.0.0.1"),
+		DrainPeriod: time.Second,
+	}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+	srv.SetDialer(&fakeDialer{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		result <- srv.ServeContext(ctx)
+	}()
+	cancel()
+
+	select {
+	case err := <-result:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server is not stopped")
+	}
+	assert.False(t, srv.stats.health.isReady())
+}
+
+func TestServeListenerDrain(t *testing.T) {
+	conf := &config.Config{}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+	srv.SetDialer(&fakeDialer{})
+
+	lsock, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	result := make(chan error)
+	go func() {
+		result <- srv.ServeListener(lsock)
+	}()
+	srv.Drain(time.Second)
+
+	select {
+	case err := <-result:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server is not stopped")
+	}
+
+	_, err = net.Dial("tcp", lsock.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestAcceptMaxConnections(t *testing.T) {
+	conf := &config.Config{MaxConnections: 1}
+	stat := NewStats(conf)
+	srv := NewServer(conf, zap.NewNop().Sugar(), stat)
+
+	busy, _ := net.Pipe()
+	defer busy.Close()
+	srv.sessions.add(srv.makeSocketID(), busy)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	srv.accept(server)
+
+	_, err := client.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, srv.sessions.count())
+	assert.Equal(t, uint32(0), stat.ActiveConnections)
+}
+
+type pipeDialer struct{}
+
+func (pipeDialer) Dial(ctx context.Context, addr *TelegramAddress) (net.Conn, error) {
+	client, server := net.Pipe()
+	go io.Copy(ioutil.Discard, server) // nolint: errcheck
+
+	return client, nil
+}
+
+func TestAcceptMaxSessionLifetime(t *testing.T) {
+	secret := make([]byte, 16)
+	conf := &config.Config{
+		Secret:             secret,
+		ReadTimeout:        time.Minute,
+		WriteTimeout:       time.Minute,
+		MaxSessionLifetime: 100 * time.Millisecond,
+	}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+	srv.SetDialer(pipeDialer{})
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go io.Copy(ioutil.Discard, client) // nolint: errcheck
+
+	done := make(chan struct{})
+	go func() {
+		srv.accept(server)
+		close(done)
+	}()
+	_, frame := obfuscated2.MakeClientObfuscated2Frame(secret, 2)
+	_, err := client.Write(frame)
+	assert.Nil(t, err)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Session is not closed")
+	}
+}
+
+func TestListenClientIPv6Only(t *testing.T) {
+	conf := &config.Config{ClientIPv6Only: true}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+
+	lsock, err := srv.listen("[::]:0")
+	if err != nil {
+		t.Skip("IPv6 is not available")
+	}
+	defer lsock.Close() // nolint: errcheck
+
+	_, port, _ := net.SplitHostPort(lsock.Addr().String())
+	_, err = net.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+	assert.Error(t, err)
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("::1", port))
+	if assert.Nil(t, err) {
+		conn.Close() // nolint: errcheck
+	}
+}
+
+func TestCheckReadinessStops(t *testing.T) {
+	conf := &config.Config{}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+	srv.SetDialer(&fakeDialer{reachable: map[string]bool{TelegramAddresses[0].IPv4(): true}})
+
+	stopped := make(chan struct{})
+	close(stopped)
+	done := make(chan struct{})
+	go func() {
+		srv.checkReadiness(stopped)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Readiness check is not stopped")
+	}
+	srv.stats.health.setAlive(true)
+	assert.True(t, srv.stats.health.isReady())
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sessions keeps track of client connections which are currently
+// served.
+type sessions struct {
+	mutex sync.Mutex
+	wait  sync.WaitGroup
+	conns map[SocketID]net.Conn
+}
+
+// SocketID identifies client connection. It is formatted only if it is
+// actually logged.
+type SocketID uint64
+
+// String returns decimal representation of SocketID.
+func (s SocketID) String() string {
+	return strconv.FormatUint(uint64(s), 10)
+}
+
+func (s *sessions) add(socketID SocketID, conn net.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.wait.Add(1)
+	s.conns[socketID] = conn
+}
+
+func (s *sessions) remove(socketID SocketID) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.conns[socketID]; ok {
+		delete(s.conns, socketID)
+		s.wait.Done()
+	}
+}
+
+func (s *sessions) count() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.conns)
+}
+
+func (s *sessions) closeAll() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, conn := range s.conns {
+		conn.Close() // nolint: errcheck
+	}
+}
+
+// waitTimeout waits until all sessions are finished. It returns false
+// if timeout has passed earlier.
+func (s *sessions) waitTimeout(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.wait.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func newSessions() *sessions {
+	return &sessions{conns: map[SocketID]net.Conn{}}
+}
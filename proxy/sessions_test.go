@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionsWaitTimeout(t *testing.T) {
+	s := newSessions()
+	client, server := net.Pipe()
+	defer server.Close()
+
+	s.add(1, client)
+	assert.Equal(t, 1, s.count())
+	assert.False(t, s.waitTimeout(10*time.Millisecond))
+
+	s.remove(1)
+	s.remove(1)
+	assert.Equal(t, 0, s.count())
+	assert.True(t, s.waitTimeout(10*time.Millisecond))
+}
+
+func TestSessionsCloseAll(t *testing.T) {
+	s := newSessions()
+	client, server := net.Pipe()
+	defer server.Close()
+
+	s.add(1, client)
+	s.closeAll()
+
+	_, err := client.Write([]byte{1})
+	assert.Error(t, err)
+}
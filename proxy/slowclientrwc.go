@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"io"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const slowClientChunkSize = 16 * 1024
+
+// SlowClientReadWriteCloser watches how fast client consumes data written
+// to it. Writes are split into chunks and rate of each chunk is measured.
+// If client consumes slower than minRate bytes per second for longer than
+// timeout, writes fail and session is closed. Slow period is reset by a
+// fast chunk or by a pause in writes longer than timeout.
+type SlowClientReadWriteCloser struct {
+	conn      io.ReadWriteCloser
+	minRate   float64
+	timeout   time.Duration
+	slowSince time.Time
+	lastWrite time.Time
+	onEvict   func()
+}
+
+// Read reads from connection
+func (s *SlowClientReadWriteCloser) Read(p []byte) (int, error) {
+	return s.conn.Read(p)
+}
+
+// Write writes into connection.
+func (s *SlowClientReadWriteCloser) Write(p []byte) (int, error) {
+	allWritten := 0
+
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > slowClientChunkSize {
+			chunk = chunk[:slowClientChunkSize]
+		}
+
+		started := time.Now()
+		n, err := s.conn.Write(chunk)
+		allWritten += n
+		if err != nil {
+			return allWritten, err
+		}
+		if s.isTooSlow(n, started, time.Now()) {
+			s.onEvict()
+			return allWritten, errors.New("Client consumes data too slowly")
+		}
+
+		p = p[n:]
+	}
+
+	return allWritten, nil
+}
+
+// isTooSlow tells if chunk written from started to now is slow and
+// client has been slow for timeout already.
+func (s *SlowClientReadWriteCloser) isTooSlow(written int, started, now time.Time) bool {
+	idle := started.Sub(s.lastWrite)
+	s.lastWrite = now
+	elapsed := now.Sub(started).Seconds()
+
+	if elapsed == 0 || float64(written)/elapsed >= s.minRate {
+		s.slowSince = time.Time{}
+		return false
+	}
+
+	if s.slowSince.IsZero() || idle > s.timeout {
+		s.slowSince = started
+	}
+	return now.Sub(s.slowSince) >= s.timeout
+}
+
+// CloseWrite closes writing side of underlying connection.
+func (s *SlowClientReadWriteCloser) CloseWrite() error {
+	return closeWrite(s.conn)
+}
+
+// Close closes underlying connection.
+func (s *SlowClientReadWriteCloser) Close() error {
+	return s.conn.Close()
+}
+
+func newSlowClientReadWriteCloser(conn io.ReadWriteCloser, minRate int, timeout time.Duration,
+	onEvict func()) io.ReadWriteCloser {
+	return &SlowClientReadWriteCloser{
+		conn:    conn,
+		minRate: float64(minRate),
+		timeout: timeout,
+		onEvict: onEvict,
+	}
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowClientIsTooSlow(t *testing.T) {
+	type chunk struct {
+		start    time.Duration
+		duration time.Duration
+		evicted  bool
+	}
+
+	// min rate is 1000 bytes per second, chunks are 1000 bytes
+	tests := []struct {
+		name   string
+		chunks []chunk
+	}{
+		{"fast", []chunk{
+			{0, 100 * time.Millisecond, false},
+			{time.Second, 500 * time.Millisecond, false},
+			{10 * time.Second, time.Second, false},
+		}},
+		{"sustained slow", []chunk{
+			{0, 4 * time.Second, false},
+			{4 * time.Second, 4 * time.Second, false},
+			{8 * time.Second, 4 * time.Second, true},
+		}},
+		{"fast chunk resets", []chunk{
+			{0, 8 * time.Second, false},
+			{8 * time.Second, 100 * time.Millisecond, false},
+			{9 * time.Second, 8 * time.Second, false},
+		}},
+		{"idle gap resets", []chunk{
+			{0, 2 * time.Second, false},
+			{time.Minute, 2 * time.Second, false},
+			{2 * time.Minute, 2 * time.Second, false},
+		}},
+		{"slow after short pause", []chunk{
+			{0, 6 * time.Second, false},
+			{7 * time.Second, 4 * time.Second, true},
+		}},
+	}
+
+	for _, test := range tests {
+		client := &SlowClientReadWriteCloser{minRate: 1000, timeout: 10 * time.Second}
+		base := time.Now()
+		for idx, c := range test.chunks {
+			started := base.Add(c.start)
+			assert.Equal(t, c.evicted, client.isTooSlow(1000, started, started.Add(c.duration)),
+				"%s: chunk %d", test.name, idx)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/juju/errors"
+)
+
+// controlListener applies control to raw listening socket.
+func controlListener(lsock net.Listener, control socketControl) error {
+	sconn, ok := lsock.(syscall.Conn)
+	if !ok {
+		return errors.New("Listener does not provide raw socket")
+	}
+	raw, err := sconn.SyscallConn()
+	if err != nil {
+		return errors.Annotate(err, "Cannot get raw socket")
+	}
+
+	var controlErr error
+	if err = raw.Control(func(fd uintptr) { controlErr = control(fd) }); err != nil {
+		return errors.Annotate(err, "Cannot get raw socket")
+	}
+
+	return controlErr
+}
+
+// unwrapSyscallError returns underlying error of system call if network
+// operation has failed with it.
+func unwrapSyscallError(err error) error {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+
+	return err
+}
+
+// Policies of abortive close. Connections closed abortively send RST
+// instead of FIN, so they do not stay in FIN_WAIT and TIME_WAIT states.
+const (
+	AbortiveCloseNever       = "never"
+	AbortiveCloseMisbehaving = "misbehaving"
+	AbortiveCloseAlways      = "always"
+)
+
+type lingerSetter interface {
+	SetLinger(int) error
+}
+
+// setAbortiveClose makes connection to send RST on close.
+func setAbortiveClose(conn net.Conn) error {
+	if setter, ok := conn.(lingerSetter); ok {
+		return setter.SetLinger(0)
+	}
+
+	return nil
+}
+
+type bufferSetter interface {
+	SetReadBuffer(int) error
+	SetWriteBuffer(int) error
+}
+
+// setSocketBuffers sets sizes of kernel socket buffers. Zero size keeps
+// system default.
+func setSocketBuffers(conn net.Conn, readSize, writeSize int) error {
+	setter, ok := conn.(bufferSetter)
+	if !ok {
+		return nil
+	}
+
+	if readSize > 0 {
+		if err := setter.SetReadBuffer(readSize); err != nil {
+			return errors.Annotate(err, "Cannot set read buffer")
+		}
+	}
+	if writeSize > 0 {
+		if err := setter.SetWriteBuffer(writeSize); err != nil {
+			return errors.Annotate(err, "Cannot set write buffer")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getSocketOption(t *testing.T, conn net.Conn, option int) int {
+	raw, err := conn.(syscall.Conn).SyscallConn()
+	assert.Nil(t, err)
+
+	var value int
+	raw.Control(func(fd uintptr) {
+		value, err = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, option)
+	})
+	assert.Nil(t, err)
+
+	return value
+}
+
+func TestSetSocketBuffers(t *testing.T) {
+	lsock, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lsock.Close()
+
+	conn, err := net.Dial("tcp", lsock.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	defaultWrite := getSocketOption(t, conn, syscall.SO_SNDBUF)
+	assert.Nil(t, setSocketBuffers(conn, 64*1024, 0))
+	assert.True(t, getSocketOption(t, conn, syscall.SO_RCVBUF) >= 64*1024)
+	assert.Equal(t, defaultWrite, getSocketOption(t, conn, syscall.SO_SNDBUF))
+}
+
+func TestSetSocketBuffersNotTCP(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	assert.Nil(t, setSocketBuffers(client, 1024, 1024))
+}
+
+func TestSetAbortiveClose(t *testing.T) {
+	lsock, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lsock.Close()
+
+	conn, err := net.Dial("tcp", lsock.Addr().String())
+	assert.Nil(t, err)
+	server, err := lsock.Accept()
+	assert.Nil(t, err)
+	defer server.Close()
+
+	assert.Nil(t, setAbortiveClose(conn))
+	conn.Close()
+
+	_, err = server.Read(make([]byte, 1))
+	assert.Contains(t, err.Error(), "connection reset by peer")
+}
+
+func TestSetAbortiveCloseNotTCP(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	assert.Nil(t, setAbortiveClose(client))
+}
@@ -0,0 +1,225 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const (
+	stateCheckpointInterval = time.Minute
+	stateDayFormat          = "2006-01-02"
+)
+
+type secretState struct {
+	Incoming uint64 `json:"incoming"`
+	Outgoing uint64 `json:"outgoing"`
+	Upload   uint64 `json:"upload"`
+	Download uint64 `json:"download"`
+}
+
+type dayUsage struct {
+	Upload   uint64 `json:"upload"`
+	Download uint64 `json:"download"`
+}
+
+// statsState is a content of state file with lifetime counters.
+// Traffic is kept per secret, secrets are identified by their IDs.
+// Daily usage is keyed by UTC date first and secret ID then.
+type statsState struct {
+	AllConnections uint64                         `json:"all_connections"`
+	Secrets        map[string]secretState         `json:"secrets"`
+	Daily          map[string]map[string]dayUsage `json:"daily,omitempty"`
+}
+
+// SecretUsage is a client traffic of a secret over some period.
+type SecretUsage struct {
+	SecretID string `json:"secret_id"`
+	Upload   uint64 `json:"upload"`
+	Download uint64 `json:"download"`
+}
+
+func readState(path string) (*statsState, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &statsState{}
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, errors.Annotate(err, "Cannot parse state file")
+	}
+
+	return state, nil
+}
+
+// ReadUsage sums daily traffic of each secret from state file for days
+// from since to until inclusive. Result is sorted by secret ID.
+func ReadUsage(path string, since, until time.Time) ([]SecretUsage, error) {
+	state, err := readState(path)
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot read state file")
+	}
+
+	first := since.UTC().Format(stateDayFormat)
+	last := until.UTC().Format(stateDayFormat)
+	totals := map[string]*SecretUsage{}
+	for day, secrets := range state.Daily {
+		if day < first || day > last {
+			continue
+		}
+		for id, traffic := range secrets {
+			total, ok := totals[id]
+			if !ok {
+				total = &SecretUsage{SecretID: id}
+				totals[id] = total
+			}
+			total.Upload += traffic.Upload
+			total.Download += traffic.Download
+		}
+	}
+
+	usage := make([]SecretUsage, 0, len(totals))
+	for _, total := range totals {
+		usage = append(usage, *total)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].SecretID < usage[j].SecretID
+	})
+
+	return usage, nil
+}
+
+// LoadState restores lifetime counters from state file. It is fine if
+// file does not exist yet. It has to be called before Serve.
+func (s *Stats) LoadState(path string) error {
+	state, err := readState(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Annotate(err, "Cannot read state file")
+	}
+
+	atomic.AddUint64(&s.AllConnections, state.AllConnections)
+	if traffic, ok := state.Secrets[s.conf.SecretID()]; ok {
+		atomic.AddUint64(&s.Traffic.Incoming, traffic.Incoming)
+		atomic.AddUint64(&s.Traffic.Outgoing, traffic.Outgoing)
+		atomic.AddUint64(&s.secret.Upload, traffic.Upload)
+		atomic.AddUint64(&s.secret.Download, traffic.Download)
+		s.savedUsage = dayUsage{Upload: traffic.Upload, Download: traffic.Download}
+	}
+	s.savedSecrets = state.Secrets
+	s.savedDaily = state.Daily
+
+	return nil
+}
+
+// SaveState writes lifetime counters to state file. File is replaced
+// atomically, so it is never left half-written. Traffic since previous
+// save is added to usage of the current day.
+func (s *Stats) SaveState(path string) error {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+
+	state := statsState{
+		AllConnections: atomic.LoadUint64(&s.AllConnections),
+		Secrets:        map[string]secretState{},
+		Daily:          s.updateDaily(),
+	}
+	for key, traffic := range s.savedSecrets {
+		state.Secrets[key] = traffic
+	}
+	state.Secrets[s.conf.SecretID()] = secretState{
+		Incoming: atomic.LoadUint64(&s.Traffic.Incoming),
+		Outgoing: atomic.LoadUint64(&s.Traffic.Outgoing),
+		Upload:   atomic.LoadUint64(&s.secret.Upload),
+		Download: atomic.LoadUint64(&s.secret.Download),
+	}
+
+	content, err := json.Marshal(state)
+	if err != nil {
+		return errors.Annotate(err, "Cannot encode state")
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return errors.Annotate(err, "Cannot create state file")
+	}
+	defer os.Remove(temp.Name()) // nolint: errcheck
+
+	if _, err = temp.Write(content); err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Annotate(err, "Cannot write state file")
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return errors.Annotate(err, "Cannot replace state file")
+	}
+
+	return nil
+}
+
+func (s *Stats) updateDaily() map[string]map[string]dayUsage {
+	current := dayUsage{
+		Upload:   atomic.LoadUint64(&s.secret.Upload),
+		Download: atomic.LoadUint64(&s.secret.Download),
+	}
+	if current == s.savedUsage {
+		return s.savedDaily
+	}
+
+	if s.savedDaily == nil {
+		s.savedDaily = map[string]map[string]dayUsage{}
+	}
+	day := time.Now().UTC().Format(stateDayFormat)
+	secrets, ok := s.savedDaily[day]
+	if !ok {
+		secrets = map[string]dayUsage{}
+		s.savedDaily[day] = secrets
+	}
+	traffic := secrets[s.conf.SecretID()]
+	traffic.Upload += current.Upload - s.savedUsage.Upload
+	traffic.Download += current.Download - s.savedUsage.Download
+	secrets[s.conf.SecretID()] = traffic
+	s.savedUsage = current
+
+	return s.savedDaily
+}
+
+// checkpointState periodically saves lifetime counters to state file.
+func (s *Server) checkpointState(stopped <-chan struct{}) {
+	if s.conf.StateFile == "" {
+		return
+	}
+
+	ticker := time.NewTicker(stateCheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+		}
+		s.saveState()
+	}
+}
+
+func (s *Server) saveState() {
+	if s.conf.StateFile == "" {
+		return
+	}
+	if err := s.stats.SaveState(s.conf.StateFile); err != nil {
+		s.logger.Warnw("Cannot save state", "path", s.conf.StateFile, "error", err)
+	}
+}
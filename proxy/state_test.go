@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtg-state")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+	path := filepath.Join(dir, "state.json")
+
+	first := NewStats(&config.Config{Secret: []byte{1}})
+	assert.Nil(t, first.LoadState(path))
+	first.NewConnection()
+	first.AddIncomingTraffic(10)
+	first.AddOutgoingTraffic(20)
+	assert.Nil(t, first.SaveState(path))
+
+	other := NewStats(&config.Config{Secret: []byte{2}})
+	assert.Nil(t, other.LoadState(path))
+	assert.Equal(t, uint64(1), other.AllConnections)
+	assert.Equal(t, uint64(0), other.Traffic.Incoming)
+	other.AddIncomingTraffic(5)
+	assert.Nil(t, other.SaveState(path))
+
+	second := NewStats(&config.Config{Secret: []byte{1}})
+	assert.Nil(t, second.LoadState(path))
+	second.AddIncomingTraffic(1)
+	assert.Equal(t, uint64(1), second.AllConnections)
+	assert.Equal(t, uint64(11), second.Traffic.Incoming)
+	assert.Equal(t, uint64(20), second.Traffic.Outgoing)
+	assert.Equal(t, uint32(0), second.ActiveConnections)
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestStatsStateIncorrect(t *testing.T) {
+	file, err := ioutil.TempFile("", "mtg-state")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name()) // nolint: errcheck
+	file.WriteString("{")        // nolint: errcheck
+	file.Close()                 // nolint: errcheck
+
+	assert.NotNil(t, NewStats(&config.Config{}).LoadState(file.Name()))
+}
+
+func TestStatsStateUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtg-state")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+	path := filepath.Join(dir, "state.json")
+
+	first := NewStats(&config.Config{Secret: []byte{1}})
+	assert.Nil(t, first.LoadState(path))
+	first.secret.addUpload(10)
+	first.secret.addDownload(20)
+	assert.Nil(t, first.SaveState(path))
+	assert.Nil(t, first.SaveState(path))
+
+	second := NewStats(&config.Config{Secret: []byte{1}})
+	assert.Nil(t, second.LoadState(path))
+	second.secret.addUpload(1)
+	assert.Nil(t, second.SaveState(path))
+
+	now := time.Now()
+	usage, err := ReadUsage(path, now.AddDate(0, 0, -1), now.AddDate(0, 0, 1))
+	assert.Nil(t, err)
+	assert.Equal(t, []SecretUsage{{
+		SecretID: first.conf.SecretID(),
+		Upload:   11,
+		Download: 20,
+	}}, usage)
+
+	usage, err = ReadUsage(path, now.AddDate(0, 0, -3), now.AddDate(0, 0, -2))
+	assert.Nil(t, err)
+	assert.Empty(t, usage)
+}
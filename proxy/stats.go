@@ -2,13 +2,14 @@ package proxy
 
 import (
 	"encoding/json"
-	"fmt"
-	"net"
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/9seconds/mtg/config"
 )
 
 type statsUptime time.Time
@@ -18,7 +19,8 @@ func (s statsUptime) MarshalJSON() ([]byte, error) {
 	return []byte(strconv.Itoa(uptime)), nil
 }
 
-// Stats is a datastructure for statistics on work of this proxy.
+// Stats is a datastructure for statistics on work of this proxy. It is
+// a default StatsCollector which is served over HTTP.
 type Stats struct {
 	AllConnections    uint64 `json:"all_connections"`
 	ActiveConnections uint32 `json:"active_connections"`
@@ -26,60 +28,286 @@ type Stats struct {
 		Incoming uint64 `json:"incoming"`
 		Outgoing uint64 `json:"outgoing"`
 	} `json:"traffic"`
-	URLs struct {
-		TG        string `json:"tg_url"`
-		TMe       string `json:"tme_url"`
-		TGQRCode  string `json:"tg_qrcode"`
-		TMeQRCode string `json:"tme_qrcode"`
-	} `json:"urls"`
-	Uptime statsUptime `json:"uptime"`
+	NonMTProto struct {
+		HTTP    uint64 `json:"http"`
+		TLS     uint64 `json:"tls"`
+		SSH     uint64 `json:"ssh"`
+		Unknown uint64 `json:"unknown"`
+		Garbage uint64 `json:"garbage"`
+	} `json:"non_mtproto"`
+	HandshakeFailures struct {
+		BadSecret    uint64 `json:"bad_secret"`
+		BadTransport uint64 `json:"bad_transport"`
+		Timeout      uint64 `json:"timeout"`
+		Closed       uint64 `json:"closed"`
+	} `json:"handshake_failures"`
+	DeadPeers struct {
+		Client   uint64 `json:"client"`
+		Telegram uint64 `json:"telegram"`
+	} `json:"dead_peers"`
+	URLs           ProxyURLs    `json:"urls"`
+	Uptime         statsUptime  `json:"uptime"`
+	Runtime        statsRuntime `json:"runtime"`
+	SuppressedLogs uint64       `json:"suppressed_logs"`
+
+	BackpressureEvents   uint64 `json:"backpressure_events"`
+	SlowClientsEvicted   uint64 `json:"slow_clients_evicted"`
+	ListenOverflows      uint64 `json:"listen_overflows"`
+	FDExhaustions        uint64 `json:"fd_exhaustions"`
+	FilteredConnections  uint64 `json:"filtered_connections"`
+	TarpittedConnections uint64 `json:"tarpitted_connections"`
+	TelegramReconnects   uint64 `json:"telegram_reconnects"`
+
+	Secrets   map[string]*statsSecret `json:"secrets"`
+	DCs       *statsDCs               `json:"dcs"`
+	DCHealth  *statsDCHealth          `json:"dc_health,omitempty"`
+	Countries *statsCountries         `json:"countries,omitempty"`
+	Bandwidth *statsBandwidth         `json:"bandwidth"`
+
+	conf         *config.Config
+	secret       *statsSecret
+	health       *health
+	mux          *http.ServeMux
+	savedSecrets map[string]secretState
+	savedDaily   map[string]map[string]dayUsage
+	savedUsage   dayUsage
+	stateMutex   sync.Mutex
 }
 
-func (s *Stats) newConnection() {
+func (s *Stats) NewConnection() {
 	atomic.AddUint64(&s.AllConnections, 1)
 	atomic.AddUint32(&s.ActiveConnections, 1)
 }
 
-func (s *Stats) closeConnection() {
+func (s *Stats) CloseConnection() {
 	atomic.AddUint32(&s.ActiveConnections, ^uint32(0))
 }
 
-func (s *Stats) addIncomingTraffic(n int) {
+func (s *Stats) AddIncomingTraffic(n int) {
 	atomic.AddUint64(&s.Traffic.Incoming, uint64(n))
 }
 
-func (s *Stats) addOutgoingTraffic(n int) {
+func (s *Stats) AddOutgoingTraffic(n int) {
 	atomic.AddUint64(&s.Traffic.Outgoing, uint64(n))
 }
 
+// AddSuppressedLog counts log entry which was dropped by sampling.
+func (s *Stats) AddSuppressedLog() {
+	atomic.AddUint64(&s.SuppressedLogs, 1)
+}
+
+func (s *Stats) AddBackpressureEvent() {
+	atomic.AddUint64(&s.BackpressureEvents, 1)
+}
+
+func (s *Stats) AddSlowClientEviction() {
+	atomic.AddUint64(&s.SlowClientsEvicted, 1)
+}
+
+// AddListenOverflows counts connections dropped by kernel because
+// accept queue was full.
+func (s *Stats) AddListenOverflows(n int) {
+	atomic.AddUint64(&s.ListenOverflows, uint64(n))
+}
+
+// AddFDExhaustion counts failures to accept connection because file
+// descriptors were exhausted.
+func (s *Stats) AddFDExhaustion() {
+	atomic.AddUint64(&s.FDExhaustions, 1)
+}
+
+// AddFilteredConnection counts connection rejected by filtering rules.
+func (s *Stats) AddFilteredConnection() {
+	atomic.AddUint64(&s.FilteredConnections, 1)
+}
+
+// AddTarpittedConnection counts filtered connection which was held in
+// tarpit instead of closing.
+func (s *Stats) AddTarpittedConnection() {
+	atomic.AddUint64(&s.TarpittedConnections, 1)
+}
+
+// AddTelegramReconnect counts Telegram connections which were restored
+// during the session.
+func (s *Stats) AddTelegramReconnect() {
+	atomic.AddUint64(&s.TelegramReconnects, 1)
+}
+
+func (s *Stats) AddNonMTProto(kind string) {
+	var counter *uint64
+
+	switch kind {
+	case trafficHTTP:
+		counter = &s.NonMTProto.HTTP
+	case trafficTLS:
+		counter = &s.NonMTProto.TLS
+	case trafficSSH:
+		counter = &s.NonMTProto.SSH
+	case trafficGarbage:
+		counter = &s.NonMTProto.Garbage
+	default:
+		counter = &s.NonMTProto.Unknown
+	}
+
+	atomic.AddUint64(counter, 1)
+}
+
+// AddHandshakeFailure counts client which has failed handshake by
+// reason.
+func (s *Stats) AddHandshakeFailure(reason string) {
+	var counter *uint64
+
+	switch reason {
+	case handshakeBadSecret:
+		counter = &s.HandshakeFailures.BadSecret
+	case handshakeBadTransport:
+		counter = &s.HandshakeFailures.BadTransport
+	case handshakeTimeout:
+		counter = &s.HandshakeFailures.Timeout
+	default:
+		counter = &s.HandshakeFailures.Closed
+	}
+
+	atomic.AddUint64(counter, 1)
+}
+
+// AddDeadPeer counts connections closed because peer has not answered
+// keepalive probes.
+func (s *Stats) AddDeadPeer(stream string) {
+	if stream == StreamTelegram {
+		atomic.AddUint64(&s.DeadPeers.Telegram, 1)
+	} else {
+		atomic.AddUint64(&s.DeadPeers.Client, 1)
+	}
+}
+
+// AddSecretUpload counts traffic from clients of the secret.
+func (s *Stats) AddSecretUpload(n int) {
+	s.secret.addUpload(n)
+}
+
+// AddSecretDownload counts traffic to clients of the secret.
+func (s *Stats) AddSecretDownload(n int) {
+	s.secret.addDownload(n)
+}
+
+// AddDCDial counts attempt to connect to datacenter.
+func (s *Stats) AddDCDial(dc int16, latency time.Duration, err error) {
+	s.DCs.addDial(dc, latency, err)
+}
+
+// AddDCSession counts finished session of datacenter.
+func (s *Stats) AddDCSession(dc int16, upload, download uint64, duration time.Duration) {
+	s.DCs.addSession(dc, upload, download, duration)
+}
+
+// AddCountryConnection counts client connection from country. Country
+// statistics is kept only if GeoIP database is configured.
+func (s *Stats) AddCountryConnection(country string) {
+	if s.Countries != nil {
+		s.Countries.addConnection(country)
+	}
+}
+
+// AddCountryFailedHandshake counts failed handshake of client from
+// country.
+func (s *Stats) AddCountryFailedHandshake(country string) {
+	if s.Countries != nil {
+		s.Countries.addFailedHandshake(country)
+	}
+}
+
+// AddCountryTraffic counts traffic of finished session of client from
+// country.
+func (s *Stats) AddCountryTraffic(country string, incoming, outgoing uint64) {
+	if s.Countries != nil {
+		s.Countries.addTraffic(country, incoming, outgoing)
+	}
+}
+
 // Serve runs statistics HTTP server.
-func (s *Stats) Serve(host fmt.Stringer, port uint16) {
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
+func (s *Stats) Serve() error {
+	if s.conf.StatsTLSEnabled() {
+		return http.ListenAndServeTLS(s.conf.StatsAddr(), // nolint: gas
+			s.conf.StatsTLSCert, s.conf.StatsTLSKey, s.mux)
+	}
 
-		encoder := json.NewEncoder(w)
-		encoder.SetEscapeHTML(false)
-		encoder.SetIndent("", "  ")
-		encoder.Encode(s) // nolint: errcheck, gas
-	})
+	return http.ListenAndServe(s.conf.StatsAddr(), s.mux) // nolint: gas
+}
 
-	addr := net.JoinHostPort(host.String(), strconv.Itoa(int(port)))
-	http.ListenAndServe(addr, nil) // nolint: errcheck, gas
+// Handle registers additional handler on stats server. Handler is
+// protected with the same authentication as statistics.
+func (s *Stats) Handle(pattern string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, s.authenticate(handler))
 }
 
-// NewStats returns new instance of statistics datastructure.
-func NewStats(serverName string, port uint16, secret string) *Stats {
-	urlQuery := makeURLQuery(serverName, port, secret)
+func (s *Stats) statsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-	stat := &Stats{Uptime: statsUptime(time.Now())}
-	stat.URLs.TG = makeTGURL(urlQuery)
-	stat.URLs.TMe = makeTMeURL(urlQuery)
-	stat.URLs.TGQRCode = makeQRCodeURL(stat.URLs.TG)
-	stat.URLs.TMeQRCode = makeQRCodeURL(stat.URLs.TMe)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(s) // nolint: errcheck, gas
+}
+
+func (s *Stats) versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	info := s.conf.Build
+	info.Features = s.conf.Features()
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(info) // nolint: errcheck, gas
+}
+
+// NewStats returns new instance of statistics datastructure.
+func NewStats(conf *config.Config) *Stats {
+	stat := &Stats{
+		Uptime: statsUptime(time.Now()),
+		DCs:    newStatsDCs(),
+		conf:   conf,
+		secret: &statsSecret{},
+		health: &health{},
+		mux:    http.NewServeMux(),
+	}
+	stat.Secrets = map[string]*statsSecret{conf.SecretID(): stat.secret}
+	stat.Bandwidth = &statsBandwidth{}
+	if conf.DCProbeInterval > 0 {
+		stat.DCHealth = newStatsDCHealth()
+	}
+	if conf.GeoIPDB != "" {
+		stat.Countries = newStatsCountries()
+	}
+	stat.Handle("/", stat.statsHandler)
+	stat.Handle("/version", stat.versionHandler)
+	stat.mux.HandleFunc("/healthz", stat.health.livenessHandler)
+	stat.mux.HandleFunc("/readyz", stat.health.readinessHandler)
+	stat.URLs = makeProxyURLs(conf.ServerName, conf.PublicPort, conf.HexSecret())
 
 	return stat
 }
 
+// ProxyURLs are links which can be shared with clients.
+type ProxyURLs struct {
+	TG        string `json:"tg_url"`
+	TMe       string `json:"tme_url"`
+	TGQRCode  string `json:"tg_qrcode"`
+	TMeQRCode string `json:"tme_qrcode"`
+}
+
+func makeProxyURLs(serverName string, port uint16, secret string) ProxyURLs {
+	urlQuery := makeURLQuery(serverName, port, secret)
+	urls := ProxyURLs{
+		TG:  makeTGURL(urlQuery),
+		TMe: makeTMeURL(urlQuery),
+	}
+	urls.TGQRCode = makeQRCodeURL(urls.TG)
+	urls.TMeQRCode = makeQRCodeURL(urls.TMe)
+
+	return urls
+}
+
 func makeURLQuery(serverName string, port uint16, secret string) url.Values {
 	values := url.Values{}
 	values.Set("server", serverName)
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+const statsAuthRealm = `Basic realm="mtg"`
+
+// authenticate wraps handler with a check of bearer token or basic auth
+// credentials. If no authentication is configured, handler is returned
+// as is.
+func (s *Stats) authenticate(handler http.HandlerFunc) http.HandlerFunc {
+	if !s.conf.StatsAuthEnabled() {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.isAuthorized(r) {
+			if s.conf.StatsUser != "" {
+				w.Header().Set("WWW-Authenticate", statsAuthRealm)
+			}
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// refuseUnauthenticated responds with 403 if stats server has no
+// authentication. Handlers which change state of the proxy must not be
+// open to everyone who can reach stats port.
+func (s *Stats) refuseUnauthenticated(w http.ResponseWriter) bool {
+	if s.conf.StatsAuthEnabled() {
+		return false
+	}
+	http.Error(w, "Stats authentication has to be configured", http.StatusForbidden)
+
+	return true
+}
+
+func (s *Stats) isAuthorized(r *http.Request) bool {
+	if s.conf.StatsToken != "" {
+		header := r.Header.Get("Authorization")
+		if strings.HasPrefix(header, "Bearer ") &&
+			secureCompare(strings.TrimPrefix(header, "Bearer "), s.conf.StatsToken) {
+			return true
+		}
+	}
+
+	if s.conf.StatsUser != "" {
+		user, password, ok := r.BasicAuth()
+		if ok && secureCompare(user, s.conf.StatsUser) &&
+			secureCompare(password, s.conf.StatsPassword) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func secureCompare(given, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsAuthDisabled(t *testing.T) {
+	stat := &Stats{conf: &config.Config{}}
+	handler := stat.authenticate(okHandler)
+
+	assert.Equal(t, http.StatusOK, serveStatsRequest(handler, nil))
+}
+
+func TestStatsAuthToken(t *testing.T) {
+	stat := &Stats{conf: &config.Config{StatsToken: "token"}}
+	handler := stat.authenticate(okHandler)
+
+	assert.Equal(t, http.StatusUnauthorized, serveStatsRequest(handler, nil))
+	assert.Equal(t, http.StatusUnauthorized, serveStatsRequest(handler, func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer nope")
+	}))
+	assert.Equal(t, http.StatusOK, serveStatsRequest(handler, func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer token")
+	}))
+}
+
+func TestStatsAuthBasic(t *testing.T) {
+	stat := &Stats{conf: &config.Config{StatsUser: "user", StatsPassword: "password"}}
+	handler := stat.authenticate(okHandler)
+
+	assert.Equal(t, http.StatusUnauthorized, serveStatsRequest(handler, nil))
+	assert.Equal(t, http.StatusUnauthorized, serveStatsRequest(handler, func(r *http.Request) {
+		r.SetBasicAuth("user", "nope")
+	}))
+	assert.Equal(t, http.StatusOK, serveStatsRequest(handler, func(r *http.Request) {
+		r.SetBasicAuth("user", "password")
+	}))
+}
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func serveStatsRequest(handler http.HandlerFunc, prepare func(*http.Request)) int {
+	req := httptest.NewRequest("GET", "/", nil)
+	if prepare != nil {
+		prepare(req)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	return rec.Code
+}
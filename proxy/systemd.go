@@ -0,0 +1,30 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/9seconds/mtg/systemd"
+)
+
+// notifySystemd sends state to systemd if proxy is run as notify
+// service. It returns true if state was delivered.
+func (s *Server) notifySystemd(state string) bool {
+	sent, err := systemd.Notify(state)
+	if err != nil {
+		s.logger.Debugw("Cannot notify systemd", "error", err)
+	}
+
+	return sent
+}
+
+// systemdStatus returns status line shown by systemctl status.
+func (s *Server) systemdStatus(reachable bool) string {
+	switch {
+	case s.stats.health.isDraining():
+		return fmt.Sprintf("STATUS=Draining, %d active connections", s.sessions.count())
+	case !reachable:
+		return fmt.Sprintf("STATUS=Telegram is unreachable, %d active connections", s.sessions.count())
+	}
+
+	return fmt.Sprintf("STATUS=Serving %d active connections", s.sessions.count())
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestSystemdStatus(t *testing.T) {
+	conf := &config.Config{}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+
+	assert.Equal(t, "STATUS=Serving 0 active connections", srv.systemdStatus(true))
+	assert.Equal(t, "STATUS=Telegram is unreachable, 0 active connections", srv.systemdStatus(false))
+
+	srv.stats.health.setDraining(true)
+	assert.Equal(t, "STATUS=Draining, 0 active connections", srv.systemdStatus(true))
+}
+
+func TestDrainNotifiesSystemd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtg-systemd")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	socketPath := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Skip("Unix datagram sockets are not supported")
+	}
+	defer conn.Close() // nolint: errcheck
+
+	defer os.Setenv("NOTIFY_SOCKET", os.Getenv("NOTIFY_SOCKET")) // nolint: errcheck
+	os.Setenv("NOTIFY_SOCKET", socketPath)                       // nolint: errcheck
+
+	conf := &config.Config{}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+	srv.Drain(time.Second)
+
+	buf := make([]byte, 128)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second)) // nolint: errcheck
+	n, err := conn.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "STOPPING=1\nSTATUS=Draining, 0 active connections", string(buf[:n]))
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"net"
+	"time"
+)
+
+const (
+	tarpitReadInterval = time.Second
+	tarpitReadBuffer   = 1
+)
+
+// tarpit holds connection of filtered client open, reading a byte per
+// second, so scanners waste their time. Amount of tarpitted connections
+// is limited, extra ones are closed at once. It returns false if
+// connection was not tarpitted.
+func (s *Server) tarpit(conn net.Conn) bool {
+	select {
+	case s.tarpitSlots <- struct{}{}:
+		defer func() { <-s.tarpitSlots }()
+	default:
+		return false
+	}
+
+	s.collector.AddTarpittedConnection()
+	setSocketBuffers(conn, tarpitReadBuffer, 0) // nolint: errcheck
+
+	deadline := time.Now().Add(s.conf.TarpitDuration)
+	buf := make([]byte, 1)
+	for time.Now().Before(deadline) {
+		conn.SetReadDeadline(deadline) // nolint: errcheck, gas
+		if _, err := conn.Read(buf); err != nil {
+			break
+		}
+
+		wait := tarpitReadInterval
+		if left := time.Until(deadline); left < wait {
+			wait = left
+		}
+		select {
+		case <-time.After(wait):
+		case <-s.draining:
+			return true
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTarpit(t *testing.T) {
+	conf := &config.Config{TarpitMax: 1, TarpitDuration: 200 * time.Millisecond}
+	stat := NewStats(conf)
+	srv := NewServer(conf, zap.NewNop().Sugar(), stat)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go client.Write(make([]byte, 10)) // nolint: errcheck
+
+	result := make(chan bool)
+	startedAt := time.Now()
+	go func() {
+		result <- srv.tarpit(server)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	extra, _ := net.Pipe()
+	assert.False(t, srv.tarpit(extra))
+
+	assert.True(t, <-result)
+	assert.True(t, time.Since(startedAt) >= conf.TarpitDuration)
+	assert.Equal(t, uint64(1), stat.TarpittedConnections)
+}
@@ -1,27 +1,39 @@
 package proxy
 
 import (
+	"context"
 	"net"
-	"time"
+	"strconv"
+	"syscall"
 
 	"github.com/juju/errors"
 )
 
 // TelegramAddress presents a pair of v4 and v6 addresses. This pairization
 // is required because we want to use DC indexes.
+// Ports are empty unless address is overridden with SetTelegramAddress.
 type TelegramAddress struct {
-	v4 string
-	v6 string
+	v4     string
+	v6     string
+	v4Port string
+	v6Port string
 }
 
 // IPv4 returns v4 address.
 func (t *TelegramAddress) IPv4() string {
-	return net.JoinHostPort(t.v4, telegramPort)
+	return net.JoinHostPort(t.v4, portOrDefault(t.v4Port))
 }
 
 // IPv6 returns v4 address.
 func (t *TelegramAddress) IPv6() string {
-	return net.JoinHostPort(t.v6, telegramPort)
+	return net.JoinHostPort(t.v6, portOrDefault(t.v6Port))
+}
+
+func portOrDefault(port string) string {
+	if port == "" {
+		return telegramPort
+	}
+	return port
 }
 
 // TelegramAddresses is a list of all known Telegram addresses for DC indexes.
@@ -33,43 +45,245 @@ var TelegramAddresses = []TelegramAddress{
 	TelegramAddress{v4: "149.154.171.5", v6: "2001:b28:f23f:f005::a"},
 }
 
-const telegramPort = "443"
+// TelegramMediaAddresses is a list of addresses of media datacenters
+// for DC indexes. Clients ask for them with negative DC numbers to
+// download files. DCs without dedicated media addresses serve media
+// from the main address.
+var TelegramMediaAddresses = map[int16]TelegramAddress{
+	1: TelegramAddress{v4: "149.154.167.151", v6: "2001:67c:04e8:f002::b"},
+	3: TelegramAddress{v4: "149.154.164.250", v6: "2001:67c:04e8:f004::b"},
+}
 
-const telegramKeepAlive = 30 * time.Second
+// TelegramTestAddresses is a list of Telegram test environment
+// datacenters. Clients working with test environment add
+// telegramTestDCOffset to DC numbers.
+var TelegramTestAddresses = []TelegramAddress{
+	TelegramAddress{v4: "149.154.175.10", v6: "2001:b28:f23d:f001::e"},
+	TelegramAddress{v4: "149.154.167.40", v6: "2001:67c:04e8:f002::e"},
+	TelegramAddress{v4: "149.154.175.117", v6: "2001:b28:f23d:f003::e"},
+}
+
+const telegramTestDCOffset = 10000
 
-func dialToTelegram(ipv6 bool, dcIdx int16, timeout time.Duration) (net.Conn, error) {
-	if dcIdx < 0 || dcIdx >= 5 {
-		return nil, errors.New("Incorrect DC IDX")
+// SetTelegramAddress overrides address of datacenter with given number
+// (1-based, as clients send it). Address is IP:port, IPv4 or IPv6
+// address of datacenter is replaced depending on IP version. It is useful
+// if default address of some datacenter is blocked. It has to be called
+// before Serve.
+func SetTelegramAddress(dc int16, address string, test bool) error {
+	addresses := telegramAddresses(test)
+	if dc < 1 || int(dc) > len(addresses) {
+		return errors.Errorf("DC %d is out of range", dc)
 	}
 
-	conn, err := doDial(ipv6, dcIdx, timeout)
+	host, port, err := net.SplitHostPort(address)
 	if err != nil {
-		return nil, errors.Annotate(err, "Cannot dial")
+		return errors.Annotate(err, "Incorrect address")
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errors.Errorf("%s is not an IP address", host)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return errors.Errorf("Incorrect port %s", port)
 	}
 
-	if err := conn.SetKeepAlive(true); err != nil {
-		return nil, errors.Annotate(err, "Cannot establish keepalive connection")
+	addr := &addresses[dc-1]
+	if ip.To4() != nil {
+		addr.v4, addr.v4Port = ip.String(), port
+	} else {
+		addr.v6, addr.v6Port = ip.String(), port
 	}
-	if err := conn.SetKeepAlivePeriod(telegramKeepAlive); err != nil {
-		return nil, errors.Annotate(err, "Cannot set keepalive timeout")
+
+	return nil
+}
+
+// TelegramDC returns datacenter number (as clients send it) of Telegram
+// datacenter which has given IP address.
+func TelegramDC(ip net.IP) (int16, bool) {
+	for idx, addr := range TelegramAddresses {
+		if addr.hasIP(ip) {
+			return int16(idx + 1), true
+		}
+	}
+	for idx, addr := range TelegramMediaAddresses {
+		if addr.hasIP(ip) {
+			return -(idx + 1), true
+		}
 	}
 
-	return conn, nil
+	return 0, false
+}
+
+// telegramNetworks are networks Telegram announces for its
+// datacenters. Clients learn addresses from them at runtime, so not all
+// of them are in TelegramAddresses.
+var telegramNetworks = parseNetworks(
+	"91.105.192.0/23",
+	"91.108.4.0/22",
+	"91.108.8.0/22",
+	"91.108.12.0/22",
+	"91.108.16.0/22",
+	"91.108.20.0/22",
+	"91.108.56.0/22",
+	"95.161.64.0/20",
+	"149.154.160.0/20",
+	"185.76.151.0/24",
+	"2001:67c:4e8::/48",
+	"2001:b28:f23c::/47",
+	"2001:b28:f23f::/48",
+	"2a0a:f280::/32",
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+// IsTelegramIP tells if IP belongs to one of Telegram networks.
+func IsTelegramIP(ip net.IP) bool {
+	for _, network := range telegramNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *TelegramAddress) hasIP(ip net.IP) bool {
+	return ip.Equal(net.ParseIP(t.v4)) || ip.Equal(net.ParseIP(t.v6))
+}
+
+const telegramPort = "443"
+
+// telegramAddress resolves datacenter number client has sent in its
+// handshake. Negative numbers are media datacenters. Numbers outside of
+// known range (e.g. CDN datacenters) are routed to defaultDC, the same
+// way official proxy does with its default cluster. If test is set, test
+// environment datacenters are used.
+func telegramAddress(dc, defaultDC int16, test bool) (*TelegramAddress, error) {
+	idx, err := telegramDCIndex(dc, defaultDC, test)
+	if err != nil {
+		return nil, err
+	}
+
+	if dc < 0 && !test {
+		if addr, ok := TelegramMediaAddresses[idx]; ok {
+			return &addr, nil
+		}
+	}
+
+	return &telegramAddresses(test)[idx], nil
+}
+
+// telegramDCIndex returns 0-based index of datacenter for DC number sent
+// by client. Unknown DCs are replaced with default one.
+func telegramDCIndex(dc, defaultDC int16, test bool) (int16, error) {
+	addresses := telegramAddresses(test)
+
+	idx := dc
+	if idx < 0 {
+		idx = -idx
+	}
+	if test && idx > telegramTestDCOffset {
+		idx -= telegramTestDCOffset
+	}
+	idx--
+
+	if idx < 0 || int(idx) >= len(addresses) {
+		idx = defaultDC - 1
+		if idx < 0 || int(idx) >= len(addresses) {
+			return 0, errors.New("Incorrect DC IDX")
+		}
+	}
+
+	return idx, nil
 }
 
-func doDial(ipv6 bool, dcIdx int16, timeout time.Duration) (*net.TCPConn, error) {
-	dialer := net.Dialer{Timeout: timeout}
-	addr := TelegramAddresses[dcIdx]
+func telegramAddresses(test bool) []TelegramAddress {
+	if test {
+		return TelegramTestAddresses
+	}
+	return TelegramAddresses
+}
+
+// dialFunc establishes connection with given network (tcp4 or tcp6)
+// and address.
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// ipPolicy defines which IP versions are used to connect to Telegram.
+type ipPolicy int
 
-	if ipv6 {
-		if conn, err := dialer.Dial("tcp", addr.IPv6()); err == nil {
+const (
+	ipPreferV4 ipPolicy = iota
+	ipPreferV6
+	ipOnlyV6
+)
+
+func dialToTelegram(ctx context.Context, dial dialFunc, policy ipPolicy, addr *TelegramAddress) (net.Conn, error) {
+	conn, err := doDial(ctx, dial, policy, addr)
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot dial")
+	}
+
+	return conn, nil
+}
+
+func doDial(ctx context.Context, dial dialFunc, policy ipPolicy, addr *TelegramAddress) (*net.TCPConn, error) {
+	if policy == ipOnlyV6 {
+		return dialIPv6Only(ctx, dial, addr)
+	}
+	if policy == ipPreferV6 {
+		if conn, err := dial(ctx, "tcp6", addr.IPv6()); err == nil {
 			return conn.(*net.TCPConn), nil
 		}
 	}
 
-	conn, err := dialer.Dial("tcp", addr.IPv4())
+	conn, err := dial(ctx, "tcp4", addr.IPv4())
 	if err == nil {
 		return conn.(*net.TCPConn), nil
 	}
 	return nil, err
 }
+
+// dialIPv6Only connects to Telegram with IPv6 only. Errors explain why
+// IPv6 connection is not possible.
+func dialIPv6Only(ctx context.Context, dial dialFunc, addr *TelegramAddress) (*net.TCPConn, error) {
+	if addr.v6 == "" {
+		return nil, errors.Errorf("Datacenter %s has no IPv6 address", addr.v4)
+	}
+
+	conn, err := dial(ctx, "tcp6", addr.IPv6())
+	if err == nil {
+		return conn.(*net.TCPConn), nil
+	}
+
+	switch unwrapSyscallError(err) {
+	case syscall.ENETUNREACH:
+		return nil, errors.Annotate(err, "No IPv6 route to Telegram, check default IPv6 route of the host")
+	case syscall.EADDRNOTAVAIL:
+		return nil, errors.Annotate(err, "No IPv6 address to connect from, check IPv6 configuration of the host")
+	}
+	return nil, errors.Annotate(err, "Cannot connect to Telegram with IPv6")
+}
+
+// checkIPv6Route verifies that host has a route to Telegram over IPv6.
+// UDP socket is connected so no packets are sent.
+func checkIPv6Route(addr *TelegramAddress) error {
+	conn, err := net.Dial("udp6", addr.IPv6())
+	if err != nil {
+		return errors.Annotate(err, "No IPv6 route to Telegram")
+	}
+	conn.Close() // nolint: errcheck
+
+	return nil
+}
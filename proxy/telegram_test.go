@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelegramAddressMain(t *testing.T) {
+	addr, err := telegramAddress(3, 2, false)
+	assert.Nil(t, err)
+	assert.Equal(t, TelegramAddresses[2], *addr)
+}
+
+func TestTelegramAddressMedia(t *testing.T) {
+	addr, err := telegramAddress(-2, 2, false)
+	assert.Nil(t, err)
+	assert.Equal(t, TelegramMediaAddresses[1], *addr)
+
+	addr, err = telegramAddress(-1, 2, false)
+	assert.Nil(t, err)
+	assert.Equal(t, TelegramAddresses[0], *addr)
+}
+
+func TestTelegramAddressUnknown(t *testing.T) {
+	addr, err := telegramAddress(203, 2, false)
+	assert.Nil(t, err)
+	assert.Equal(t, TelegramAddresses[1], *addr)
+
+	addr, err = telegramAddress(-203, 4, false)
+	assert.Nil(t, err)
+	assert.Equal(t, TelegramMediaAddresses[3], *addr)
+
+	_, err = telegramAddress(203, 0, false)
+	assert.NotNil(t, err)
+}
+
+func TestTelegramAddressTest(t *testing.T) {
+	addr, err := telegramAddress(10003, 2, true)
+	assert.Nil(t, err)
+	assert.Equal(t, TelegramTestAddresses[2], *addr)
+
+	addr, err = telegramAddress(-10001, 2, true)
+	assert.Nil(t, err)
+	assert.Equal(t, TelegramTestAddresses[0], *addr)
+
+	addr, err = telegramAddress(5, 2, true)
+	assert.Nil(t, err)
+	assert.Equal(t, TelegramTestAddresses[1], *addr)
+}
+
+func TestTelegramDC(t *testing.T) {
+	dc, ok := TelegramDC(net.ParseIP("149.154.175.100"))
+	assert.True(t, ok)
+	assert.Equal(t, int16(3), dc)
+
+	dc, ok = TelegramDC(net.ParseIP("2001:67c:4e8:f004::b"))
+	assert.True(t, ok)
+	assert.Equal(t, int16(-4), dc)
+
+	_, ok = TelegramDC(net.ParseIP("127.0.0.1"))
+	assert.False(t, ok)
+}
+
+func TestIsTelegramIP(t *testing.T) {
+	assert.True(t, IsTelegramIP(net.ParseIP("149.154.167.222")))
+	assert.True(t, IsTelegramIP(net.ParseIP("91.108.56.130")))
+	assert.True(t, IsTelegramIP(net.ParseIP("2001:b28:f23d:f001::e")))
+	assert.False(t, IsTelegramIP(net.ParseIP("149.154.176.1")))
+	assert.False(t, IsTelegramIP(net.ParseIP("2001:db8::1")))
+}
+
+func TestDialIPv6Only(t *testing.T) {
+	var networks []string
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		networks = append(networks, network)
+		return nil, &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ENETUNREACH)}
+	}
+
+	_, err := doDial(context.Background(), dial, ipOnlyV6, &TelegramAddresses[0])
+	assert.Contains(t, err.Error(), "No IPv6 route")
+	assert.Equal(t, []string{"tcp6"}, networks)
+
+	_, err = doDial(context.Background(), dial, ipOnlyV6, &TelegramAddress{v4: "127.0.0.1"})
+	assert.Contains(t, err.Error(), "has no IPv6 address")
+	assert.Equal(t, []string{"tcp6"}, networks)
+
+	networks = nil
+	doDial(context.Background(), dial, ipPreferV6, &TelegramAddresses[0])
+	assert.Equal(t, []string{"tcp6", "tcp4"}, networks)
+}
+
+func TestSetTelegramAddress(t *testing.T) {
+	saved := append([]TelegramAddress{}, TelegramAddresses...)
+	defer func() {
+		TelegramAddresses = saved
+	}()
+	TelegramAddresses = append([]TelegramAddress{}, saved...)
+
+	assert.Nil(t, SetTelegramAddress(2, "149.154.167.50:8443", false))
+	assert.Equal(t, "149.154.167.50:8443", TelegramAddresses[1].IPv4())
+	assert.Equal(t, saved[1].IPv6(), TelegramAddresses[1].IPv6())
+
+	assert.Nil(t, SetTelegramAddress(2, "[2001:67c:4e8:f002::b]:443", false))
+	assert.Equal(t, "[2001:67c:4e8:f002::b]:443", TelegramAddresses[1].IPv6())
+
+	dc, ok := TelegramDC(net.ParseIP("149.154.167.50"))
+	assert.True(t, ok)
+	assert.Equal(t, int16(2), dc)
+
+	assert.NotNil(t, SetTelegramAddress(6, "149.154.167.50:443", false))
+	assert.NotNil(t, SetTelegramAddress(2, "149.154.167.50", false))
+	assert.NotNil(t, SetTelegramAddress(2, "telegram.org:443", false))
+	assert.NotNil(t, SetTelegramAddress(2, "149.154.167.50:https", false))
+}
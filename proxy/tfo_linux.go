@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/juju/errors"
+)
+
+const (
+	tcpFastOpen        = 23
+	tcpFastOpenConnect = 30
+
+	fastOpenQueueLength = 256
+)
+
+// setListenerFastOpen enables TCP Fast Open on listening socket.
+func setListenerFastOpen(lsock net.Listener) error {
+	return controlListener(lsock, func(fd uintptr) error {
+		return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpFastOpen, fastOpenQueueLength)
+	})
+}
+
+// fastOpenConnect returns control which enables TCP Fast Open for
+// outgoing connection.
+func fastOpenConnect() (socketControl, error) {
+	return func(fd uintptr) error {
+		err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpFastOpenConnect, 1)
+		return errors.Annotate(err, "Cannot enable TCP Fast Open")
+	}, nil
+}
@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getTCPOption(t *testing.T, conn syscall.Conn, option int) int {
+	raw, err := conn.SyscallConn()
+	assert.Nil(t, err)
+
+	var value int
+	raw.Control(func(fd uintptr) {
+		value, err = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, option)
+	})
+	assert.Nil(t, err)
+
+	return value
+}
+
+func TestFastOpen(t *testing.T) {
+	lsock, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lsock.Close()
+
+	assert.Nil(t, setListenerFastOpen(lsock))
+	assert.Equal(t, fastOpenQueueLength, getTCPOption(t, lsock.(*net.TCPListener), tcpFastOpen))
+
+	control, err := fastOpenConnect()
+	assert.Nil(t, err)
+	dialer := &tcpDialer{}
+	assert.Nil(t, dialer.addControl(control))
+
+	conn, err := dialer.dialer.Dial("tcp", lsock.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Equal(t, 1, getTCPOption(t, conn.(*net.TCPConn), tcpFastOpenConnect))
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package proxy
+
+import (
+	"net"
+
+	"github.com/juju/errors"
+)
+
+var errFastOpenUnsupported = errors.New("TCP Fast Open is supported only on Linux")
+
+func setListenerFastOpen(lsock net.Listener) error {
+	return errFastOpenUnsupported
+}
+
+func fastOpenConnect() (socketControl, error) {
+	return nil, errFastOpenUnsupported
+}
@@ -1,29 +1,65 @@
 package proxy
 
 import (
-	"io"
 	"net"
+	"sync/atomic"
 	"time"
 )
 
+// Policies of connection timeouts. With absolute policy each read and
+// write has to finish within its timeout. With idle policy connection
+// times out only if there is no traffic in both directions, so a long
+// download does not kill a connection which has nothing to upload.
+const (
+	TimeoutPolicyAbsolute = "absolute"
+	TimeoutPolicyIdle     = "idle"
+)
+
 // TimeoutReadWriteCloser sets timeouts for read/write into underlying
 // network connection.
 type TimeoutReadWriteCloser struct {
 	conn         net.Conn
 	readTimeout  time.Duration
 	writeTimeout time.Duration
+	linger       int64
+	idle         bool
 }
 
 // Read reads from connection
 func (t *TimeoutReadWriteCloser) Read(p []byte) (int, error) {
-	t.conn.SetReadDeadline(time.Now().Add(t.readTimeout)) // nolint: errcheck, gas
-	return t.conn.Read(p)
+	t.renewReadDeadline()
+	n, err := t.conn.Read(p)
+	if n > 0 && t.idle {
+		t.renewWriteDeadline()
+	}
+
+	return n, err
 }
 
 // Write writes into connection.
 func (t *TimeoutReadWriteCloser) Write(p []byte) (int, error) {
-	t.conn.SetWriteDeadline(time.Now().Add(t.writeTimeout)) // nolint: errcheck, gas
-	return t.conn.Write(p)
+	t.renewWriteDeadline()
+	n, err := t.conn.Write(p)
+	if n > 0 && t.idle {
+		t.renewReadDeadline()
+	}
+
+	return n, err
+}
+
+func (t *TimeoutReadWriteCloser) renewReadDeadline() {
+	t.conn.SetReadDeadline(t.deadline(t.readTimeout)) // nolint: errcheck, gas
+	t.applyLinger(t.conn.SetReadDeadline)
+}
+
+func (t *TimeoutReadWriteCloser) renewWriteDeadline() {
+	t.conn.SetWriteDeadline(t.deadline(t.writeTimeout)) // nolint: errcheck, gas
+	t.applyLinger(t.conn.SetWriteDeadline)
+}
+
+// CloseWrite closes writing side of underlying connection.
+func (t *TimeoutReadWriteCloser) CloseWrite() error {
+	return closeWrite(t.conn)
 }
 
 // Close closes underlying connection.
@@ -31,7 +67,42 @@ func (t *TimeoutReadWriteCloser) Close() error {
 	return t.conn.Close()
 }
 
-func newTimeoutReadWriteCloser(conn net.Conn, readTimeout, writeTimeout time.Duration) io.ReadWriteCloser {
+// setLinger sets a hard deadline for all subsequent and pending
+// operations. It is used to unblock connection on relay teardown. Only
+// the earliest linger deadline is respected.
+func (t *TimeoutReadWriteCloser) setLinger(deadline time.Time) {
+	value := deadline.UnixNano()
+
+	for {
+		current := atomic.LoadInt64(&t.linger)
+		if current != 0 && current <= value {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&t.linger, current, value) {
+			break
+		}
+	}
+	t.conn.SetDeadline(deadline) // nolint: errcheck, gas
+}
+
+func (t *TimeoutReadWriteCloser) deadline(timeout time.Duration) time.Time {
+	deadline := time.Now().Add(timeout)
+	if linger := atomic.LoadInt64(&t.linger); linger != 0 && linger < deadline.UnixNano() {
+		return time.Unix(0, linger)
+	}
+
+	return deadline
+}
+
+// applyLinger reapplies linger deadline if it was set concurrently with
+// operation deadline.
+func (t *TimeoutReadWriteCloser) applyLinger(setDeadline func(time.Time) error) {
+	if linger := atomic.LoadInt64(&t.linger); linger != 0 {
+		setDeadline(time.Unix(0, linger)) // nolint: errcheck, gas
+	}
+}
+
+func newTimeoutReadWriteCloser(conn net.Conn, readTimeout, writeTimeout time.Duration) *TimeoutReadWriteCloser {
 	return &TimeoutReadWriteCloser{
 		conn:         conn,
 		readTimeout:  readTimeout,
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readWhileWriting reads from connection which has no incoming data
+// while writing into it for 3 read timeouts.
+func readWhileWriting(idle bool) error {
+	client, server := net.Pipe()
+	defer client.Close()
+	go io.Copy(ioutil.Discard, server) // nolint: errcheck
+
+	timeout := 100 * time.Millisecond
+	wConn := newTimeoutReadWriteCloser(client, timeout, timeout)
+	wConn.idle = idle
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := wConn.Read(make([]byte, 1))
+		result <- err
+	}()
+
+	for i := 0; i < 6; i++ {
+		time.Sleep(timeout / 2)
+		if _, err := wConn.Write([]byte{1}); err != nil {
+			return err
+		}
+	}
+	server.Close()
+
+	return <-result
+}
+
+func TestTimeoutPolicyAbsolute(t *testing.T) {
+	err := readWhileWriting(false)
+	assert.NotNil(t, err)
+	netErr, ok := err.(net.Error)
+	assert.True(t, ok && netErr.Timeout())
+}
+
+func TestTimeoutPolicyIdle(t *testing.T) {
+	err := readWhileWriting(true)
+	assert.Equal(t, io.EOF, err)
+}
@@ -24,6 +24,11 @@ func (t *TrafficReadWriteCloser) Write(p []byte) (n int, err error) {
 	return
 }
 
+// CloseWrite closes writing side of underlying connection.
+func (t *TrafficReadWriteCloser) CloseWrite() error {
+	return closeWrite(t.conn)
+}
+
 // Close closes underlying connection.
 func (t *TrafficReadWriteCloser) Close() error {
 	return t.conn.Close()
@@ -0,0 +1,494 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/juju/errors"
+)
+
+const (
+	sysIOURingSetup = 425
+	sysIOURingEnter = 426
+
+	uringOffSQRing = 0
+	uringOffCQRing = 0x8000000
+	uringOffSQEs   = 0x10000000
+
+	uringEnterGetEvents = 1
+
+	uringOpAsyncCancel = 14
+	uringOpSend        = 26
+	uringOpRecv        = 27
+
+	uringEntries = 4096
+	uringMaxSize = 1 << 20
+
+	msgNoSignal = 0x4000
+)
+
+var errURingClosed = errors.New("Connection is closed")
+
+type uringSQOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	flags       uint32
+	dropped     uint32
+	array       uint32
+	resv1       uint32
+	userAddr    uint64
+}
+
+type uringCQOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	overflow    uint32
+	cqes        uint32
+	flags       uint32
+	resv1       uint32
+	userAddr    uint64
+}
+
+type uringParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFD         uint32
+	resv         [3]uint32
+	sqOff        uringSQOffsets
+	cqOff        uringCQOffsets
+}
+
+type uringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	opFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFDIn  int32
+	addr3       uint64
+	pad         uint64
+}
+
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// uring is an io_uring instance shared by all connections. Submissions
+// of concurrent operations are batched into a single io_uring_enter
+// call by submitter goroutine; completions are delivered by reaper
+// goroutine.
+type uring struct {
+	fd int
+
+	sqHead    *uint32
+	sqTail    *uint32
+	sqMask    uint32
+	sqEntries uint32
+	sqArray   []uint32
+	sqes      []uringSQE
+
+	cqHead *uint32
+	cqTail *uint32
+	cqMask uint32
+	cqes   []uringCQE
+
+	mutex       sync.Mutex
+	lastID      uint64
+	unsubmitted uint32
+	wakeup      chan struct{}
+
+	waitersMutex sync.Mutex
+	waiters      map[uint64]chan int32
+}
+
+// submit queues new operation. If result is required, returned channel
+// gets its result.
+func (r *uring) submit(prepare func(*uringSQE), needResult bool) (uint64, chan int32) {
+	r.mutex.Lock()
+	for *r.sqTail-atomic.LoadUint32(r.sqHead) >= r.sqEntries {
+		r.mutex.Unlock()
+		r.wake()
+		runtime.Gosched()
+		r.mutex.Lock()
+	}
+	defer r.mutex.Unlock()
+
+	r.lastID++
+	id := r.lastID
+
+	var result chan int32
+	if needResult {
+		result = make(chan int32, 1)
+		r.waitersMutex.Lock()
+		r.waiters[id] = result
+		r.waitersMutex.Unlock()
+	}
+
+	tail := *r.sqTail
+	idx := tail & r.sqMask
+	sqe := &r.sqes[idx]
+	*sqe = uringSQE{}
+	prepare(sqe)
+	sqe.userData = id
+	r.sqArray[idx] = idx
+	atomic.StoreUint32(r.sqTail, tail+1)
+	r.unsubmitted++
+	r.wake()
+
+	return id, result
+}
+
+func (r *uring) cancel(id uint64) {
+	r.submit(func(sqe *uringSQE) {
+		sqe.opcode = uringOpAsyncCancel
+		sqe.fd = -1
+		sqe.addr = id
+	}, false)
+}
+
+func (r *uring) wake() {
+	select {
+	case r.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (r *uring) enter(toSubmit, minComplete, flags uint32) (uint32, error) {
+	n, _, errno := syscall.Syscall6(sysIOURingEnter, uintptr(r.fd),
+		uintptr(toSubmit), uintptr(minComplete), uintptr(flags), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+
+	return uint32(n), nil
+}
+
+func (r *uring) submitter() {
+	for range r.wakeup {
+		r.mutex.Lock()
+		pending := r.unsubmitted
+		r.mutex.Unlock()
+
+		for pending > 0 {
+			submitted, err := r.enter(pending, 0, 0)
+			if err == syscall.EINTR {
+				continue
+			} else if err != nil {
+				break
+			}
+
+			r.mutex.Lock()
+			r.unsubmitted -= submitted
+			pending = r.unsubmitted
+			r.mutex.Unlock()
+		}
+	}
+}
+
+func (r *uring) reaper() {
+	for {
+		if _, err := r.enter(0, 1, uringEnterGetEvents); err != nil && err != syscall.EINTR {
+			time.Sleep(time.Millisecond)
+		}
+
+		head := atomic.LoadUint32(r.cqHead)
+		tail := atomic.LoadUint32(r.cqTail)
+		for ; head != tail; head++ {
+			cqe := r.cqes[head&r.cqMask]
+
+			r.waitersMutex.Lock()
+			result := r.waiters[cqe.userData]
+			delete(r.waiters, cqe.userData)
+			r.waitersMutex.Unlock()
+
+			if result != nil {
+				result <- cqe.res
+			}
+		}
+		atomic.StoreUint32(r.cqHead, head)
+		r.wake()
+	}
+}
+
+func (r *uring) wrap(conn net.Conn) net.Conn {
+	fd, ok := socketFD(conn)
+	if !ok {
+		return conn
+	}
+
+	return &uringConn{
+		Conn:    conn,
+		ring:    r,
+		fd:      fd,
+		changed: make(chan struct{}),
+		ops:     map[uint64]struct{}{},
+	}
+}
+
+func newURing() (socketWrapper, error) {
+	params := uringParams{}
+	fd, _, errno := syscall.Syscall(sysIOURingSetup, uringEntries, uintptr(unsafe.Pointer(&params)), 0)
+	if errno != 0 {
+		return nil, errors.Annotate(errno, "Cannot setup io_uring")
+	}
+
+	ring := &uring{
+		fd:      int(fd),
+		wakeup:  make(chan struct{}, 1),
+		waiters: map[uint64]chan int32{},
+	}
+	sqRing, err := uringMmap(ring.fd, uringOffSQRing, params.sqOff.array+params.sqEntries*4)
+	if err != nil {
+		return nil, err
+	}
+	cqRing, err := uringMmap(ring.fd, uringOffCQRing,
+		params.cqOff.cqes+params.cqEntries*uint32(unsafe.Sizeof(uringCQE{})))
+	if err != nil {
+		return nil, err
+	}
+	sqes, err := uringMmap(ring.fd, uringOffSQEs, params.sqEntries*uint32(unsafe.Sizeof(uringSQE{})))
+	if err != nil {
+		return nil, err
+	}
+
+	ring.sqHead = (*uint32)(unsafe.Pointer(&sqRing[params.sqOff.head]))
+	ring.sqTail = (*uint32)(unsafe.Pointer(&sqRing[params.sqOff.tail]))
+	ring.sqMask = *(*uint32)(unsafe.Pointer(&sqRing[params.sqOff.ringMask]))
+	ring.sqEntries = params.sqEntries
+	ring.sqArray = (*[uringMaxSize]uint32)(unsafe.Pointer(&sqRing[params.sqOff.array]))[:params.sqEntries:params.sqEntries]
+	ring.sqes = (*[uringMaxSize]uringSQE)(unsafe.Pointer(&sqes[0]))[:params.sqEntries:params.sqEntries]
+	ring.cqHead = (*uint32)(unsafe.Pointer(&cqRing[params.cqOff.head]))
+	ring.cqTail = (*uint32)(unsafe.Pointer(&cqRing[params.cqOff.tail]))
+	ring.cqMask = *(*uint32)(unsafe.Pointer(&cqRing[params.cqOff.ringMask]))
+	ring.cqes = (*[uringMaxSize]uringCQE)(unsafe.Pointer(&cqRing[params.cqOff.cqes]))[:params.cqEntries:params.cqEntries]
+
+	go ring.submitter()
+	go ring.reaper()
+
+	return ring, nil
+}
+
+func uringMmap(fd int, offset int64, size uint32) ([]byte, error) {
+	data, err := syscall.Mmap(fd, offset, int(size),
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE)
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot map io_uring memory")
+	}
+
+	return data, nil
+}
+
+func stopTimer(timer *time.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+type uringTimeoutError struct{}
+
+func (uringTimeoutError) Error() string   { return "i/o timeout" }
+func (uringTimeoutError) Timeout() bool   { return true }
+func (uringTimeoutError) Temporary() bool { return true }
+
+// uringConn does reads and writes of the socket with io_uring. Other
+// methods are served by original connection.
+type uringConn struct {
+	net.Conn
+
+	ring *uring
+	fd   int
+
+	mutex         sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+	changed       chan struct{}
+	ops           map[uint64]struct{}
+	closed        bool
+}
+
+func (c *uringConn) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	n, err := c.do(uringOpRecv, p, true)
+	if err == nil && n == 0 {
+		return 0, io.EOF
+	}
+
+	return n, err
+}
+
+func (c *uringConn) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n, err := c.do(uringOpSend, p[written:], false)
+		if err != nil {
+			return written, err
+		}
+		written += n
+	}
+
+	return written, nil
+}
+
+func (c *uringConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
+
+func (c *uringConn) SetLinger(sec int) error {
+	if setter, ok := c.Conn.(lingerSetter); ok {
+		return setter.SetLinger(sec)
+	}
+
+	return nil
+}
+
+func (c *uringConn) Close() error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return errURingClosed
+	}
+	c.closed = true
+	for id := range c.ops {
+		c.ring.cancel(id)
+	}
+	c.mutex.Unlock()
+
+	return c.Conn.Close()
+}
+
+func (c *uringConn) SetDeadline(t time.Time) error {
+	c.setDeadline(t, true, true)
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *uringConn) SetReadDeadline(t time.Time) error {
+	c.setDeadline(t, true, false)
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *uringConn) SetWriteDeadline(t time.Time) error {
+	c.setDeadline(t, false, true)
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *uringConn) setDeadline(t time.Time, read, write bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if read {
+		c.readDeadline = t
+	}
+	if write {
+		c.writeDeadline = t
+	}
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *uringConn) deadline(read bool) (time.Time, chan struct{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if read {
+		return c.readDeadline, c.changed
+	}
+	return c.writeDeadline, c.changed
+}
+
+func (c *uringConn) do(opcode uint8, p []byte, read bool) (int, error) {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return 0, errURingClosed
+	}
+	deadline := c.writeDeadline
+	if read {
+		deadline = c.readDeadline
+	}
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		c.mutex.Unlock()
+		return 0, uringTimeoutError{}
+	}
+
+	id, result := c.ring.submit(func(sqe *uringSQE) {
+		sqe.opcode = opcode
+		sqe.fd = int32(c.fd)
+		sqe.addr = uint64(uintptr(unsafe.Pointer(&p[0])))
+		sqe.len = uint32(len(p))
+		if !read {
+			sqe.opFlags = msgNoSignal
+		}
+	}, true)
+	c.ops[id] = struct{}{}
+	c.mutex.Unlock()
+
+	res, timedOut := c.wait(id, result, read)
+	runtime.KeepAlive(p)
+
+	c.mutex.Lock()
+	delete(c.ops, id)
+	closed := c.closed
+	c.mutex.Unlock()
+
+	switch {
+	case res >= 0:
+		return int(res), nil
+	case closed:
+		return 0, errURingClosed
+	case timedOut:
+		return 0, uringTimeoutError{}
+	}
+
+	return 0, syscall.Errno(-res)
+}
+
+// wait waits for operation result. If deadline has passed, operation is
+// cancelled.
+func (c *uringConn) wait(id uint64, result chan int32, read bool) (int32, bool) {
+	for {
+		deadline, changed := c.deadline(read)
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			expired = timer.C
+		}
+
+		select {
+		case res := <-result:
+			stopTimer(timer)
+			return res, false
+		case <-expired:
+			c.ring.cancel(id)
+			return <-result, true
+		case <-changed:
+			stopTimer(timer)
+		}
+	}
+}
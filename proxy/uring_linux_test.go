@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeURingPair(t *testing.T) (net.Conn, net.Conn) {
+	ring, err := newURing()
+	if err != nil {
+		t.Skip("io_uring is not available: " + err.Error())
+	}
+	local, remote := makeTCPPair(t)
+	conn := ring.wrap(local)
+	assert.IsType(t, &uringConn{}, conn)
+
+	return conn, remote
+}
+
+func TestURingConnReadWrite(t *testing.T) {
+	conn, remote := makeURingPair(t)
+	defer conn.Close()
+	defer remote.Close()
+
+	message := make([]byte, 1024*1024)
+	for i := range message {
+		message[i] = byte(i)
+	}
+	go func() {
+		conn.Write(message)
+		closeWrite(conn)
+	}()
+
+	data, err := ioutil.ReadAll(remote)
+	assert.Nil(t, err)
+	assert.Equal(t, message, data)
+
+	remote.Write([]byte("pong"))
+	remote.Close()
+	data, err = ioutil.ReadAll(conn)
+	assert.Nil(t, err)
+	assert.Equal(t, "pong", string(data))
+}
+
+func TestURingConnDeadline(t *testing.T) {
+	conn, remote := makeURingPair(t)
+	defer conn.Close()
+	defer remote.Close()
+
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err := conn.Read(make([]byte, 1))
+	assert.True(t, err.(net.Error).Timeout())
+
+	conn.SetReadDeadline(time.Time{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		conn.SetDeadline(time.Now())
+	}()
+	started := time.Now()
+	_, err = conn.Read(make([]byte, 1))
+	assert.True(t, err.(net.Error).Timeout())
+	assert.True(t, time.Since(started) < time.Second)
+}
+
+func TestURingConnClose(t *testing.T) {
+	conn, remote := makeURingPair(t)
+	defer remote.Close()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		conn.Close()
+	}()
+	_, err := io.ReadFull(conn, make([]byte, 1))
+	assert.Equal(t, errURingClosed, err)
+}
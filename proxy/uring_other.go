@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package proxy
+
+import "github.com/juju/errors"
+
+func newURing() (socketWrapper, error) {
+	return nil, errors.New("io_uring is supported only on Linux")
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+type deadlineListener interface {
+	SetDeadline(time.Time) error
+}
+
+// beatAcceptLoop records that accept loop is alive. If watchdog is
+// enabled, listener deadline makes Accept return in time even if there
+// are no new clients.
+func (s *Server) beatAcceptLoop(lsock net.Listener, interval time.Duration) {
+	atomic.StoreInt64(&s.acceptBeat, time.Now().UnixNano())
+	if interval > 0 {
+		lsock.(deadlineListener).SetDeadline(time.Now().Add(interval / 2)) // nolint: errcheck
+	}
+}
+
+// runWatchdog pings systemd watchdog while accept loop and stats server
+// are alive. If any of them is stuck, pings are stopped and systemd
+// restarts the proxy.
+func (s *Server) runWatchdog(interval time.Duration, stopped <-chan struct{}) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.checkAlive(interval); err != nil {
+			s.logger.Warnw("Skip watchdog ping", "error", err)
+			continue
+		}
+		s.notifySystemd("WATCHDOG=1")
+	}
+}
+
+func (s *Server) checkAlive(interval time.Duration) error {
+	beat := time.Unix(0, atomic.LoadInt64(&s.acceptBeat))
+	if !s.stats.health.isDraining() && time.Since(beat) > interval {
+		return errors.New("Accept loop is stuck")
+	}
+
+	return s.stats.ping(interval / 2)
+}
+
+// ping checks that stats server responds to liveness probe.
+func (s *Stats) ping(timeout time.Duration) error {
+	scheme := "http"
+	transport := &http.Transport{}
+	if s.conf.StatsTLSEnabled() {
+		scheme = "https"
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // nolint: gas
+	}
+	defer transport.CloseIdleConnections()
+
+	client := &http.Client{Timeout: timeout, Transport: transport}
+	resp, err := client.Get(scheme + "://" + s.conf.StatsAddr() + "/healthz")
+	if err != nil {
+		return errors.Annotate(err, "Stats server does not respond")
+	}
+	resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Stats server has responded with %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func makeWatchdogServer(t *testing.T) (*Server, func()) {
+	lsock, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	conf := &config.Config{
+		StatsIP:   net.ParseIP("127.0.0.1"),
+		StatsPort: uint16(lsock.Addr().(*net.TCPAddr).Port),
+	}
+	stat := NewStats(conf)
+	stat.health.setAlive(true)
+	go http.Serve(lsock, stat.mux) // nolint: errcheck
+
+	return NewServer(conf, zap.NewNop().Sugar(), stat), func() { lsock.Close() } // nolint: errcheck
+}
+
+func TestCheckAlive(t *testing.T) {
+	srv, stop := makeWatchdogServer(t)
+
+	atomic.StoreInt64(&srv.acceptBeat, time.Now().UnixNano())
+	assert.Nil(t, srv.checkAlive(time.Second))
+
+	atomic.StoreInt64(&srv.acceptBeat, time.Now().Add(-time.Minute).UnixNano())
+	assert.NotNil(t, srv.checkAlive(time.Second))
+
+	srv.stats.health.setDraining(true)
+	assert.Nil(t, srv.checkAlive(time.Second))
+
+	stop()
+	assert.NotNil(t, srv.checkAlive(time.Second))
+}
+
+func TestServeWatchdog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtg-watchdog")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	socketPath := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Skip("Unix datagram sockets are not supported")
+	}
+	defer conn.Close() // nolint: errcheck
+
+	defer os.Setenv("NOTIFY_SOCKET", os.Getenv("NOTIFY_SOCKET")) // nolint: errcheck
+	defer os.Setenv("WATCHDOG_USEC", os.Getenv("WATCHDOG_USEC")) // nolint: errcheck
+	os.Setenv("NOTIFY_SOCKET", socketPath)                       // nolint: errcheck
+	os.Setenv("WATCHDOG_USEC", "200000")                         // nolint: errcheck
+
+	srv, stop := makeWatchdogServer(t)
+	defer stop()
+	srv.SetDialer(&fakeDialer{})
+
+	lsock, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go srv.ServeListener(lsock) // nolint: errcheck
+	defer srv.Drain(0)
+
+	buf := make([]byte, 128)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second)) // nolint: errcheck
+	for {
+		n, err := conn.Read(buf)
+		if !assert.Nil(t, err) {
+			return
+		}
+		if strings.Contains(string(buf[:n]), "WATCHDOG=1") {
+			return
+		}
+	}
+}
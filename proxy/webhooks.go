@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// Names of events which are sent to webhooks.
+const (
+	EventStart           = "start"
+	EventStop            = "stop"
+	EventQuotaExceeded   = "quota_exceeded"
+	EventDCUnhealthy     = "dc_unhealthy"
+	EventAddrQuarantined = "address_quarantined"
+)
+
+// Events is a list of all known event names.
+var Events = []string{
+	EventStart,
+	EventStop,
+	EventQuotaExceeded,
+	EventDCUnhealthy,
+	EventAddrQuarantined,
+}
+
+// Event is a notable change of proxy state. SocketID and Addr are set
+// for events of client sessions. Data has event specific fields.
+type Event struct {
+	Name     string                 `json:"event"`
+	Time     time.Time              `json:"time"`
+	SecretID string                 `json:"secret_id"`
+	SocketID string                 `json:"socketid,omitempty"`
+	Addr     string                 `json:"addr,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// ParseWebhookTemplate parses template of webhook payload. Template is
+// executed with Event, json function encodes any value as JSON, so
+// strings are quoted and escaped properly.
+func ParseWebhookTemplate(text string) (*template.Template, error) {
+	tpl, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(value interface{}) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot parse webhook template")
+	}
+
+	return tpl, nil
+}
+
+// webhooks posts events to configured URLs. Event is sent as JSON if
+// template is not set.
+type webhooks struct {
+	urls     []string
+	events   map[string]bool
+	template *template.Template
+	client   *http.Client
+	logger   Logger
+}
+
+func (w *webhooks) payload(event Event) ([]byte, error) {
+	if w.template == nil {
+		return json.Marshal(event)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := w.template.Execute(buf, event); err != nil {
+		return nil, errors.Annotate(err, "Cannot execute webhook template")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// send posts event to all URLs. It blocks until all requests are done,
+// so it has to be run in goroutine unless caller has to wait.
+func (w *webhooks) send(event Event) {
+	if w == nil || (len(w.events) > 0 && !w.events[event.Name]) {
+		return
+	}
+
+	body, err := w.payload(event)
+	if err != nil {
+		w.logger.Warnw("Cannot make webhook payload", "event", event.Name, "error", err)
+		return
+	}
+
+	for _, url := range w.urls {
+		resp, err := w.client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			w.logger.Warnw("Cannot send webhook", "event", event.Name, "error", err)
+			continue
+		}
+		resp.Body.Close() // nolint: errcheck
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			w.logger.Warnw("Webhook has failed", "event", event.Name, "status", resp.Status)
+		}
+	}
+}
+
+func newWebhooks(urls, events []string, text string, logger Logger) *webhooks {
+	if len(urls) == 0 {
+		return nil
+	}
+
+	hooks := &webhooks{
+		urls:   urls,
+		events: make(map[string]bool, len(events)),
+		client: &http.Client{Timeout: webhookTimeout},
+		logger: logger,
+	}
+	for _, name := range events {
+		hooks.events[name] = true
+	}
+	if text != "" {
+		tpl, err := ParseWebhookTemplate(text)
+		if err != nil {
+			logger.Errorw("Webhook template is invalid, send events as JSON", "error", err)
+		}
+		hooks.template = tpl
+	}
+
+	return hooks
+}
+
+func (s *Server) event(name string, data map[string]interface{}) Event {
+	return Event{
+		Name:     name,
+		Time:     time.Now(),
+		SecretID: s.conf.SecretID(),
+		Data:     data,
+	}
+}
+
+// notify records event and sends it to webhooks in background.
+func (s *Server) notify(name string, data map[string]interface{}) {
+	event := s.event(name, data)
+	s.events.add(event)
+	if s.webhooks != nil {
+		go s.webhooks.send(event)
+	}
+}
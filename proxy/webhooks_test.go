@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func webhookServer() (*httptest.Server, chan []byte) {
+	bodies := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body) // nolint: gas
+		bodies <- body
+	}))
+
+	return server, bodies
+}
+
+func TestWebhooksJSON(t *testing.T) {
+	server, bodies := webhookServer()
+	defer server.Close()
+
+	conf := &config.Config{
+		Secret:        make([]byte, 16),
+		TrafficQuota:  10,
+		Webhooks:      []string{server.URL},
+		WebhookEvents: []string{EventQuotaExceeded},
+	}
+	srv := NewServer(conf, zap.NewNop().Sugar(), NewStats(conf))
+
+	srv.webhooks.send(srv.event(EventStart, nil))
+	srv.stats.secret.addUpload(10)
+	srv.checkQuota()
+
+	select {
+	case body := <-bodies:
+		event := Event{}
+		assert.Nil(t, json.Unmarshal(body, &event))
+		assert.Equal(t, EventQuotaExceeded, event.Name)
+		assert.Equal(t, conf.SecretID(), event.SecretID)
+		assert.EqualValues(t, 10, event.Data["usage"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("Webhook is not called")
+	}
+	assert.Len(t, bodies, 0)
+}
+
+func TestWebhooksTemplate(t *testing.T) {
+	server, bodies := webhookServer()
+	defer server.Close()
+
+	hooks := newWebhooks([]string{server.URL}, nil,
+		`{"text": {{ printf "%s: DC %v is down" .Name .Data.dc | json }}}`, zap.NewNop().Sugar())
+	hooks.send(Event{Name: EventDCUnhealthy, Data: map[string]interface{}{"dc": 2}})
+
+	assert.JSONEq(t, `{"text": "dc_unhealthy: DC 2 is down"}`, string(<-bodies))
+}
+
+func TestParseWebhookTemplateInvalid(t *testing.T) {
+	_, err := ParseWebhookTemplate("{{ .Name ")
+	assert.NotNil(t, err)
+}
+
+func TestStatsDCHealthTransition(t *testing.T) {
+	health := newStatsDCHealth()
+
+	assert.True(t, health.set(1, "ipv4", statsDCProbe{Reachable: true}))
+	assert.True(t, health.set(1, "ipv4", statsDCProbe{}))
+	assert.False(t, health.set(1, "ipv4", statsDCProbe{}))
+	assert.True(t, health.set(2, "ipv4", statsDCProbe{}))
+}
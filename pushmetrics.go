@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/9seconds/mtg/metrics"
+	"github.com/9seconds/mtg/proxy"
+)
+
+// pushMetrics starts pushing metrics to configured monitoring systems.
+func pushMetrics(conf *config.Config, stat *proxy.Stats, logger proxy.Logger) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = conf.ServerName
+	}
+	tags := map[string]string{
+		"host":   host,
+		"secret": conf.SecretID(),
+	}
+
+	if *influxDBURL != "" {
+		sink := metrics.NewInfluxDB(*influxDBURL, *influxDBToken, *metricsPushInterval)
+		go metrics.Push(sink, stat, tags, *metricsPushInterval, logger)
+	}
+	if *graphiteAddr != "" {
+		sink := metrics.NewGraphite(*graphiteAddr, *graphitePrefix, *metricsPushInterval)
+		go metrics.Push(sink, stat, tags, *metricsPushInterval, logger)
+	}
+	if *pushgatewayURL != "" {
+		instance := *pushgatewayInstance
+		if instance == "" {
+			instance = host
+		}
+		sink := metrics.NewPushgateway(*pushgatewayURL, *pushgatewayJob, instance, *metricsPushInterval)
+		go metrics.Push(sink, stat, tags, *metricsPushInterval, logger)
+	}
+}
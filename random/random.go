@@ -0,0 +1,45 @@
+// Package random is a single source of randomness for handshake frames,
+// nonces and secrets. It is crypto/rand unless caller passes its own
+// deterministic source for tests or benchmarks.
+package random
+
+import (
+	"crypto/rand"
+	"io"
+	mrand "math/rand"
+	"sync"
+)
+
+// Read fills p with random bytes from crypto/rand.
+func Read(p []byte) (int, error) {
+	return ReadFrom(nil, p)
+}
+
+// ReadFrom fills p with random bytes from source. nil source means
+// crypto/rand. Deterministic source makes handshakes predictable, so it
+// must never be used for real traffic.
+func ReadFrom(source io.Reader, p []byte) (int, error) {
+	if source == nil {
+		source = rand.Reader
+	}
+
+	return io.ReadFull(source, p)
+}
+
+type deterministicSource struct {
+	mutex sync.Mutex
+	rand  *mrand.Rand
+}
+
+func (d *deterministicSource) Read(p []byte) (int, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.rand.Read(p)
+}
+
+// NewDeterministicSource returns source which produces the same bytes
+// for the same seed. It is safe for concurrent use.
+func NewDeterministicSource(seed int64) io.Reader {
+	return &deterministicSource{rand: mrand.New(mrand.NewSource(seed))} // nolint: gas
+}
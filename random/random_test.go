@@ -0,0 +1,22 @@
+package random
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeterministicSource(t *testing.T) {
+	first := make([]byte, 32)
+	_, err := ReadFrom(NewDeterministicSource(42), first)
+	assert.Nil(t, err)
+
+	second := make([]byte, 32)
+	_, err = ReadFrom(NewDeterministicSource(42), second)
+	assert.Nil(t, err)
+	assert.Equal(t, first, second)
+
+	_, err = Read(second)
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, second)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/9seconds/mtg/proxy"
+)
+
+const (
+	reportFormatCSV  = "csv"
+	reportFormatJSON = "json"
+
+	reportDayFormat = "2006-01-02"
+)
+
+type report struct {
+	Since   string              `json:"since"`
+	Until   string              `json:"until"`
+	Secrets []proxy.SecretUsage `json:"secrets"`
+}
+
+func printReport() {
+	since, err := time.Parse(reportDayFormat, *reportSince)
+	if err != nil {
+		usage("Since has to be a date in YYYY-MM-DD format.")
+	}
+	until := time.Now().UTC()
+	if *reportUntil != "" {
+		if until, err = time.Parse(reportDayFormat, *reportUntil); err != nil {
+			usage("Until has to be a date in YYYY-MM-DD format.")
+		}
+	}
+	if until.Before(since) {
+		usage("Until has to be after since.")
+	}
+
+	secrets, err := proxy.ReadUsage(*reportStateFile, since, until)
+	if err != nil {
+		usage(err.Error())
+	}
+	rpt := report{
+		Since:   since.Format(reportDayFormat),
+		Until:   until.Format(reportDayFormat),
+		Secrets: secrets,
+	}
+
+	if *reportFormat == reportFormatJSON {
+		printJSON(rpt)
+		return
+	}
+
+	writer := csv.NewWriter(os.Stdout)
+	writer.Write([]string{"secret_id", "since", "until", "upload", "download"}) // nolint: errcheck
+	for _, secret := range rpt.Secrets {
+		writer.Write([]string{ // nolint: errcheck
+			secret.SecretID,
+			rpt.Since,
+			rpt.Until,
+			strconv.FormatUint(secret.Upload, 10),
+			strconv.FormatUint(secret.Download, 10),
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		usage(err.Error())
+	}
+}
@@ -0,0 +1,64 @@
+// Package retry repeats failed operations with exponential backoff.
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Policy describes how failed operation is retried. Attempts include
+// the first one, so 1 means no retries. Delay before each next retry is
+// multiplied by Multiplier and randomly changed by up to Jitter share of
+// it in both directions.
+type Policy struct {
+	Attempts   uint
+	Delay      time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// Do calls fn until it succeeds or attempts are exhausted. Waiting is
+// aborted if context is done. Error of the last attempt is returned.
+func (p Policy) Do(ctx context.Context, fn func() error) error {
+	err := fn()
+	for attempt := uint(1); err != nil && attempt < p.Attempts; attempt++ {
+		if waitErr := p.Wait(ctx, attempt); waitErr != nil {
+			return err
+		}
+		err = fn()
+	}
+
+	return err
+}
+
+// Wait sleeps before given retry (1-based). It returns error if context
+// is done earlier.
+func (p Policy) Wait(ctx context.Context, retry uint) error {
+	delay := p.delay(retry)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (p Policy) delay(retry uint) time.Duration {
+	delay := float64(p.Delay)
+	for i := uint(1); i < retry && p.Multiplier > 0; i++ {
+		delay *= p.Multiplier
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1) // nolint: gas
+	}
+
+	return time.Duration(delay)
+}
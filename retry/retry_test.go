@@ -0,0 +1,55 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	policy := Policy{Delay: 100 * time.Millisecond, Multiplier: 2}
+	assert.Equal(t, 100*time.Millisecond, policy.delay(1))
+	assert.Equal(t, 200*time.Millisecond, policy.delay(2))
+	assert.Equal(t, 400*time.Millisecond, policy.delay(3))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := policy.delay(2)
+		assert.True(t, delay >= 100*time.Millisecond && delay <= 300*time.Millisecond)
+	}
+}
+
+func TestPolicyDo(t *testing.T) {
+	calls := 0
+	failing := func() error {
+		calls++
+		return errors.New("failed")
+	}
+
+	assert.NotNil(t, Policy{Attempts: 3}.Do(context.Background(), failing))
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	assert.NotNil(t, Policy{}.Do(context.Background(), failing))
+	assert.Equal(t, 1, calls)
+
+	calls = 0
+	err := Policy{Attempts: 5}.Do(context.Background(), func() error {
+		calls++
+		if calls < 2 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, calls)
+
+	calls = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NotNil(t, Policy{Attempts: 3, Delay: time.Hour}.Do(ctx, failing))
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,44 @@
+// Package ring keeps a fixed number of last added items, so recent
+// history can be inspected without external storage.
+package ring
+
+import "sync"
+
+// Ring is a fixed size buffer which overwrites the oldest item when it
+// is full. It is safe for concurrent use.
+type Ring struct {
+	mutex sync.Mutex
+	items []interface{}
+	next  int
+	full  bool
+}
+
+// Add puts item into the ring.
+func (r *Ring) Add(item interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.items[r.next] = item
+	if r.next++; r.next == len(r.items) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// Items returns kept items, oldest first.
+func (r *Ring) Items() []interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	items := make([]interface{}, 0, len(r.items))
+	if r.full {
+		items = append(items, r.items[r.next:]...)
+	}
+
+	return append(items, r.items[:r.next]...)
+}
+
+// New creates ring which keeps size last items.
+func New(size int) *Ring {
+	return &Ring{items: make([]interface{}, size)}
+}
@@ -0,0 +1,20 @@
+package ring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	ring := New(3)
+	assert.Empty(t, ring.Items())
+
+	ring.Add(1)
+	ring.Add(2)
+	assert.Equal(t, []interface{}{1, 2}, ring.Items())
+
+	ring.Add(3)
+	ring.Add(4)
+	assert.Equal(t, []interface{}{2, 3, 4}, ring.Items())
+}
@@ -3,10 +3,16 @@ set -eu
 
 PROJECT_DIR="$(git rev-parse --show-toplevel)"
 OUTPUT_FILE="${PROJECT_DIR}/version.go"
+BUILD_DATE="$(date -Ru)"
 
 cat > "$OUTPUT_FILE" <<EOF
 package main
-// autogenerated by $(basename "$0") on $(date -Ru)
+// autogenerated by $(basename "$0") on ${BUILD_DATE}
 
-const version = "$(git describe --long --always) ($(go version)) [$(date -Ru)]"
+const (
+	version   = "$(git describe --long --always) ($(go version)) [${BUILD_DATE}]"
+	tag       = "$(git describe --tags --always)"
+	commit    = "$(git rev-parse HEAD)"
+	buildDate = "${BUILD_DATE}"
+)
 EOF
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/9seconds/mtg/selfupdate"
+)
+
+func selfUpdate() {
+	executable, err := os.Executable()
+	if err != nil {
+		usage("Cannot find current executable: " + err.Error())
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		usage("Cannot resolve current executable: " + err.Error())
+	}
+
+	updater := selfupdate.NewUpdater(*selfUpdateRepository)
+	release, err := updater.LatestRelease()
+	if err != nil {
+		usage(err.Error())
+	}
+
+	if release.TagName == tag && !*selfUpdateForce {
+		fmt.Printf("mtg %s is already the latest release\n", tag)
+		return
+	}
+
+	if err := updater.Update(release, executable); err != nil {
+		usage(err.Error())
+	}
+	fmt.Printf("mtg is updated from %s to %s\n", tag, release.TagName)
+}
@@ -0,0 +1,191 @@
+package selfupdate
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const (
+	checksumsAssetName = "SHA256SUMS"
+	httpTimeout        = 5 * time.Minute
+)
+
+// Release is a GitHub release of mtg.
+type Release struct {
+	TagName string  `json:"tag_name"`
+	Assets  []Asset `json:"assets"`
+}
+
+// Asset is a file attached to the release.
+type Asset struct {
+	Name        string `json:"name"`
+	DownloadURL string `json:"browser_download_url"`
+}
+
+// Updater checks GitHub releases and replaces current executable with
+// the binary built for this platform.
+type Updater struct {
+	repository string
+	client     *http.Client
+}
+
+// LatestRelease fetches metadata of the latest published release.
+func (u *Updater) LatestRelease() (*Release, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", u.repository)
+	resp, err := u.get(url)
+	if err != nil {
+		return nil, errors.Annotate(err, "Cannot fetch latest release")
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	release := &Release{}
+	if err := json.NewDecoder(resp.Body).Decode(release); err != nil {
+		return nil, errors.Annotate(err, "Cannot decode release")
+	}
+
+	return release, nil
+}
+
+// Update downloads binary for current platform from the given release,
+// verifies its checksum and atomically replaces executable at path.
+// Checksums are taken from the same release, so they detect corrupted
+// downloads only, not a tampered release.
+func (u *Updater) Update(release *Release, path string) error {
+	binaryAsset := release.findAsset(AssetName())
+	if binaryAsset == nil {
+		return errors.Errorf("Release %s has no binary %s", release.TagName, AssetName())
+	}
+	checksumsAsset := release.findAsset(checksumsAssetName)
+	if checksumsAsset == nil {
+		return errors.Errorf("Release %s has no %s", release.TagName, checksumsAssetName)
+	}
+
+	expected, err := u.fetchChecksum(checksumsAsset, binaryAsset.Name)
+	if err != nil {
+		return errors.Annotate(err, "Cannot fetch checksum")
+	}
+
+	resp, err := u.get(binaryAsset.DownloadURL)
+	if err != nil {
+		return errors.Annotate(err, "Cannot download binary")
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	return replaceExecutable(path, resp.Body, expected)
+}
+
+func (u *Updater) fetchChecksum(asset *Asset, name string) (string, error) {
+	resp, err := u.get(asset.DownloadURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", errors.Errorf("No checksum for %s", name)
+}
+
+func (u *Updater) get(url string) (*http.Response, error) {
+	resp, err := u.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close() // nolint: errcheck
+		return nil, errors.Errorf("Unexpected status %s for %s", resp.Status, url)
+	}
+
+	return resp, nil
+}
+
+func (r *Release) findAsset(name string) *Asset {
+	for i := range r.Assets {
+		if r.Assets[i].Name == name {
+			return &r.Assets[i]
+		}
+	}
+
+	return nil
+}
+
+// AssetName returns a name of release binary for current platform.
+func AssetName() string {
+	return fmt.Sprintf("mtg-%s-%s", runtime.GOOS, runtime.GOARCH)
+}
+
+func replaceExecutable(path string, body io.Reader, checksum string) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return errors.Annotate(err, "Cannot stat executable")
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), ".mtg-update-")
+	if err != nil {
+		return errors.Annotate(err, "Cannot create temporary file")
+	}
+	defer os.Remove(tmpFile.Name()) // nolint: errcheck
+
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmpFile, hasher), body)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Annotate(err, "Cannot write new binary")
+	}
+
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != checksum {
+		return errors.Errorf("Checksum mismatch: expected %s, got %s", checksum, actual)
+	}
+	if err := os.Chmod(tmpFile.Name(), stat.Mode()); err != nil {
+		return errors.Annotate(err, "Cannot set permissions")
+	}
+
+	// Windows cannot overwrite running executable but can rename it.
+	if runtime.GOOS == "windows" {
+		oldPath := path + ".old"
+		os.Remove(oldPath) // nolint: errcheck
+		if err := os.Rename(path, oldPath); err != nil {
+			return errors.Annotate(err, "Cannot move current executable")
+		}
+	}
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return errors.Annotate(err, "Cannot replace executable")
+	}
+
+	return nil
+}
+
+// NewUpdater creates new updater for given GitHub repository (owner/name).
+func NewUpdater(repository string) *Updater {
+	return &Updater{
+		repository: repository,
+		client:     &http.Client{Timeout: httpTimeout},
+	}
+}
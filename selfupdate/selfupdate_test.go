@@ -0,0 +1,62 @@
+package selfupdate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const newBinaryChecksum = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+func TestReplaceExecutable(t *testing.T) {
+	path := makeExecutable(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	err := replaceExecutable(path, bytes.NewBufferString("hello"), newBinaryChecksum)
+	assert.Nil(t, err)
+
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "hello", string(data))
+
+	stat, _ := os.Stat(path)
+	assert.Equal(t, os.FileMode(0755), stat.Mode().Perm())
+}
+
+func TestReplaceExecutableBadChecksum(t *testing.T) {
+	path := makeExecutable(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	err := replaceExecutable(path, bytes.NewBufferString("hello!"), newBinaryChecksum)
+	assert.NotNil(t, err)
+
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "old", string(data))
+
+	files, _ := ioutil.ReadDir(filepath.Dir(path))
+	assert.Len(t, files, 1)
+}
+
+func TestFindAsset(t *testing.T) {
+	release := &Release{Assets: []Asset{{Name: "a"}, {Name: AssetName()}}}
+
+	assert.Equal(t, AssetName(), release.findAsset(AssetName()).Name)
+	assert.Nil(t, release.findAsset("b"))
+}
+
+func makeExecutable(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "mtg-selfupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "mtg")
+	if err := ioutil.WriteFile(path, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
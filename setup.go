@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/9seconds/mtg/config"
+	"github.com/9seconds/mtg/proxy"
+	"github.com/9seconds/mtg/random"
+	"github.com/juju/errors"
+)
+
+const setupTimeout = 10 * time.Second
+
+var errSetupCancelled = errors.New("Setup is cancelled")
+
+type setupPrompt struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask shows question with default value and returns the answer. Empty
+// answer means default value.
+func (p *setupPrompt) ask(question, value string) (string, error) {
+	if value != "" {
+		question += " [" + value + "]"
+	}
+	fmt.Fprint(p.out, question+": ") // nolint: errcheck
+
+	answer, err := p.in.ReadString('\n')
+	if err != nil && answer == "" {
+		return "", errSetupCancelled
+	}
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer, nil
+	}
+
+	return value, nil
+}
+
+func (p *setupPrompt) askPort(question, value string) (uint16, error) {
+	for {
+		answer, err := p.ask(question, value)
+		if err != nil {
+			return 0, err
+		}
+		if port, err := strconv.ParseUint(answer, 10, 16); err == nil && port > 0 {
+			return uint16(port), nil
+		}
+		fmt.Fprintln(p.out, "Port has to be a number from 1 to 65535.") // nolint: errcheck
+	}
+}
+
+func (p *setupPrompt) askYes(question string) (bool, error) {
+	answer, err := p.ask(question+" (y/n)", "n")
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, err
+	}
+
+	return false, err
+}
+
+func randomHex(size int) (string, error) {
+	data := make([]byte, size)
+	if _, err := random.Read(data); err != nil {
+		return "", errors.Annotate(err, "Cannot generate random data")
+	}
+
+	return hex.EncodeToString(data), nil
+}
+
+// runSetup asks a few questions and writes MTG_* variables for them to
+// environment file, which can be used with EnvironmentFile= of systemd
+// or with docker --env-file.
+func runSetup() {
+	serverName, _ := publicIP(&http.Client{Timeout: setupTimeout}, ipifyURLv4) // nolint: gas
+	if err := setup(os.Stdin, os.Stdout, *setupFile, serverName); err != nil {
+		usage(err.Error())
+	}
+}
+
+// setup runs setup dialog over given input and output. serverName is
+// a default answer for the hostname question.
+func setup(in io.Reader, out io.Writer, fileName, serverName string) error {
+	if _, err := os.Stat(fileName); err == nil {
+		return errors.Errorf("File %s already exists", fileName)
+	}
+
+	prompt := &setupPrompt{in: bufio.NewReader(in), out: out}
+	port, err := prompt.askPort("Port to listen on", "443")
+	if err != nil {
+		return err
+	}
+	for {
+		if serverName, err = prompt.ask("Hostname or IP address clients connect to", serverName); err != nil {
+			return err
+		}
+		if serverName != "" {
+			break
+		}
+	}
+
+	secret, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	env := [][2]string{
+		{"MTG_SECRET", secret},
+		{"MTG_IP", "0.0.0.0"},
+		{"MTG_PORT", strconv.Itoa(int(port))},
+		{"MTG_SERVER", serverName},
+	}
+	publish := fmt.Sprintf("-p %d:%d", port, port)
+
+	exposeStats, err := prompt.askYes("Expose stats outside of this host")
+	if err != nil {
+		return err
+	}
+	if exposeStats {
+		statsPort, err := prompt.askPort("Stats port", "3129")
+		if err != nil {
+			return err
+		}
+		token, err := randomHex(16)
+		if err != nil {
+			return err
+		}
+		env = append(env,
+			[2]string{"MTG_STATS_IP", "0.0.0.0"},
+			[2]string{"MTG_STATS_PORT", strconv.Itoa(int(statsPort))},
+			[2]string{"MTG_STATS_TOKEN", token},
+		)
+		publish += fmt.Sprintf(" -p %d:%d", statsPort, statsPort)
+	} else {
+		// docker image listens for stats on all interfaces by default
+		env = append(env, [2]string{"MTG_STATS_IP", "127.0.0.1"})
+	}
+
+	content := ""
+	for _, pair := range env {
+		content += pair[0] + "=" + pair[1] + "\n"
+	}
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Configuration is written to %s. Run proxy with:\n\n", fileName)            // nolint: errcheck
+	fmt.Fprintf(out, "  $ docker run --env-file %s %s nineseconds/mtg\n\n", fileName, publish)   // nolint: errcheck
+	fmt.Fprintf(out, "or set EnvironmentFile=%s in systemd unit. Links to share:\n\n", fileName) // nolint: errcheck
+
+	secretBytes, _ := hex.DecodeString(secret) // nolint: gas
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(proxy.NewStats(&config.Config{
+		PublicPort: port,
+		ServerName: serverName,
+		Secret:     secretBytes,
+	}).URLs)
+}
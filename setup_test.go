@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runTestSetup(t *testing.T, answers, serverName string) (string, string, error) {
+	dir, err := ioutil.TempDir("", "mtg-setup")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, "mtg.env")
+	out := &bytes.Buffer{}
+	err = setup(strings.NewReader(answers), out, fileName, serverName)
+	content, _ := ioutil.ReadFile(fileName)
+
+	return string(content), out.String(), err
+}
+
+func TestSetupPromptAskPort(t *testing.T) {
+	out := &bytes.Buffer{}
+	prompt := &setupPrompt{in: bufio.NewReader(strings.NewReader("0\nport\n8443\n")), out: out}
+
+	port, err := prompt.askPort("Port", "443")
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(8443), port)
+	assert.Equal(t, 2, strings.Count(out.String(), "Port has to be a number"))
+
+	_, err = prompt.askPort("Port", "443")
+	assert.Equal(t, errSetupCancelled, err)
+}
+
+func TestSetupLocalStats(t *testing.T) {
+	content, out, err := runTestSetup(t, "\n\nn\n", "example.com")
+	assert.Nil(t, err)
+
+	assert.Contains(t, content, "MTG_PORT=443\n")
+	assert.Contains(t, content, "MTG_SERVER=example.com\n")
+	assert.Contains(t, content, "MTG_STATS_IP=127.0.0.1\n")
+	assert.NotContains(t, content, "MTG_STATS_TOKEN")
+	assert.Contains(t, out, "docker run --env-file")
+	assert.Contains(t, out, " -p 443:443 nineseconds/mtg")
+	assert.Contains(t, out, "tg://proxy?port=443&secret=")
+}
+
+func TestSetupExposedStats(t *testing.T) {
+	content, out, err := runTestSetup(t, "8443\n\nproxy.example.com\ny\n3130\n", "")
+	assert.Nil(t, err)
+
+	assert.Contains(t, content, "MTG_PORT=8443\n")
+	assert.Contains(t, content, "MTG_SERVER=proxy.example.com\n")
+	assert.Contains(t, content, "MTG_STATS_IP=0.0.0.0\n")
+	assert.Contains(t, content, "MTG_STATS_PORT=3130\n")
+	assert.Contains(t, content, "MTG_STATS_TOKEN=")
+	assert.Contains(t, out, " -p 8443:8443 -p 3130:3130 nineseconds/mtg")
+}
+
+func TestSetupCancelled(t *testing.T) {
+	content, _, err := runTestSetup(t, "443\n", "example.com")
+	assert.Equal(t, errSetupCancelled, err)
+	assert.Empty(t, content)
+}
+
+func TestSetupFileExists(t *testing.T) {
+	file, err := ioutil.TempFile("", "mtg-setup")
+	assert.Nil(t, err)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	err = setup(strings.NewReader("\n\nn\n"), &bytes.Buffer{}, file.Name(), "example.com")
+	assert.NotNil(t, err)
+}
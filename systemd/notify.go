@@ -0,0 +1,35 @@
+// Package systemd implements sd_notify protocol, so proxy can report
+// its state to service manager.
+package systemd
+
+import (
+	"net"
+	"os"
+
+	"github.com/juju/errors"
+)
+
+// Notify sends state, like READY=1, to service manager. It returns
+// false if proxy is not run by systemd with NOTIFY_SOCKET.
+func Notify(state string) (bool, error) {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return false, nil
+	}
+
+	addr := &net.UnixAddr{Name: socketPath, Net: "unixgram"}
+	if socketPath[0] == '@' {
+		addr.Name = "\x00" + socketPath[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return false, errors.Annotate(err, "Cannot connect to notify socket")
+	}
+	defer conn.Close() // nolint: errcheck
+
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return false, errors.Annotate(err, "Cannot send notification")
+	}
+
+	return true, nil
+}
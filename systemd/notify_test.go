@@ -0,0 +1,45 @@
+package systemd
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtg-systemd")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	socketPath := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Skip("Unix datagram sockets are not supported")
+	}
+	defer conn.Close() // nolint: errcheck
+
+	defer os.Setenv("NOTIFY_SOCKET", os.Getenv("NOTIFY_SOCKET")) // nolint: errcheck
+	os.Setenv("NOTIFY_SOCKET", socketPath)                       // nolint: errcheck
+
+	sent, err := Notify("READY=1")
+	assert.Nil(t, err)
+	assert.True(t, sent)
+
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "READY=1", string(buf[:n]))
+}
+
+func TestNotifyNoSocket(t *testing.T) {
+	defer os.Setenv("NOTIFY_SOCKET", os.Getenv("NOTIFY_SOCKET")) // nolint: errcheck
+	os.Unsetenv("NOTIFY_SOCKET")                                 // nolint: errcheck
+
+	sent, err := Notify("READY=1")
+	assert.Nil(t, err)
+	assert.False(t, sent)
+}
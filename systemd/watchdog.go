@@ -0,0 +1,22 @@
+package systemd
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// WatchdogInterval returns how often systemd expects WATCHDOG=1
+// notifications. It returns 0 if watchdog is not enabled for this
+// process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond
+}
@@ -0,0 +1,29 @@
+package systemd
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchdogInterval(t *testing.T) {
+	defer os.Setenv("WATCHDOG_USEC", os.Getenv("WATCHDOG_USEC")) // nolint: errcheck
+	defer os.Setenv("WATCHDOG_PID", os.Getenv("WATCHDOG_PID"))   // nolint: errcheck
+
+	os.Setenv("WATCHDOG_USEC", "30000000") // nolint: errcheck
+	os.Unsetenv("WATCHDOG_PID")            // nolint: errcheck
+	assert.Equal(t, 30*time.Second, WatchdogInterval())
+
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid())) // nolint: errcheck
+	assert.Equal(t, 30*time.Second, WatchdogInterval())
+
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1)) // nolint: errcheck
+	assert.Equal(t, time.Duration(0), WatchdogInterval())
+
+	os.Unsetenv("WATCHDOG_PID")       // nolint: errcheck
+	os.Setenv("WATCHDOG_USEC", "abc") // nolint: errcheck
+	assert.Equal(t, time.Duration(0), WatchdogInterval())
+}